@@ -0,0 +1,247 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Reason is a stable, machine-readable code for the outcome of verifying a file.
+type Reason string
+
+// Verification reasons.
+const (
+	ReasonOK        Reason = "OK"            // The stored CRC matches the content
+	ReasonMismatch  Reason = "MISMATCH"      // The stored CRC does not match the content
+	ReasonNoComment Reason = "NO_COMMENT"    // The file has no integrity comment
+	ReasonBadFormat Reason = "BAD_FORMAT"    // The integrity comment is malformed
+	ReasonTrailing  Reason = "TRAILING_DATA" // Content follows the integrity comment
+	ReasonTooLarge  Reason = "TOO_LARGE"     // The file exceeds Config.MaxFileSize
+	ReasonReadError Reason = "READ_ERROR"    // The file could not be read
+)
+
+// ReasonFor classifies the outcome of a verification from its result and error.
+func ReasonFor(valid bool, err error) Reason {
+	switch {
+	case errors.Is(err, ErrNoComment):
+		return ReasonNoComment
+	case errors.Is(err, ErrInvalidFormat), errors.Is(err, ErrUnsupportedVersion):
+		return ReasonBadFormat
+	case errors.Is(err, ErrTrailingData):
+		return ReasonTrailing
+	case errors.Is(err, ErrFileTooLarge):
+		return ReasonTooLarge
+	case err != nil:
+		return ReasonReadError
+	case !valid:
+		return ReasonMismatch
+	}
+	return ReasonOK
+}
+
+// FileResult is the outcome of verifying one file with VerifyFiles.
+type FileResult struct {
+	Path string
+	VerifyResult
+	Reason  Reason
+	Err     error  // Error from Reader.VerifyDetailed, if any
+	Warning string // Set if the file is also listed under another path with another style
+}
+
+// ProcessFileResult is the outcome of processing one file with Writer.ProcessFiles.
+type ProcessFileResult struct {
+	Path string
+	ProcessResult
+	Err error // Error from processing the file, if any
+}
+
+// ProcessFiles processes files one after another, like ProcessFile, and returns their results
+// in the same order. A failure does not stop the remaining files. The streaming buffer is
+// reused across files rather than allocated per file; concurrency is left to the caller,
+// who may call ProcessFiles on one Writer from several goroutines.
+func (w *Writer) ProcessFiles(files []string) []ProcessFileResult {
+	results := make([]ProcessFileResult, len(files))
+	for i, file := range files {
+		result, err := w.processFile(file, nil)
+		results[i] = ProcessFileResult{Path: file, ProcessResult: result, Err: err}
+	}
+	return results
+}
+
+// VerifyAll verifies files one after another, like VerifyFile, and returns whether each one
+// is valid, keyed by path. Files that could not be verified, such as missing or unstamped
+// files, are left out of the map; their errors are joined, each prefixed with its path, into
+// the returned error. A failure does not stop the remaining files.
+func (r *Reader) VerifyAll(files []string) (map[string]bool, error) {
+	valid := make(map[string]bool, len(files))
+	var errs []error
+	for _, file := range files {
+		ok, err := r.VerifyFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		valid[file] = ok
+	}
+	return valid, errors.Join(errs...)
+}
+
+// VerifyFiles verifies files on up to workers goroutines and calls report once per file,
+// in the order of files, on the calling goroutine. Results are reported as soon as every
+// earlier file has finished, so output is both deterministic and streamed. configFor picks
+// the configuration for each file and defaults to ConfigForExtension; it is called on a
+// single goroutine. A workers value below 1 uses GOMAXPROCS. Files are started in order, and
+// each waits while starting it would exceed its configuration's MaxConcurrentBytes. Files
+// listed under several paths with different comment styles are verified anyway, with the
+// warning from StyleConflicts in FileResult.Warning.
+func VerifyFiles(files []string, configFor func(path string) Config, workers int, report func(FileResult)) {
+	if configFor == nil {
+		configFor = defaultConfigFor
+	}
+	configs := make([]Config, len(files))
+	for i, file := range files {
+		configs[i] = configFor(file)
+	}
+	conflicts := styleConflicts(files, configs)
+
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// Each file has its own slot, so workers never block on a slow earlier file
+	results := make([]chan FileResult, len(files))
+	for i := range results {
+		results[i] = make(chan FileResult, 1)
+	}
+
+	memory := newBudget()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result, err := NewReader(configs[i]).VerifyDetailed(files[i])
+				memory.release(int64(configs[i].BufferSize))
+				results[i] <- FileResult{Path: files[i], VerifyResult: result, Reason: ReasonFor(result.Valid, err), Err: err,
+					Warning: conflicts[files[i]]}
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			memory.acquire(int64(configs[i].BufferSize), configs[i].MaxConcurrentBytes)
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for _, result := range results {
+		report(<-result)
+	}
+	wg.Wait()
+}
+
+// defaultConfigFor picks the configuration for path by its extension.
+func defaultConfigFor(path string) Config {
+	return ConfigForExtension(filepath.Ext(path))
+}
+
+// StyleConflicts validates a batch before it is processed: it finds files listed under
+// several paths, e.g. as "gen/a.py" and a symbolic link "a.go" to it, whose configurations
+// pick different comment styles. Each run would then replace the comment the other wrote,
+// which usually points to a bug in the script building the list. It returns a warning for
+// each listed path of such a file, keyed by the path as listed, naming the other paths.
+// configFor defaults to ConfigForExtension.
+func StyleConflicts(files []string, configFor func(path string) Config) map[string]string {
+	if configFor == nil {
+		configFor = defaultConfigFor
+	}
+	configs := make([]Config, len(files))
+	for i, file := range files {
+		configs[i] = configFor(file)
+	}
+	return styleConflicts(files, configs)
+}
+
+// styleConflicts implements StyleConflicts for files with the given configurations.
+func styleConflicts(files []string, configs []Config) map[string]string {
+	byFile := make(map[string][]int)
+	for i, file := range files {
+		resolved := resolvePath(file)
+		byFile[resolved] = append(byFile[resolved], i)
+	}
+
+	var warnings map[string]string
+	for _, listed := range byFile {
+		for _, i := range listed {
+			var others []string
+			for _, j := range listed {
+				if configs[j].CommentStyle != configs[i].CommentStyle && !slices.Contains(others, files[j]) {
+					others = append(others, files[j])
+				}
+			}
+			if len(others) > 0 {
+				if warnings == nil {
+					warnings = make(map[string]string)
+				}
+				warnings[files[i]] = fmt.Sprintf("same file as %s, which is given a different comment style",
+					strings.Join(others, ", "))
+			}
+		}
+	}
+	return warnings
+}
+
+// resolvePath returns the absolute path of file with symbolic links resolved, or as much of
+// that as can be determined, so that different paths to one file compare equal.
+func resolvePath(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+// budget tracks the bytes held by files in progress.
+type budget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	used int64
+}
+
+func newBudget() *budget {
+	b := &budget{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits until n more bytes fit within limit, then takes them. A non-positive limit
+// is unlimited, and n is always granted when nothing is in use, so a request larger than
+// the limit cannot wait forever.
+func (b *budget) acquire(n, limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for limit > 0 && b.used > 0 && b.used+n > limit {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+// release returns n bytes taken by acquire.
+func (b *budget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.cond.Broadcast()
+}
+
+// FileIntegrity: 19E1A0E3
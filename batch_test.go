@@ -0,0 +1,405 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestVerifyFiles ensures parallel verification reports every file in input order
+func TestVerifyFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	var files []string
+	for i := range 50 {
+		path := filepath.Join(dir, fmt.Sprintf("file%02d.go", i))
+		// Vary sizes so files finish out of order
+		content := fmt.Sprintf("package main\n\n// %0*d\n", (50-i)*2000, i)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if i%5 != 0 {
+			if err := ProcessGoFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i%7 == 0 {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.WriteString("// tampered\n")
+			f.Close()
+		}
+		files = append(files, path)
+	}
+
+	for _, workers := range []int{0, 1, 4, 100} {
+		var got []FileResult
+		VerifyFiles(files, nil, workers, func(r FileResult) {
+			got = append(got, r)
+		})
+
+		if len(got) != len(files) {
+			t.Fatalf("workers=%d: got %d results, want %d", workers, len(got), len(files))
+		}
+		for i, r := range got {
+			if r.Path != files[i] {
+				t.Fatalf("workers=%d: result %d is %s, want %s", workers, i, r.Path, files[i])
+			}
+
+			valid, err := VerifyGoFile(files[i])
+			if r.Valid != valid || errors.Is(r.Err, ErrNoComment) != errors.Is(err, ErrNoComment) {
+				t.Errorf("workers=%d: %s: got (%v, %v), want (%v, %v)", workers, r.Path, r.Valid, r.Err, valid, err)
+			}
+		}
+	}
+}
+
+// TestStyleConflicts ensures one file listed under paths that pick different styles is flagged
+func TestStyleConflicts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.py", "b.py"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("print(1)\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "link.go")
+	if err := os.Symlink("a.py", link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	a, b := filepath.Join(dir, "a.py"), filepath.Join(dir, "b.py")
+	files := []string{a, link, b, filepath.Join(dir, ".", "b.py")}
+	configFor := func(path string) Config { return ConfigForFilename(path, DefaultConfig()) }
+
+	conflicts := StyleConflicts(files, configFor)
+	want := map[string]string{
+		a:    "same file as " + link + ", which is given a different comment style",
+		link: "same file as " + a + ", which is given a different comment style",
+	}
+	if len(conflicts) != len(want) {
+		t.Errorf("StyleConflicts() = %q, want %q", conflicts, want)
+	}
+	for path, msg := range want {
+		if conflicts[path] != msg {
+			t.Errorf("StyleConflicts()[%s] = %q, want %q", path, conflicts[path], msg)
+		}
+	}
+
+	// A batch reports the same warnings with each file's outcome
+	VerifyFiles(files, configFor, 2, func(r FileResult) {
+		if r.Warning != want[r.Path] {
+			t.Errorf("%s: Warning = %q, want %q", r.Path, r.Warning, want[r.Path])
+		}
+	})
+
+	// The same path listed twice picks the same style, which is harmless
+	if conflicts := StyleConflicts([]string{a, a, b}, nil); len(conflicts) != 0 {
+		t.Errorf("StyleConflicts() of repeated paths = %q", conflicts)
+	}
+}
+
+// TestVerifyFilesEmpty ensures an empty file list reports nothing
+func TestVerifyFilesEmpty(t *testing.T) {
+	VerifyFiles(nil, nil, 4, func(r FileResult) {
+		t.Errorf("unexpected result for %s", r.Path)
+	})
+}
+
+// TestReasonFor ensures each verification outcome maps to its reason code
+func TestReasonFor(t *testing.T) {
+	tests := []struct {
+		valid bool
+		err   error
+		want  Reason
+	}{
+		{true, nil, ReasonOK},
+		{false, nil, ReasonMismatch},
+		{false, ErrNoComment, ReasonNoComment},
+		{false, ErrInvalidFormat, ReasonBadFormat},
+		{false, &FormatError{Reason: "bad"}, ReasonBadFormat},
+		{false, ErrTrailingData, ReasonTrailing},
+		{false, fmt.Errorf("%w: 10 bytes", ErrFileTooLarge), ReasonTooLarge},
+		{false, fmt.Errorf("failed to open file: %w", os.ErrNotExist), ReasonReadError},
+	}
+
+	for _, tt := range tests {
+		if got := ReasonFor(tt.valid, tt.err); got != tt.want {
+			t.Errorf("ReasonFor(%v, %v) = %s, want %s", tt.valid, tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestVerifyFilesReason ensures VerifyFiles fills in the reason for each file
+func TestVerifyFilesReason(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	valid := write("valid.go", "package main\n")
+	if err := ProcessGoFile(valid); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{
+		valid,
+		write("mismatch.go", "package main\n// FileIntegrity: 00000000\n"),
+		write("none.go", "package main\n"),
+		filepath.Join(dir, "missing.go"),
+	}
+	want := []Reason{ReasonOK, ReasonMismatch, ReasonNoComment, ReasonReadError}
+
+	i := 0
+	VerifyFiles(files, nil, 2, func(r FileResult) {
+		if r.Reason != want[i] {
+			t.Errorf("%s: Reason = %s, want %s", filepath.Base(r.Path), r.Reason, want[i])
+		}
+		i++
+	})
+}
+
+// TestVerifyFilesBudget ensures a low MaxConcurrentBytes throttles but does not stall verification
+func TestVerifyFilesBudget(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := range 20 {
+		path := filepath.Join(dir, fmt.Sprintf("file%d.go", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("package p%d\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ProcessGoFile(path); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	const workers = 8
+	for _, limit := range []int64{1, 2 * 4096, 1 << 30} {
+		// Every file is hashed while its buffer is held, so the files being hashed at once
+		// are a lower bound on the files in flight
+		var inFlight, peak atomic.Int64
+		hashing := writerFunc(func(p []byte) (int, error) {
+			n := inFlight.Add(1)
+			for old := peak.Load(); n > old && !peak.CompareAndSwap(old, n); old = peak.Load() {
+			}
+			time.Sleep(2 * time.Millisecond)
+			inFlight.Add(-1)
+			return len(p), nil
+		})
+		configFor := func(string) Config {
+			config := DefaultConfig()
+			config.BufferSize = 4096
+			config.MaxConcurrentBytes = limit
+			config.tee = hashing
+			return config
+		}
+		count := 0
+		VerifyFiles(files, configFor, workers, func(r FileResult) {
+			if r.Reason != ReasonOK {
+				t.Errorf("limit %d: %s: Reason = %s, want OK", limit, filepath.Base(r.Path), r.Reason)
+			}
+			count++
+		})
+		if count != len(files) {
+			t.Errorf("limit %d: reported %d files, want %d", limit, count, len(files))
+		}
+		if want := min(max(limit/4096, 1), workers); peak.Load() > want {
+			t.Errorf("limit %d: %d files in flight at once, want at most %d", limit, peak.Load(), want)
+		}
+	}
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// TestBudget ensures concurrent holders never exceed the limit
+func TestBudget(t *testing.T) {
+	const limit, size = 300, 100
+	b := newBudget()
+	var mu sync.Mutex
+	var held, peak int64
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.acquire(size, limit)
+			mu.Lock()
+			held += size
+			peak = max(peak, held)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			held -= size
+			mu.Unlock()
+			b.release(size)
+		}()
+	}
+	wg.Wait()
+	if peak > limit {
+		t.Errorf("peak held = %d, want at most %d", peak, limit)
+	}
+	if b.used != 0 {
+		t.Errorf("used = %d after all releases, want 0", b.used)
+	}
+
+	// A request larger than the limit is granted when nothing else is held
+	b.acquire(2*limit, limit)
+	b.release(2 * limit)
+}
+
+// TestProcessFiles ensures batch processing reports each file's result in order
+func TestProcessFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	stamped := write("stamped.go", "package main\n")
+	if err := ProcessGoFile(stamped); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{
+		write("a.go", "package a\n"),
+		stamped,
+		filepath.Join(dir, "missing.go"),
+		write("b.go", "package b\n"),
+	}
+
+	results := NewWriter(DefaultConfig()).ProcessFiles(files)
+	if len(results) != len(files) {
+		t.Fatalf("ProcessFiles() returned %d results, want %d", len(results), len(files))
+	}
+	wantChanged := []bool{true, false, false, true}
+	for i, r := range results {
+		if r.Path != files[i] {
+			t.Errorf("result %d: Path = %s, want %s", i, r.Path, files[i])
+		}
+		if r.Changed != wantChanged[i] {
+			t.Errorf("%s: Changed = %v, want %v", filepath.Base(r.Path), r.Changed, wantChanged[i])
+		}
+		if wantErr := i == 2; (r.Err != nil) != wantErr {
+			t.Errorf("%s: Err = %v, want error %v", filepath.Base(r.Path), r.Err, wantErr)
+		}
+	}
+
+	for _, file := range []string{files[0], files[3]} {
+		if valid, err := VerifyGoFile(file); err != nil || !valid {
+			t.Errorf("%s: VerifyGoFile() = %v, %v; want true, nil", filepath.Base(file), valid, err)
+		}
+	}
+}
+
+// BenchmarkProcessFiles measures processing many small files with one Writer
+func BenchmarkProcessFiles(b *testing.B) {
+	dir := b.TempDir()
+	var files []string
+	for i := range 100 {
+		path := filepath.Join(dir, fmt.Sprintf("file%d.go", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("package p%d\n", i)), 0644); err != nil {
+			b.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	writer := NewWriter(DefaultConfig())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		writer.ProcessFiles(files)
+	}
+}
+
+// TestVerifyAll ensures valid and invalid files are mapped while unreadable ones are reported
+func TestVerifyAll(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.go")
+	bad := filepath.Join(dir, "bad.go")
+	plain := filepath.Join(dir, "plain.go")
+	missing := filepath.Join(dir, "missing.go")
+	for _, name := range []string{good, bad, plain} {
+		if err := os.WriteFile(name, []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer := NewWriter(DefaultConfig())
+	for _, name := range []string{good, bad} {
+		if err := writer.ProcessFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, _ := os.ReadFile(bad)
+	if err := os.WriteFile(bad, append([]byte("// changed\n"), content...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := NewReader(DefaultConfig()).VerifyAll([]string{good, bad, plain, missing})
+	if len(valid) != 2 || !valid[good] || valid[bad] {
+		t.Errorf("VerifyAll() = %v, want %s valid and %s invalid", valid, good, bad)
+	}
+	if _, ok := valid[plain]; ok {
+		t.Errorf("VerifyAll() mapped unstamped %s", plain)
+	}
+	if !errors.Is(err, ErrNoComment) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("VerifyAll() error = %v, want ErrNoComment and ErrNotExist", err)
+	}
+
+	valid, err = NewReader(DefaultConfig()).VerifyAll([]string{good})
+	if err != nil || !valid[good] {
+		t.Errorf("VerifyAll() = %v, %v; want valid, nil", valid, err)
+	}
+}
+
+// TestProcessFilesHooks ensures OnModified and OnNoOp report each successful file once
+func TestProcessFilesHooks(t *testing.T) {
+	dir := t.TempDir()
+	stamped := filepath.Join(dir, "stamped.go")
+	plain := filepath.Join(dir, "plain.go")
+	missing := filepath.Join(dir, "missing.go")
+	for _, name := range []string{stamped, plain} {
+		if err := os.WriteFile(name, []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewWriter(DefaultConfig()).ProcessFile(stamped); err != nil {
+		t.Fatal(err)
+	}
+
+	var modified, noop []string
+	config := DefaultConfig()
+	config.OnModified = func(path string) { modified = append(modified, path) }
+	config.OnNoOp = func(path string) { noop = append(noop, path) }
+	NewWriter(config).ProcessFiles([]string{stamped, plain, missing})
+	if len(modified) != 1 || modified[0] != plain {
+		t.Errorf("OnModified called with %v, want [%s]", modified, plain)
+	}
+	if len(noop) != 1 || noop[0] != stamped {
+		t.Errorf("OnNoOp called with %v, want [%s]", noop, stamped)
+	}
+
+	// Either hook may be nil
+	fresh := filepath.Join(dir, "fresh.go")
+	if err := os.WriteFile(fresh, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.OnModified = nil
+	if err := NewWriter(config).ProcessFile(fresh); err != nil {
+		t.Errorf("ProcessFile() with nil OnModified failed: %v", err)
+	}
+}
+
+// FileIntegrity: 990E2C10
@@ -0,0 +1,138 @@
+package hashfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StampCache remembers the size and modification time of files a Writer stamped or found
+// correctly stamped, so that unchanged files can be skipped without being opened. Set it as
+// Config.StampCache, and persist it between runs with LoadStampCache and Save.
+//
+// The heuristic trusts modification times: a file rewritten with the same size within the
+// filesystem's timestamp granularity, or whose time was reset (e.g. by touch -r or some
+// archive tools), is skipped although it changed. Use it where speed matters more than
+// catching such edits, and run without it to be sure.
+//
+// A StampCache is safe for concurrent use.
+type StampCache struct {
+	mu      sync.Mutex
+	entries map[string]stampEntry // By absolute path
+	dirty   bool
+}
+
+// stampEntry records a file's state after it was stamped, and the settings it was stamped with.
+type stampEntry struct {
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mtime"` // Unix nanoseconds
+	Settings uint32 `json:"settings"`
+}
+
+// NewStampCache returns an empty cache.
+func NewStampCache() *StampCache {
+	return &StampCache{entries: make(map[string]stampEntry)}
+}
+
+// LoadStampCache reads a cache written by Save. A missing file yields an empty cache.
+func LoadStampCache(path string) (*StampCache, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewStampCache(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stamp cache: %w", err)
+	}
+	cache := NewStampCache()
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse stamp cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// Save writes the cache to path, replacing it atomically, unless nothing changed since it
+// was loaded or last saved.
+func (c *StampCache) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode stamp cache: %w", err)
+	}
+	dst, err := createTemp(filepath.Dir(path), DefaultTempPrefix, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := dst.Name()
+	defer os.Remove(tmpName) // Fails harmlessly once renamed
+	if _, err := dst.Write(data); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to write stamp cache: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to write stamp cache: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to write stamp cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// unchanged reports whether filename, described by info, is in the state it was recorded in
+// with the same settings.
+func (c *StampCache) unchanged(filename string, info os.FileInfo, config Config) bool {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[abs]
+	return ok && entry == stampEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Settings: config.settingsDigest()}
+}
+
+// record remembers the current state of filename, which has just been stamped.
+func (c *StampCache) record(filename string, config Config) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+	entry := stampEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Settings: config.settingsDigest()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[abs] != entry {
+		c.entries[abs] = entry
+		c.dirty = true
+	}
+}
+
+// settingsDigest summarizes the settings that decide what ProcessFile writes, so a file
+// stamped with other settings is not skipped.
+func (c Config) settingsDigest() uint32 {
+	ignore := ""
+	if c.IgnoreLines != nil {
+		ignore = c.IgnoreLines.String()
+	}
+	// The digest has letters, so their case is covered
+	settings := fmt.Sprintf("%s\x00%q\x00%s\x00%s\x00%s\x00%s\x00%v", c.comment(0xABCDEF01, ""), c.AcceptKeys, c.Namespace, ignore,
+		c.SidecarDir, c.GeneratedMarker, []bool{c.NormalizeGo, c.IgnoreMarkers, c.IncludePermBits, c.BlankLineBefore, c.NoFinalNewline,
+			c.PreserveModeline, c.ScriptMode})
+	return crc32.ChecksumIEEE([]byte(settings))
+}
+
+// FileIntegrity: 8420ADF6
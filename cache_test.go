@@ -0,0 +1,171 @@
+package hashfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStampCache ensures unchanged files are skipped, and changed files or settings are not
+func TestStampCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewStampCache()
+	config := DefaultConfig()
+	config.StampCache = cache
+
+	var modified, noop []string
+	config.OnModified = func(path string) { modified = append(modified, path) }
+	config.OnNoOp = func(path string) { noop = append(noop, path) }
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+
+	// A file the cache would skip is not even read, so an edit that keeps the size and
+	// modification time goes unnoticed: it is reported as a no-op, not restamped
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(content), "package main", "package nain", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Errorf("ProcessFile() of an unchanged file failed: %v", err)
+	}
+	if len(modified) != 1 || len(noop) != 1 {
+		t.Errorf("modified %v, no-op %v; want one each", modified, noop)
+	}
+
+	// Other settings are not served from the cache
+	other := config
+	other.Key = "Checksum"
+	if err := NewWriter(other).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() with another key failed: %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || !strings.Contains(string(content), "// Checksum: ") {
+		t.Errorf("Content with another key = %q (%v)", content, err)
+	}
+
+	// Nor is a digest case other than the recorded one, though the comments look alike
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	other = config
+	other.LowercaseDigest = true
+	if err := NewWriter(other).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() with a lowercase digest failed: %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || !regexp.MustCompile(`// FileIntegrity: [0-9a-f]{8}\n$`).Match(content) {
+		t.Errorf("Content with a lowercase digest = %q (%v)", content, err)
+	}
+
+	// Neither is a file that changed since it was recorded
+	if err := os.WriteFile(path, []byte("package edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() of an edited file failed: %v", err)
+	}
+	if valid, err := NewReader(config).VerifyFile(path); err != nil || !valid {
+		t.Errorf("VerifyFile() after edit = %v, %v; want true", valid, err)
+	}
+}
+
+// TestStampCacheSave ensures a saved cache loads with its entries, and a missing one is empty
+func TestStampCacheSave(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+	cache, err := LoadStampCache(cachePath)
+	if err != nil {
+		t.Fatalf("LoadStampCache() of a missing file failed: %v", err)
+	}
+
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.StampCache = cache
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	if err := cache.Save(cachePath); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	loaded, err := LoadStampCache(cachePath)
+	if err != nil {
+		t.Fatalf("LoadStampCache() failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.unchanged(path, info, config) {
+		t.Error("Loaded cache does not hold the stamped file")
+	}
+
+	if err := os.WriteFile(cachePath, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStampCache(cachePath); err == nil {
+		t.Error("LoadStampCache() accepted a corrupt cache")
+	}
+}
+
+// BenchmarkProcessUnchangedTree compares re-stamping an unchanged tree with and without a
+// StampCache, which skips reading the files
+func BenchmarkProcessUnchangedTree(b *testing.B) {
+	dir := b.TempDir()
+	content := strings.Repeat("func f() { return }\n", 3000) // 60KB
+	var files []string
+	for i := range 200 {
+		path := filepath.Join(dir, fmt.Sprintf("file%03d.go", i))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	cache := NewStampCache()
+	config := DefaultConfig()
+	config.StampCache = cache
+	for _, result := range NewWriter(config).ProcessFiles(files) {
+		if result.Err != nil {
+			b.Fatal(result.Err)
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		writer := NewWriter(DefaultConfig())
+		for b.Loop() {
+			writer.ProcessFiles(files)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		writer := NewWriter(config)
+		for b.Loop() {
+			writer.ProcessFiles(files)
+		}
+	})
+}
+
+// FileIntegrity: 7BF76978
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseAge parses a -modified-within duration such as "36h", also accepting whole days such
+// as "7d". An empty string is zero, meaning no limit.
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	var age time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("duration %q must be whole days (e.g. 7d) or a Go duration (e.g. 36h)", s)
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if age, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("duration %q must be whole days (e.g. 7d) or a Go duration (e.g. 36h)", s)
+		}
+	}
+	if age <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", s)
+	}
+	return age, nil
+}
+
+// modifiedSince keeps the files modified within maxAge of now, in order; a zero maxAge keeps
+// all. Files that cannot be stat'ed are kept, so verification reports the error.
+func modifiedSince(files []string, maxAge time.Duration) []string {
+	if maxAge == 0 {
+		return files
+	}
+	cutoff := time.Now().Add(-maxAge)
+	var recent []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			recent = append(recent, file)
+		}
+	}
+	return recent
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestParseAge ensures Go durations and whole days are accepted, and other values rejected
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"36h", 36 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1.5d", 0, true},
+		{"d", 0, true},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseAge(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestModifiedSince ensures only files modified within the age are kept, in order
+func TestModifiedSince(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	ages := map[string]time.Duration{"new.go": time.Hour, "week.go": 6 * 24 * time.Hour, "old.go": 30 * 24 * time.Hour}
+	var files []string
+	for _, name := range []string{"old.go", "new.go", "week.go"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-ages[name])
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	missing := filepath.Join(dir, "missing.go")
+	files = append(files, missing)
+
+	tests := []struct {
+		age  string
+		want []string
+	}{
+		{"", []string{"old.go", "new.go", "week.go", "missing.go"}},
+		{"2h", []string{"new.go", "missing.go"}},
+		{"7d", []string{"new.go", "week.go", "missing.go"}},
+		{"31d", []string{"old.go", "new.go", "week.go", "missing.go"}},
+	}
+	for _, tt := range tests {
+		maxAge, err := parseAge(tt.age)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, file := range modifiedSince(files, maxAge) {
+			got = append(got, filepath.Base(file))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("modifiedSince(%q) = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/dmoose/hashfile"
+)
+
+// benchResult is the cost of one benchmarked operation
+type benchResult struct {
+	elapsed time.Duration
+	allocs  uint64
+	bytes   uint64
+}
+
+// measure runs fn and records its duration and heap allocations
+func measure(fn func() error) (benchResult, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return benchResult{
+		elapsed: elapsed,
+		allocs:  after.Mallocs - before.Mallocs,
+		bytes:   after.TotalAlloc - before.TotalAlloc,
+	}, err
+}
+
+// syntheticContent returns size bytes of source-like text, the same for a given seed
+func syntheticContent(size int, seed uint64) []byte {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789 (){}=+-*/;,."
+	rng := rand.New(rand.NewPCG(seed, 0))
+	content := make([]byte, size)
+	for i := range content {
+		if rng.IntN(60) == 0 {
+			content[i] = '\n'
+		} else {
+			content[i] = alphabet[rng.IntN(len(alphabet))]
+		}
+	}
+	if size > 0 {
+		content[size-1] = '\n'
+	}
+	return content
+}
+
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	size := fs.String("size", "100m", "Amount of synthetic content, e.g. 10m or 1g")
+	seed := fs.Uint64("seed", 1, "Seed for the synthetic content")
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	n, err := parseSize(*size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -size: %v\n", err)
+		return 1
+	}
+
+	config := cf.config("")
+	content := syntheticContent(n, *seed)
+	var stamped bytes.Buffer
+	stamped.Grow(n + 256)
+
+	add, err := measure(func() error {
+		_, err := hashfile.NewWriter(config).Process(bytes.NewReader(content), &stamped)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	verify, err := measure(func() error {
+		valid, err := hashfile.NewReader(config).Verify(bytes.NewReader(stamped.Bytes()))
+		if err == nil && !valid {
+			err = fmt.Errorf("synthetic content failed verification")
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Content: %d bytes (seed %d), buffer %d bytes\n", n, *seed, config.BufferSize)
+	for _, r := range []struct {
+		name string
+		benchResult
+	}{{"add", add}, {"verify", verify}} {
+		mbps := float64(n) / (1 << 20) / r.elapsed.Seconds()
+		fmt.Printf("%-7s %9.1f MiB/s  %10v  %6d allocs  %10d bytes allocated\n",
+			r.name+":", mbps, r.elapsed.Round(time.Microsecond), r.allocs, r.bytes)
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dmoose/hashfile"
+)
+
+// errNotListed reports a file that the snapshot fetched for -checksum-url has no digest for.
+var errNotListed = errors.New("not listed in the checksums file")
+
+// verifyChecksum verifies file against its digest in files, as fetched for -checksum-url,
+// instead of against its integrity comment. Files are looked up by their slash-separated path
+// relative to base, or to the current directory if base is empty.
+func verifyChecksum(file, base string, files map[string]string, config hashfile.Config) hashfile.FileResult {
+	result := hashfile.FileResult{Path: file}
+	if base == "" {
+		base = "."
+	}
+	if want, ok := files[filepath.ToSlash(displayPath(file, base))]; !ok {
+		result.Err = errNotListed
+	} else {
+		var crc uint32
+		crc, result.Err = hashfile.NewReader(config).Digest(file)
+		result.Valid = result.Err == nil && strings.EqualFold(fmt.Sprintf("%08X", crc), want)
+	}
+	result.Reason = hashfile.ReasonFor(result.Valid, result.Err)
+	return result
+}
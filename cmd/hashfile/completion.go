@@ -0,0 +1,237 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/dmoose/hashfile"
+)
+
+// completionCommand describes a subcommand for shell completion.
+type completionCommand struct {
+	Name        string
+	Description string
+	Config      bool     // Accepts the shared configuration flags
+	Extra       []string // Command-specific flag names, without the leading dash
+	Flags       []string // All flags, with the leading dash, filled in by completionCommands
+}
+
+// completionCommands returns every subcommand with its complete flag list.
+// Keep the extra flags in sync with the flag sets in the run functions.
+func completionCommands() []completionCommand {
+	commands := []completionCommand{
+		{Name: "add", Description: "Add or update integrity comments", Config: true,
+			Extra: []string{"base", "no-clobber", "verify-after-add", "in-place", "force", "diff", "q", "quiet", "summary-json", "i", "yes", "stdout", "output-dir", "fast", "cache-file", "ext", "verbose"}},
+		{Name: "verify", Description: "Verify file integrity", Config: true,
+			Extra: []string{"base", "q", "quiet", "j", "staged", "content", "summary-json", "sarif", "modified-within", "changed", "0", "checksum-url", "checksum-timeout", "ext", "verbose"}},
+		{Name: "check", Description: "Check and display integrity status", Config: true,
+			Extra: []string{"base", "strict", "details", "q", "quiet", "j", "porcelain", "json", "summary-json", "modified-within", "presence", "ext", "verbose"}},
+		{Name: "remove", Description: "Remove integrity comments", Config: true,
+			Extra: []string{"base", "n", "ext", "verbose"}},
+		{Name: "restyle", Description: "Rewrite integrity comments in another style", Config: true,
+			Extra: []string{"base", "from", "to", "ext", "verbose"}},
+		{Name: "hash", Description: "Print the content digest of files or literal content", Config: true,
+			Extra: []string{"base", "content", "content-file", "comment", "ext", "verbose"}},
+		{Name: "content", Description: "Print the exact bytes hashed for a file", Config: true,
+			Extra: []string{"show-boundaries"}},
+		{Name: "doctor", Description: "Diagnose a file's style, comment, and line endings", Config: true},
+		{Name: "format", Description: "Show the comment format for a style",
+			Extra: []string{"style", "algorithm"}},
+		{Name: "styles", Description: "List the comment styles with their extensions"},
+		{Name: "tree-digest", Description: "Print a digest covering a directory", Config: true,
+			Extra: []string{"hidden"}},
+		{Name: "snapshot", Description: "Print the digests of a directory as JSON", Config: true,
+			Extra: []string{"hidden", "base", "absolute"}},
+		{Name: "verify-snapshot", Description: "Report changes to a directory since a snapshot", Config: true,
+			Extra: []string{"hidden", "q", "quiet"}},
+		{Name: "completion", Description: "Print a shell completion script"},
+		{Name: "bench", Description: "Measure throughput on synthetic content", Config: true,
+			Extra: []string{"size", "seed"}},
+		{Name: "version", Description: "Show version information"},
+		{Name: "help", Description: "Show the help message"},
+	}
+
+	// The shared flags come from the flag set itself so they cannot drift
+	var configFlagNames []string
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	addConfigFlags(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		configFlagNames = append(configFlagNames, f.Name)
+	})
+
+	for i := range commands {
+		names := commands[i].Extra
+		if commands[i].Config {
+			names = slices.Concat(configFlagNames, names)
+		}
+		for _, name := range names {
+			commands[i].Flags = append(commands[i].Flags, "-"+name)
+		}
+	}
+	return commands
+}
+
+var completionTemplates = map[string]string{
+	"bash": `# bash completion for hashfile
+_hashfile() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    # -flag=value is split into "-flag", "=", "value"
+    if [[ $cur == "=" ]]; then
+        cur=""
+    elif [[ $prev == "=" ]]; then
+        prev="${COMP_WORDS[COMP_CWORD-2]}"
+    fi
+
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "{{range $i, $c := .Commands}}{{if $i}} {{end}}{{$c.Name}}{{end}}" -- "$cur"))
+        return
+    fi
+
+    case "$prev" in
+        -style|-from|-to)
+            COMPREPLY=($(compgen -W "{{join .Styles " "}}" -- "$cur"))
+            return
+            ;;
+        -algorithm)
+            COMPREPLY=($(compgen -W "crc32" -- "$cur"))
+            return
+            ;;
+    esac
+
+    local flags=""
+    case "${COMP_WORDS[1]}" in
+{{- range .Commands}}
+        {{.Name}})
+{{- if eq .Name "completion"}}
+            COMPREPLY=($(compgen -W "{{join $.Shells " "}}" -- "$cur"))
+            return
+{{- else}}
+            flags="{{join .Flags " "}}"
+{{- end}}
+            ;;
+{{- end}}
+    esac
+
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+        return
+    fi
+    if [[ ${COMP_WORDS[1]} == "tree-digest" || ${COMP_WORDS[1]} == "snapshot" ]]; then
+        COMPREPLY=($(compgen -d -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -o filenames -F _hashfile hashfile
+`,
+
+	"zsh": `#compdef hashfile
+# zsh completion for hashfile
+_hashfile() {
+    local -a commands styles flags
+    commands=({{range .Commands}}
+        '{{.Name}}:{{.Description}}'{{end}}
+    )
+    styles=({{join .Styles " "}})
+
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+
+    case $words[CURRENT-1] in
+        -style|-from|-to) compadd -a styles; return ;;
+        -algorithm) compadd crc32; return ;;
+    esac
+    if [[ $PREFIX == -style=* ]]; then
+        compset -P '-style='
+        compadd -a styles
+        return
+    fi
+
+    case $words[2] in
+{{- range .Commands}}
+        {{.Name}})
+{{- if eq .Name "completion"}}
+            compadd {{join $.Shells " "}}
+            return
+{{- else}}
+            flags=({{join .Flags " "}})
+{{- end}}
+            ;;
+{{- end}}
+    esac
+
+    if [[ $PREFIX == -* ]]; then
+        compadd -a flags
+    elif [[ $words[2] == (tree-digest|snapshot) ]]; then
+        _files -/
+    else
+        _files
+    fi
+}
+compdef _hashfile hashfile
+`,
+
+	"fish": `# fish completion for hashfile
+complete -c hashfile -f
+{{- range .Commands}}
+complete -c hashfile -n __fish_use_subcommand -a {{.Name}} -d '{{.Description}}'
+{{- end}}
+{{- range .Commands}}
+{{- $name := .Name}}
+{{- range .Flags}}
+{{- if or (eq . "-style") (eq . "-from") (eq . "-to")}}
+complete -c hashfile -n '__fish_seen_subcommand_from {{$name}}' -o {{trimDash .}} -x -a '{{join $.Styles " "}}'
+{{- else if eq . "-algorithm"}}
+complete -c hashfile -n '__fish_seen_subcommand_from {{$name}}' -o algorithm -x -a crc32
+{{- else}}
+complete -c hashfile -n '__fish_seen_subcommand_from {{$name}}' -o {{trimDash .}}
+{{- end}}
+{{- end}}
+{{- end}}
+complete -c hashfile -n '__fish_seen_subcommand_from completion' -a '{{join .Shells " "}}'
+complete -c hashfile -n '__fish_seen_subcommand_from add verify check remove restyle hash' -F
+complete -c hashfile -n '__fish_seen_subcommand_from tree-digest snapshot' -a '(__fish_complete_directories)'
+complete -c hashfile -n '__fish_seen_subcommand_from verify-snapshot' -F
+`,
+}
+
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected one shell (bash, zsh, or fish)\n")
+		return 1
+	}
+
+	text, ok := completionTemplates[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unsupported shell '%s' (supported: bash, zsh, fish)\n", args[0])
+		return 1
+	}
+
+	tmpl := template.Must(template.New(args[0]).Funcs(template.FuncMap{
+		"join":     strings.Join,
+		"trimDash": func(s string) string { return strings.TrimPrefix(s, "-") },
+	}).Parse(text))
+
+	data := struct {
+		Commands []completionCommand
+		Styles   []string
+		Shells   []string
+	}{
+		Commands: completionCommands(),
+		Styles:   hashfile.SupportedStyles(),
+		Shells:   []string{"bash", "zsh", "fish"},
+	}
+	if err := tmpl.Execute(os.Stdout, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dmoose/hashfile"
+)
+
+// confirmChanges counts the files add would modify and asks on stdin whether to go ahead.
+// Without a terminal there is nobody to ask, so it proceeds only if yes is set. Files that
+// cannot be inspected are not counted; the real pass reports them.
+func confirmChanges(files []string, configFor func(string) hashfile.Config, yes bool) (bool, error) {
+	changed := 0
+	for _, file := range files {
+		config := configFor(file)
+		config.Warn = nil
+		result, err := hashfile.NewWriter(config).Inspect(file)
+		if err == nil && result.Changed {
+			changed++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d of %d file(s) would be modified\n", changed, len(files))
+	if changed == 0 || yes {
+		return true, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return false, fmt.Errorf("-i needs a terminal to confirm; pass -yes to proceed without one")
+	}
+	return prompt(os.Stdin, "Continue? [y/N] ")
+}
+
+// prompt asks a yes/no question on stderr, defaulting to no
+func prompt(in io.Reader, question string) (bool, error) {
+	fmt.Fprint(os.Stderr, question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
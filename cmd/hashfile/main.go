@@ -3,10 +3,21 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/dmoose/hashfile"
 )
@@ -23,11 +34,35 @@ func main() {
 
 	switch command {
 	case "add":
-		os.Exit(runAdd(os.Args[2:]))
+		os.Exit(warnings.exitCode(runAdd(os.Args[2:])))
 	case "verify":
-		os.Exit(runVerify(os.Args[2:]))
+		os.Exit(warnings.exitCode(runVerify(os.Args[2:])))
+	case "remove":
+		os.Exit(warnings.exitCode(runRemove(os.Args[2:])))
 	case "check":
-		os.Exit(runCheck(os.Args[2:]))
+		os.Exit(warnings.exitCode(runCheck(os.Args[2:])))
+	case "restyle":
+		os.Exit(warnings.exitCode(runRestyle(os.Args[2:])))
+	case "hash":
+		os.Exit(warnings.exitCode(runHash(os.Args[2:])))
+	case "content":
+		os.Exit(warnings.exitCode(runContent(os.Args[2:])))
+	case "doctor":
+		os.Exit(warnings.exitCode(runDoctor(os.Args[2:])))
+	case "format":
+		os.Exit(runFormat(os.Args[2:]))
+	case "styles", "--list-styles":
+		os.Exit(runStyles(os.Args[2:]))
+	case "tree-digest":
+		os.Exit(warnings.exitCode(runTreeDigest(os.Args[2:])))
+	case "snapshot":
+		os.Exit(warnings.exitCode(runSnapshot(os.Args[2:])))
+	case "verify-snapshot":
+		os.Exit(warnings.exitCode(runVerifySnapshot(os.Args[2:])))
+	case "completion":
+		os.Exit(runCompletion(os.Args[2:]))
+	case "bench":
+		os.Exit(warnings.exitCode(runBench(os.Args[2:])))
 	case "version":
 		fmt.Printf("hashfile version %s\n", version)
 		os.Exit(0)
@@ -45,43 +80,312 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, `hashfile - File integrity verification tool
 
 USAGE:
-    hashfile <command> [options] <file>...
+    hashfile <command> [options] <file|dir>...
 
 COMMANDS:
     add        Add or update integrity comments in files
     verify     Verify file integrity (exit 0 if valid, 1 if invalid)
     check      Check and display integrity status (human-readable)
+    remove     Remove integrity comments from files
+    restyle    Rewrite integrity comments in another style, keeping the hash
+    hash       Print the content digest of files or literal content
+    content    Print the exact bytes hashed for a file, to debug mismatches
+    doctor     Diagnose a file: its style, comment, line endings, BOM, and
+               whether it verifies
+    format     Show the comment format and parse pattern for a style
+    styles     List the comment styles with their extensions
+    tree-digest
+               Print a single digest covering every file under a directory
+    snapshot   Print the content digest of every file under a directory as
+               JSON, for verify-snapshot
+    verify-snapshot
+               Report files added, removed, or changed under a directory
+               since a snapshot was taken; without a directory, check the
+               files the snapshot lists, relative to the snapshot file
+    completion Print a shell completion script (bash|zsh|fish)
+    bench      Measure add and verify throughput on synthetic content
     version    Show version information
     help       Show this help message
 
 OPTIONS:
-    -style     Comment style (go|python|c|sql|html|shell|ruby|js|css|templ)
+    -style     Comment style (go|python|c|sql|html|shell|ruby|js|css|templ|matlab|mermaid|d2|fortran|f77|cobol)
                Default: auto-detect from file extension
+    -normalize-go
+               Hash gofmt-normalized content for .go files, so reformatting
+               does not invalidate the integrity comment
+    -key       Key labelling the checksum (default FileIntegrity)
+    -accept-keys KEYS
+               Comma-separated keys also accepted on read, e.g. the old key
+               during a migration; add rewrites them with -key
+    -preserve-modeline
+               Write the comment before a trailing vim/emacs modeline
+    -blank-line
+               Separate the comment from the content with a blank line
+    -generated-marker LINE
+               Write LINE, e.g. "// Code generated by gen. DO NOT EDIT.",
+               once just before the comment; it is not hashed
+    -no-final-newline
+               End the file with the comment, without a trailing line ending
+    -lowercase Write the digest in lowercase hexadecimal; either case verifies
+    -format-version N
+               Comment format to write: 0 for legacy, 1 for a "v1:" token
+               before the digest; both verify
+    -parallel-hash
+               Hash large files on multiple goroutines
+    -buffer SIZE
+               Streaming buffer size, e.g. 16k or 4m (default 64k)
+    -max-hash-bytes N
+               Hash only the first N bytes of content; later changes are
+               not detected. Verification uses the N recorded in the comment
+    -head-tail-bytes N
+               Hash only the first and last N bytes of content, catching
+               truncation and damage at either end but not changes in
+               between. Verification uses the N recorded in the comment
+    -max-file-size SIZE
+               Refuse files larger than SIZE, e.g. 100m (default unlimited)
+    -script-mode
+               Write the comment on line 2 of scripts that start with a
+               shebang (#-comment styles only)
+    -ignore-lines REGEX
+               Exclude lines matching REGEX from the hash, e.g. build stamps
+    -ignore-markers
+               Exclude regions between hashfile:ignore-start and
+               hashfile:ignore-end comment lines from the hash, markers
+               included; an unclosed region is hashed
+    -retry N   Retry files that fail with a transient I/O error (EAGAIN,
+               ETIMEDOUT), e.g. on NFS, up to N times with backoff
+    -retry-on-change N
+               Verify a file again, up to N times, if its size or modification
+               time changed while it was read (verify, check)
+    -namespace NAME
+               Hash NAME ahead of the content, so stamps only verify with the
+               same -namespace
+    -no-follow Refuse symbolic links, write temporary files readable only by
+               the owner, and fail if a file is swapped during a rewrite
+    -include-perm-bits
+               Include each file's permission bits in the hash, so e.g.
+               chmod +x invalidates it; the same flag must be used to verify
+    -temp-dir DIR
+               Create temporary files for rewrites in DIR instead of each
+               file's directory; falls back to a non-atomic overwrite if DIR
+               is on another filesystem
+    -temp-prefix PREFIX
+               Name temporary files PREFIX*.tmp instead of .hashfile_*.tmp;
+               files named like them are refused
+    -sidecar-dir DIR
+               Keep each file's digest in <file>.integrity under DIR ("." for
+               next to the file) instead of in the file, for read-only or
+               binary files; remove deletes the sidecar (add, verify, check,
+               remove)
+    -read-only Never write, not even a temporary file: add fails on files
+               that would change, so it can audit read-only trees
+    -Werror    Exit 1 if any warning was reported, e.g. a comment of another
+               style was replaced, even if every file succeeded
+    -base      Report paths relative to this directory (add, verify, check);
+               record paths relative to it instead of the root, so the
+               snapshot can be moved with the files (snapshot)
+    -absolute  Record absolute paths (snapshot)
+    -staged    Verify the version staged in the git index, for pre-commit
+               hooks (verify)
+    -content TEXT
+               Verify or hash TEXT instead of files; the style defaults to go
+               (verify, hash)
+    -content-file PATH
+               Hash the content of PATH, or standard input for "-", as
+               literal content (hash)
+    -show-boundaries
+               Also report on stderr where the content and the comment lie
+               in the file (content)
+    -comment   Print the integrity comment add would write instead of the
+               bare digest (hash)
+    -j N       Verify N files concurrently, 0 for one per CPU; output keeps
+               the input order (verify, check)
+    -q, -quiet Suppress success output; add and check still report failures
+               (add, verify, check)
+    -strict    Report malformed integrity comments separately (check)
+    -porcelain Print "REASON<TAB>path" per file; reasons are OK, MISMATCH,
+               NO_COMMENT, BAD_FORMAT, TRAILING_DATA, TOO_LARGE,
+               READ_ERROR (check)
+    -json      Print results as a JSON array with reason codes (check)
+    -summary-json
+               Print only one aggregate JSON object with counts and the
+               duration to stdout (add, verify, check)
+    -sarif FILE
+               Write a SARIF 2.1.0 report with one result per failed file,
+               e.g. for code-scanning dashboards (verify)
+    -changed   Print only the paths of files whose content no longer matches
+               their comment to stdout, one per line, for scripts; errors
+               such as missing comments still go to stderr (verify)
+    -0         Terminate -changed paths with NUL, for xargs -0 (verify)
+    -checksum-url URL
+               Fetch a snapshot JSON file, as written by snapshot, and verify
+               files against its digests instead of their comments; paths are
+               looked up relative to -base or the current directory (verify)
+    -checksum-timeout DURATION
+               Give up fetching -checksum-url after this long, default 30s
+               (verify)
+    -ext EXT   In directories given as arguments, only process files with
+               these extensions, e.g. go,py,sql; repeatable. By default every
+               extension with a known comment style is processed (add,
+               verify, check, remove, restyle, hash)
+    -verbose   Report on stderr how many file arguments were duplicates, e.g.
+               from overlapping globs, and how many files in directories were
+               skipped for their extension (add, verify, check, remove,
+               restyle, hash)
+    -modified-within AGE
+               Only verify files modified within AGE, e.g. 36h or 7d
+               (verify, check)
+    -presence  Only check that each file has an integrity comment, without
+               hashing it; much faster for coverage gates (check)
+    -details   Show stored and computed CRCs and lengths for failed files (check)
+    -verify-after-add
+               Re-verify each file after writing it (add)
+    -force     Rewrite files even when the comment is correct, e.g. to migrate
+               the key or format; updates modification times (add)
+    -i         Report how many files would be modified and ask for
+               confirmation first; without a terminal, -yes is required (add)
+    -yes       Proceed without asking under -i (add)
+    -stdout    Write the content of a single file with its comment added or
+               updated to stdout, leaving the file untouched (add)
+    -output-dir DIR
+               Write stamped copies under DIR at each file's path relative to
+               -base or the working directory, leaving the files untouched (add)
+    -diff      Print a unified diff of the changes without writing them (add)
+    -fast      Skip files whose size and modification time are unchanged since
+               they were last stamped, without opening them; misses edits that
+               keep both, so run without it to be sure (add)
+    -cache-file FILE
+               Where -fast records stamped files (add, default
+               .hashfile-cache.json)
+    -in-place  Append comments to files that have none directly, without an
+               atomic rewrite through a temporary file (add)
+    -no-clobber
+               Refuse to stamp files with an integrity-like line that is not
+               the last line, instead of appending a new comment (add)
+    -from STYLE
+               Style of the existing comments; default: auto-detect from
+               file extension (restyle)
+    -to STYLE  Style to rewrite the comments in; required (restyle)
+    -size SIZE Amount of synthetic content, e.g. 10m (bench, default 100m)
+    -seed N    Seed for the synthetic content (bench, default 1)
 
 EXAMPLES:
     # Add integrity comments to Go files
     hashfile add main.go handler.go
 
+    # Re-stamp a large tree, skipping files untouched since the last run
+    hashfile add -fast ./src
+
     # Verify files (silent, use exit code)
     hashfile verify *.go
 
+    # Act on files edited since they were stamped
+    hashfile verify -changed -0 ./gen | xargs -0 git checkout --
+
+    # Verify staged content in a git pre-commit hook
+    hashfile verify -staged $(git diff --cached --name-only --diff-filter=ACM -- '*.go')
+
     # Check files with human-readable output
     hashfile check src/*.py
 
     # Use specific comment style
     hashfile add -style=python script.txt
 
+    # List files that still carry integrity comments, without changing them
+    hashfile remove -n src/*.go
+
+    # Convert line comments to block comments without re-hashing
+    hashfile restyle -from=go -to=cblock src/*.go
+
+    # Show the comment a Python snippet would get
+    hashfile hash -style=python -comment -content 'print("hi")'
+
+    # Find out why a file does not verify
+    hashfile doctor handler.py
+
+    # See exactly which bytes are hashed, e.g. to spot trailing whitespace
+    hashfile content -show-boundaries main.go | od -c
+
+    # Print an aggregate digest for a source tree
+    hashfile tree-digest ./src
+
+    # Capture a release tree, and later list what changed since
+    hashfile snapshot ./dist > snap.json
+    hashfile verify-snapshot snap.json ./dist
+
+    # Record paths relative to the snapshot, so both can be moved together
+    hashfile snapshot -base . ./dist > snap.json
+    hashfile verify-snapshot snap.json
+
+    # Verify downloaded files against the snapshot published with a release
+    hashfile verify -checksum-url=https://example.com/v1.2/snap.json -base dist ./dist
+
+    # Compare throughput of buffer sizes on this machine
+    hashfile bench -size=500m -buffer=1m
+
+    # Find the style used for an extension
+    hashfile styles | grep '\.scss'
+
+    # Show how HTML integrity comments are written and parsed
+    hashfile format -style=html
+
+    # Enable bash completion for the current shell
+    source <(hashfile completion bash)
+
 EXIT CODES:
     0    Success (all files valid for verify, all operations succeeded)
-    1    Failure (invalid files found or errors occurred)
+    1    Failure (invalid files found or errors occurred, or warnings
+         reported under -Werror)
 
 `)
 }
 
 func runAdd(args []string) int {
 	fs := flag.NewFlagSet("add", flag.ExitOnError)
-	style := fs.String("style", "", "Comment style (go|python|c|sql|html|shell|ruby|js|css|templ)")
+	cf := addConfigFlags(fs)
+	base := fs.String("base", "", "Report paths relative to this directory")
+	noClobber := fs.Bool("no-clobber", false, "Refuse files with an integrity-like line that is not the last line")
+	verifyAfter := fs.Bool("verify-after-add", false, "Re-verify each file after writing it")
+	inPlace := fs.Bool("in-place", false, "Append new comments directly instead of rewriting via a temp file")
+	force := fs.Bool("force", false, "Rewrite files even if their comment is already correct")
+	diff := fs.Bool("diff", false, "Print a unified diff of the changes instead of writing them")
+	quiet := fs.Bool("q", false, "Quiet mode (only errors and exit code)")
+	fs.BoolVar(quiet, "quiet", false, "Alias for -q")
+	summaryJSON := fs.Bool("summary-json", false, "Print only an aggregate JSON summary to stdout")
+	interactive := fs.Bool("i", false, "Report how many files would change and ask before modifying them")
+	yes := fs.Bool("yes", false, "Proceed without asking under -i, e.g. when stdin is not a terminal")
+	stdout := fs.Bool("stdout", false, "Write the stamped content of one file to stdout, leaving the file untouched")
+	outputDir := fs.String("output-dir", "", "Write stamped copies under this directory, keeping relative paths, instead of modifying files")
+	fast := fs.Bool("fast", false, "Skip files whose size and modification time are unchanged since they were last stamped")
+	cacheFile := fs.String("cache-file", ".hashfile-cache.json", "File recording stamped files for -fast")
+	ef := addExpandFlags(fs)
 	fs.Parse(args)
+	warnings.quiet = *quiet
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *diff && *summaryJSON {
+		fmt.Fprintf(os.Stderr, "Error: -diff and -summary-json cannot be combined\n")
+		return 1
+	}
+	if *interactive && *diff {
+		fmt.Fprintf(os.Stderr, "Error: -i and -diff cannot be combined\n")
+		return 1
+	}
+	if *stdout && (*diff || *interactive || *summaryJSON || *verifyAfter || *inPlace) {
+		fmt.Fprintf(os.Stderr, "Error: -stdout cannot be combined with -diff, -i, -summary-json, -verify-after-add, or -in-place\n")
+		return 1
+	}
+	if *outputDir != "" && (*stdout || *diff || *interactive || *inPlace) {
+		fmt.Fprintf(os.Stderr, "Error: -output-dir cannot be combined with -stdout, -diff, -i, or -in-place\n")
+		return 1
+	}
+	if *fast && (*stdout || *diff || *outputDir != "" || *force) {
+		fmt.Fprintf(os.Stderr, "Error: -fast cannot be combined with -stdout, -diff, -output-dir, or -force\n")
+		return 1
+	}
 
 	files := fs.Args()
 	if len(files) == 0 {
@@ -90,46 +394,208 @@ func runAdd(args []string) int {
 	}
 
 	// Collect all files (expand globs if needed)
-	allFiles, err := expandFiles(files)
+	allFiles, err := ef.expand(files)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
 
+	var cache *hashfile.StampCache
+	if *fast {
+		if cache, err = hashfile.LoadStampCache(*cacheFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	configFor := func(file string) hashfile.Config {
+		config := cf.config(file)
+		config.NoClobber = *noClobber
+		config.InPlace = *inPlace
+		config.Force = *force
+		config.StampCache = cache
+		return config
+	}
+
+	// One file listed under paths that pick different styles would flip between them
+	conflicts := hashfile.StyleConflicts(allFiles, configFor)
+	for _, file := range allFiles {
+		if msg := conflicts[file]; msg != "" {
+			warnings.warn(displayPath(file, *base), msg)
+		}
+	}
+
+	if *stdout {
+		if len(allFiles) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: -stdout takes exactly one file, got %d\n", len(allFiles))
+			return 1
+		}
+		if err := processToStdout(allFiles[0], configFor(allFiles[0])); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", displayPath(allFiles[0], *base), err)
+			return 1
+		}
+		return 0
+	}
+
+	// Every copy needs its own destination, decided before anything is written
+	var outputs map[string]string
+	if *outputDir != "" {
+		if outputs, err = outputPaths(allFiles, *base, *outputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	if *interactive {
+		ok, err := confirmChanges(allFiles, configFor, *yes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Aborted, no files modified\n")
+			return 1
+		}
+	}
+
 	var errors []string
 	successCount := 0
+	stats := newSummary(false)
 
 	for _, file := range allFiles {
-		config := getConfig(file, *style)
+		config := configFor(file)
 		writer := hashfile.NewWriter(config)
 
-		if err := writer.ProcessFile(file); err != nil {
-			errors = append(errors, fmt.Sprintf("%s: %v", file, err))
-		} else {
+		if *diff {
+			d, err := writer.Diff(file)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %v", displayPath(file, *base), err))
+				continue
+			}
+			printDiff(displayPath(file, *base), d)
 			successCount++
+			continue
+		}
+
+		var err error
+		written := file
+		if *outputDir != "" {
+			written = outputs[file]
+			_, err = writer.ProcessFileTo(file, written)
+		} else {
+			err = writer.ProcessFile(file)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", displayPath(file, *base), err))
+			stats.record(hashfile.ReasonFor(false, err))
+			continue
+		}
+
+		if *verifyAfter {
+			valid, err := hashfile.NewReader(config).VerifyFile(written)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("%s: verification after add failed: %v", displayPath(file, *base), err))
+				stats.record(hashfile.ReasonFor(valid, err))
+				continue
+			}
+			if !valid {
+				errors = append(errors, fmt.Sprintf("%s: verification after add failed: integrity check failed", displayPath(file, *base)))
+				stats.record(hashfile.ReasonMismatch)
+				continue
+			}
+		}
+		successCount++
+		stats.record(hashfile.ReasonOK)
+	}
+
+	// Files stamped in this run are still recorded if others failed
+	if cache != nil {
+		if err := cache.Save(*cacheFile); err != nil {
+			errors = append(errors, err.Error())
 		}
 	}
 
 	// Report results
+	if *summaryJSON {
+		if err := stats.print(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
 	if len(errors) > 0 {
 		for _, err := range errors {
 			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		}
-		fmt.Fprintf(os.Stderr, "\nProcessed %d files successfully, %d failed\n", successCount, len(errors))
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "\nProcessed %d files successfully, %d failed\n", successCount, len(errors))
+		}
 		return 1
 	}
 
-	fmt.Printf("Successfully processed %d file(s)\n", successCount)
+	if !*quiet && !*diff && !*summaryJSON {
+		fmt.Printf("Successfully processed %d file(s)\n", successCount)
+	}
 	return 0
 }
 
 func runVerify(args []string) int {
 	fs := flag.NewFlagSet("verify", flag.ExitOnError)
-	style := fs.String("style", "", "Comment style (go|python|c|sql|html|shell|ruby|js|css|templ)")
+	cf := addConfigFlags(fs)
+	base := fs.String("base", "", "Report paths relative to this directory")
 	quiet := fs.Bool("q", false, "Quiet mode (no output, only exit code)")
+	fs.BoolVar(quiet, "quiet", false, "Alias for -q")
+	jobs := fs.Int("j", 1, "Number of files to verify concurrently (0 = one per CPU)")
+	staged := fs.Bool("staged", false, "Verify the content staged in the git index instead of the working tree")
+	content := fs.String("content", "", "Verify this literal content instead of files")
+	summaryJSON := fs.Bool("summary-json", false, "Print only an aggregate JSON summary to stdout")
+	sarifFile := fs.String("sarif", "", "Write a SARIF 2.1.0 report of failed files to this file")
+	modifiedWithin := fs.String("modified-within", "", "Only verify files modified within this duration, e.g. 36h or 7d")
+	changed := fs.Bool("changed", false, "Print only the paths of files that no longer match their comment, one per line")
+	nul := fs.Bool("0", false, "Terminate -changed paths with NUL instead of newline")
+	checksumURL := fs.String("checksum-url", "", "Verify files against the digests in a snapshot fetched from this URL")
+	checksumTimeout := fs.Duration("checksum-timeout", hashfile.DefaultFetchTimeout, "Give up fetching -checksum-url after this long")
+	ef := addExpandFlags(fs)
 	fs.Parse(args)
+	warnings.quiet = *quiet
+
+	if err := cf.validate(); err != nil {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return 1
+	}
+	if *nul && !*changed {
+		fmt.Fprintf(os.Stderr, "Error: -0 requires -changed\n")
+		return 1
+	}
+	if *changed && (*quiet || *summaryJSON || *content != "") {
+		fmt.Fprintf(os.Stderr, "Error: -changed cannot be combined with -q, -summary-json, or -content\n")
+		return 1
+	}
+	if *checksumURL != "" && (*staged || *content != "") {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "Error: -checksum-url cannot be combined with -staged or -content\n")
+		}
+		return 1
+	}
+	maxAge, err := parseAge(*modifiedWithin)
+	if err != nil {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "Error: invalid -modified-within: %v\n", err)
+		}
+		return 1
+	}
 
 	files := fs.Args()
+	if *content != "" {
+		if len(files) > 0 || *summaryJSON || *sarifFile != "" {
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "Error: -content cannot be combined with files, -summary-json, or -sarif\n")
+			}
+			return 1
+		}
+		return verifyContent(*content, cf.config(""), *quiet)
+	}
 	if len(files) == 0 {
 		if !*quiet {
 			fmt.Fprintf(os.Stderr, "Error: no files specified\n")
@@ -138,31 +604,84 @@ func runVerify(args []string) int {
 	}
 
 	// Expand files
-	allFiles, err := expandFiles(files)
+	allFiles, err := ef.expand(files)
 	if err != nil {
 		if !*quiet {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
 		return 1
 	}
+	allFiles = modifiedSince(allFiles, maxAge)
+
+	var checksums map[string]string
+	if *checksumURL != "" {
+		checksums, err = hashfile.FetchSnapshot(&http.Client{Timeout: *checksumTimeout}, *checksumURL)
+		if err != nil {
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			return 1
+		}
+	}
 
 	var errors []string
 	var invalid []string
 	validCount := 0
+	stats := newSummary(true)
+	sarif := newSARIF()
 
-	for _, file := range allFiles {
-		config := getConfig(file, *style)
-		reader := hashfile.NewReader(config)
-
-		valid, err := reader.VerifyFile(file)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("%s: %v", file, err))
-		} else if !valid {
-			invalid = append(invalid, file)
+	configFor := func(file string) hashfile.Config {
+		return cf.config(file)
+	}
+	report := func(r hashfile.FileResult) {
+		if r.Warning != "" {
+			warnings.warn(displayPath(r.Path, *base), r.Warning)
+		}
+		stats.record(r.Reason)
+		sarif.record(r, displayPath(r.Path, *base))
+		if r.Err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", displayPath(r.Path, *base), r.Err))
+		} else if !r.Valid {
+			invalid = append(invalid, displayPath(r.Path, *base))
+			if *changed {
+				printChanged(displayPath(r.Path, *base), *nul)
+			}
 		} else {
 			validCount++
 		}
 	}
+	if *staged {
+		if err := checkGitRepo(); err != nil {
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			return 1
+		}
+		for _, file := range allFiles {
+			report(verifyStaged(file, configFor(file)))
+		}
+	} else if checksums != nil {
+		for _, file := range allFiles {
+			report(verifyChecksum(file, *base, checksums, configFor(file)))
+		}
+	} else {
+		hashfile.VerifyFiles(allFiles, configFor, *jobs, report)
+	}
+
+	if *summaryJSON {
+		if err := stats.print(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if *sarifFile != "" {
+		if err := sarif.write(*sarifFile); err != nil {
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			return 1
+		}
+	}
 
 	// Report results in quiet mode or verbose mode
 	if !*quiet {
@@ -171,7 +690,7 @@ func runVerify(args []string) int {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 			}
 		}
-		if len(invalid) > 0 {
+		if len(invalid) > 0 && !*changed {
 			for _, file := range invalid {
 				fmt.Fprintf(os.Stderr, "Invalid: %s\n", file)
 			}
@@ -179,23 +698,92 @@ func runVerify(args []string) int {
 	}
 
 	if len(errors) > 0 || len(invalid) > 0 {
-		if !*quiet {
+		if !*quiet && !*changed {
 			fmt.Fprintf(os.Stderr, "\nVerified %d files: %d valid, %d invalid, %d errors\n",
 				len(allFiles), validCount, len(invalid), len(errors))
 		}
 		return 1
 	}
 
-	if !*quiet {
+	if !*quiet && !*summaryJSON && !*changed {
 		fmt.Printf("All %d file(s) verified successfully\n", validCount)
 	}
 	return 0
 }
 
+// printChanged writes path to stdout for verify -changed, terminated by NUL under -0 so that
+// any file name can be read back, e.g. by xargs -0
+func printChanged(path string, nul bool) {
+	if nul {
+		fmt.Printf("%s\x00", path)
+	} else {
+		fmt.Println(path)
+	}
+}
+
+// verifyContent verifies literal content given on the command line
+func verifyContent(content string, config hashfile.Config, quiet bool) int {
+	valid, err := hashfile.NewReader(config).Verify(strings.NewReader(content))
+	if quiet {
+		if err != nil || !valid {
+			return 1
+		}
+		return 0
+	}
+
+	switch {
+	case errors.Is(err, hashfile.ErrNoComment):
+		fmt.Fprintf(os.Stderr, "Unhashed: content has no integrity comment\n")
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	case !valid:
+		fmt.Fprintf(os.Stderr, "Invalid: content does not match its integrity comment\n")
+	default:
+		fmt.Println("Content verified successfully")
+		return 0
+	}
+	return 1
+}
+
 func runCheck(args []string) int {
 	fs := flag.NewFlagSet("check", flag.ExitOnError)
-	style := fs.String("style", "", "Comment style (go|python|c|sql|html|shell|ruby|js|css|templ)")
+	cf := addConfigFlags(fs)
+	base := fs.String("base", "", "Report paths relative to this directory")
+	strict := fs.Bool("strict", false, "Report malformed integrity comments as format errors")
+	details := fs.Bool("details", false, "Show stored and computed CRCs and lengths for failed files")
+	quiet := fs.Bool("q", false, "Quiet mode (only failed files and exit code)")
+	fs.BoolVar(quiet, "quiet", false, "Alias for -q")
+	jobs := fs.Int("j", 1, "Number of files to check concurrently (0 = one per CPU)")
+	porcelain := fs.Bool("porcelain", false, "Print a reason code and path per file, tab separated")
+	jsonOut := fs.Bool("json", false, "Print results as a JSON array")
+	summaryJSON := fs.Bool("summary-json", false, "Print only an aggregate JSON summary to stdout")
+	modifiedWithin := fs.String("modified-within", "", "Only check files modified within this duration, e.g. 36h or 7d")
+	presence := fs.Bool("presence", false, "Only check that each file has an integrity comment, not that it is correct")
+	ef := addExpandFlags(fs)
 	fs.Parse(args)
+	warnings.quiet = *quiet
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *presence && (*jsonOut || *details || *strict) {
+		fmt.Fprintf(os.Stderr, "Error: -presence cannot be combined with -json, -details, or -strict\n")
+		return 1
+	}
+	maxAge, err := parseAge(*modifiedWithin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -modified-within: %v\n", err)
+		return 1
+	}
+	if *porcelain && *jsonOut {
+		fmt.Fprintf(os.Stderr, "Error: -porcelain and -json cannot be combined\n")
+		return 1
+	}
+	if *summaryJSON && (*porcelain || *jsonOut) {
+		fmt.Fprintf(os.Stderr, "Error: -summary-json cannot be combined with -porcelain or -json\n")
+		return 1
+	}
 
 	files := fs.Args()
 	if len(files) == 0 {
@@ -204,36 +792,97 @@ func runCheck(args []string) int {
 	}
 
 	// Expand files
-	allFiles, err := expandFiles(files)
+	allFiles, err := ef.expand(files)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
+	allFiles = modifiedSince(allFiles, maxAge)
+
+	if *presence {
+		return checkPresence(allFiles, cf, *base, *quiet, *porcelain, *summaryJSON)
+	}
 
 	validCount := 0
 	invalidCount := 0
 	errorCount := 0
+	entries := []checkEntry{}
+	stats := newSummary(true)
 
-	for _, file := range allFiles {
-		config := getConfig(file, *style)
-		reader := hashfile.NewReader(config)
+	configFor := func(file string) hashfile.Config {
+		config := cf.config(file)
+		config.StrictFormat = *strict
+		return config
+	}
+	hashfile.VerifyFiles(allFiles, configFor, *jobs, func(r hashfile.FileResult) {
+		name := displayPath(r.Path, *base)
+		result, err := r.VerifyResult, r.Err
 
-		valid, err := reader.VerifyFile(file)
-		if err != nil {
-			fmt.Printf("✗ %s (error: %v)\n", file, err)
-			errorCount++
-		} else if valid {
-			fmt.Printf("✓ %s\n", file)
+		switch r.Reason {
+		case hashfile.ReasonOK:
 			validCount++
-		} else {
-			fmt.Printf("✗ %s (integrity check failed)\n", file)
+		case hashfile.ReasonMismatch:
 			invalidCount++
+		default:
+			errorCount++
+		}
+		stats.record(r.Reason)
+
+		if *summaryJSON {
+			return
+		}
+		if *jsonOut {
+			entries = append(entries, newCheckEntry(name, r))
+			return
+		}
+		if *porcelain {
+			if !*quiet || r.Reason != hashfile.ReasonOK {
+				fmt.Printf("%s\t%s\n", r.Reason, name)
+			}
+			return
+		}
+
+		var formatErr *hashfile.FormatError
+		if errors.As(err, &formatErr) {
+			fmt.Printf("✗ %s (%v)\n", name, formatErr)
+		} else if errors.Is(err, hashfile.ErrNoComment) {
+			fmt.Printf("✗ %s (no integrity comment)\n", name)
+		} else if err != nil {
+			fmt.Printf("✗ %s (error: %v)\n", name, err)
+		} else if result.Valid {
+			if !*quiet {
+				fmt.Printf("✓ %s\n", name)
+			}
+		} else {
+			fmt.Printf("✗ %s (integrity check failed)\n", name)
+			if *details {
+				fmt.Printf("    stored %08X, computed %08X, %d of %d bytes hashed\n",
+					result.StoredCRC, result.ComputedCRC, result.ContentLen, result.FileSize)
+			}
+		}
+	})
+
+	if *jsonOut {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	if *summaryJSON {
+		if err := stats.print(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
 		}
 	}
 
 	// Summary
-	fmt.Printf("\nTotal: %d files, %d valid, %d invalid, %d errors\n",
-		len(allFiles), validCount, invalidCount, errorCount)
+	if !*quiet && !*porcelain && !*jsonOut && !*summaryJSON {
+		fmt.Printf("\nTotal: %d files, %d valid, %d invalid, %d errors\n",
+			len(allFiles), validCount, invalidCount, errorCount)
+	}
 
 	if invalidCount > 0 || errorCount > 0 {
 		return 1
@@ -241,92 +890,1021 @@ func runCheck(args []string) int {
 	return 0
 }
 
-// getConfig returns configuration based on file extension or explicit style
-func getConfig(filename, styleFlag string) hashfile.Config {
-	if styleFlag != "" {
-		return getConfigForStyle(styleFlag)
-	}
-	ext := filepath.Ext(filename)
-	return hashfile.ConfigForExtension(ext)
-}
-
-// getConfigForStyle returns configuration for the specified style
-func getConfigForStyle(style string) hashfile.Config {
-	config := hashfile.DefaultConfig()
-
-	switch style {
-	case "go":
-		config.CommentStyle = hashfile.GoStyle
-	case "python", "py":
-		config.CommentStyle = hashfile.PythonStyle
-	case "c", "cpp", "java", "js", "javascript":
-		config.CommentStyle = hashfile.CStyle
-	case "sql":
-		config.CommentStyle = hashfile.SQLStyle
-	case "html", "xml":
-		config.CommentStyle = hashfile.HTMLStyle
-	case "shell", "sh", "bash":
-		config.CommentStyle = hashfile.ShellStyle
-	case "ruby", "rb":
-		config.CommentStyle = hashfile.RubyStyle
-	case "css":
-		config.CommentStyle = hashfile.CSSStyle
-	case "templ":
-		config.CommentStyle = hashfile.TemplStyle
-	default:
-		fmt.Fprintf(os.Stderr, "Warning: unknown style '%s', using default (Go)\n", style)
+func runRemove(args []string) int {
+	fs := flag.NewFlagSet("remove", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	base := fs.String("base", "", "Report paths relative to this directory")
+	dryRun := fs.Bool("n", false, "Dry run: report files with comments without modifying them")
+	ef := addExpandFlags(fs)
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
 	}
 
-	return config
-}
+	files := fs.Args()
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no files specified\n")
+		return 1
+	}
+
+	allFiles, err := ef.expand(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var failed []string
+	removedCount := 0
 
-// expandFiles expands file patterns and returns a list of files
-func expandFiles(patterns []string) ([]string, error) {
-	var files []string
-	seen := make(map[string]bool)
+	for _, file := range allFiles {
+		config := cf.config(file)
+		name := displayPath(file, *base)
 
-	for _, pattern := range patterns {
-		// Check if it's a plain file (no wildcards)
-		if !containsWildcard(pattern) {
-			if !seen[pattern] {
-				files = append(files, pattern)
-				seen[pattern] = true
+		if *dryRun {
+			// Look for the comment the way RemoveComment does, whether or not it verifies
+			found, err := hashfile.NewReader(config).HasComment(file)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			if !found {
+				continue
 			}
+			fmt.Printf("would remove: %s\n", name)
+			removedCount++
 			continue
 		}
 
-		// Expand glob pattern
-		matches, err := filepath.Glob(pattern)
+		removed, err := hashfile.NewWriter(config).RemoveComment(file)
 		if err != nil {
-			return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		} else if removed {
+			removedCount++
 		}
+	}
 
-		for _, match := range matches {
-			// Only include regular files
-			info, err := os.Stat(match)
-			if err != nil {
-				continue
-			}
-			if info.IsDir() {
-				continue
-			}
+	for _, err := range failed {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
 
-			if !seen[match] {
-				files = append(files, match)
-				seen[match] = true
-			}
+	if *dryRun {
+		fmt.Printf("\n%d of %d file(s) have integrity comments\n", removedCount, len(allFiles))
+		if removedCount > 0 || len(failed) > 0 {
+			return 1
 		}
+		return 0
 	}
 
-	return files, nil
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "\nRemoved %d comment(s), %d failed\n", removedCount, len(failed))
+		return 1
+	}
+
+	fmt.Printf("Removed integrity comments from %d file(s)\n", removedCount)
+	return 0
+}
+
+func runRestyle(args []string) int {
+	fs := flag.NewFlagSet("restyle", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	base := fs.String("base", "", "Report paths relative to this directory")
+	from := fs.String("from", "", "Style of the existing comments (default: from file extension)")
+	to := fs.String("to", "", "Style to rewrite the comments in")
+	ef := addExpandFlags(fs)
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if cf.style != "" {
+		fmt.Fprintf(os.Stderr, "Error: restyle takes -from and -to instead of -style\n")
+		return 1
+	}
+	if *to == "" {
+		fmt.Fprintf(os.Stderr, "Error: -to is required\n")
+		return 1
+	}
+	target, err := hashfile.ConfigForStyleName(*to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var source hashfile.Config
+	if *from != "" {
+		if source, err = hashfile.ConfigForStyleName(*from); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no files specified\n")
+		return 1
+	}
+
+	allFiles, err := ef.expand(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var failed []string
+	changedCount := 0
+
+	for _, file := range allFiles {
+		fromConfig := cf.config(file)
+		if *from != "" {
+			fromConfig.CommentStyle = source.CommentStyle
+		}
+		toConfig := cf.config(file)
+		toConfig.CommentStyle = target.CommentStyle
+		name := displayPath(file, *base)
+
+		changed, err := hashfile.NewWriter(toConfig).Restyle(file, fromConfig)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		} else if changed {
+			changedCount++
+		}
+	}
+
+	for _, err := range failed {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "\nRestyled %d comment(s), %d failed\n", changedCount, len(failed))
+		return 1
+	}
+
+	fmt.Printf("Restyled integrity comments in %d file(s)\n", changedCount)
+	return 0
+}
+
+func runHash(args []string) int {
+	fs := flag.NewFlagSet("hash", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	base := fs.String("base", "", "Report paths relative to this directory")
+	content := fs.String("content", "", "Hash this literal content instead of files")
+	contentFile := fs.String("content-file", "", "Hash the content of this file, or - for stdin, as literal content")
+	comment := fs.Bool("comment", false, "Print the integrity comment instead of the bare digest")
+	ef := addExpandFlags(fs)
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	files := fs.Args()
+	sources := 0
+	for _, set := range []bool{*content != "", *contentFile != "", len(files) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected files, -content, or -content-file\n")
+		return 1
+	}
+
+	// format renders a digest as requested, without a line ending
+	format := func(crc uint32, config hashfile.Config) string {
+		if *comment {
+			return strings.TrimSuffix(hashfile.NewWriter(config).FormatComment(crc), "\n")
+		}
+		digest := fmt.Sprintf("%08X", crc)
+		if config.LowercaseDigest {
+			digest = strings.ToLower(digest)
+		}
+		return digest
+	}
+
+	if len(files) == 0 {
+		var src io.Reader = strings.NewReader(*content)
+		if *contentFile == "-" {
+			src = os.Stdin
+		} else if *contentFile != "" {
+			file, err := os.Open(*contentFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			defer file.Close()
+			src = file
+		}
+		config := cf.config("")
+		crc, err := hashfile.NewReader(config).DigestReader(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Println(format(crc, config))
+		return 0
+	}
+
+	allFiles, err := ef.expand(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, file := range allFiles {
+		config := cf.config(file)
+		name := displayPath(file, *base)
+		crc, err := hashfile.NewReader(config).Digest(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s  %s\n", format(crc, config), name)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runContent prints the bytes hashed for a file to stdout, exactly as they are hashed
+func runContent(args []string) int {
+	fs := flag.NewFlagSet("content", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	showBoundaries := fs.Bool("show-boundaries", false, "Also report the content and comment offsets on stderr")
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected exactly one file\n")
+		return 1
+	}
+	file := fs.Arg(0)
+
+	out := bufio.NewWriter(os.Stdout)
+	bounds, err := hashfile.NewReader(cf.config(file)).HashedContent(file, out)
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", file, err)
+		return 1
+	}
+
+	if *showBoundaries {
+		fmt.Fprintf(os.Stderr, "file:    %d bytes\n", bounds.FileSize)
+		fmt.Fprintf(os.Stderr, "content: bytes 0-%d\n", bounds.End)
+		if bounds.CommentEnd > 0 {
+			fmt.Fprintf(os.Stderr, "comment: bytes %d-%d\n", bounds.CommentStart, bounds.CommentEnd)
+		} else {
+			fmt.Fprintf(os.Stderr, "comment: none\n")
+		}
+	}
+	return 0
+}
+
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected exactly one file\n")
+		return 1
+	}
+	file := fs.Arg(0)
+
+	d, err := hashfile.NewReader(cf.config(file)).Diagnose(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", file, err)
+		return 1
+	}
+
+	var problems []string
+	fmt.Printf("file:          %s, %d bytes\n", file, d.Range.FileSize)
+
+	ext := filepath.Ext(file)
+	switch {
+	case cf.style != "":
+		fmt.Printf("style:         %s, from -style\n", styleForm(d.Style))
+		if d.KnownExtension && d.Style != d.ExtensionStyle {
+			problems = append(problems, fmt.Sprintf("-style differs from the style for %s files, %s; the comment may break the file's syntax",
+				ext, styleForm(d.ExtensionStyle)))
+		}
+	case d.KnownExtension:
+		fmt.Printf("style:         %s, from the extension %s\n", styleForm(d.Style), ext)
+	default:
+		fmt.Printf("style:         %s, the default; %q has no known style\n", styleForm(d.Style), ext)
+		problems = append(problems, "the extension has no known comment style; pass -style if the default is wrong for this language")
+	}
+
+	if d.Comment == "" {
+		fmt.Printf("comment:       none\n")
+	} else {
+		fmt.Printf("comment:       %s, bytes %d-%d\n", d.Comment, d.Range.CommentStart, d.Range.CommentEnd)
+		if d.Foreign {
+			fmt.Printf("comment style: %s, not the configured style\n", styleForm(d.CommentStyle))
+			problems = append(problems, fmt.Sprintf("the comment is in another style; run 'hashfile add %s' to replace it, or 'hashfile restyle -from=%s -to=STYLE %s' to keep the digest",
+				file, styleName(d.CommentStyle), file))
+		} else {
+			fmt.Printf("comment style: %s, as configured\n", styleForm(d.CommentStyle))
+		}
+	}
+
+	switch {
+	case d.LF > 0 && d.CRLF > 0:
+		fmt.Printf("line endings:  mixed, %d LF and %d CRLF\n", d.LF, d.CRLF)
+		problems = append(problems, "mixed line endings; an editor or git normalizing them will change the digest")
+	case d.CRLF > 0:
+		fmt.Printf("line endings:  CRLF\n")
+	case d.LF > 0:
+		fmt.Printf("line endings:  LF\n")
+	default:
+		fmt.Printf("line endings:  none\n")
+	}
+	if d.BOM {
+		fmt.Printf("BOM:           UTF-8, hashed as content\n")
+	} else {
+		fmt.Printf("BOM:           none\n")
+	}
+
+	reason := hashfile.ReasonFor(d.Verify.Valid, d.VerifyErr)
+	switch reason {
+	case hashfile.ReasonOK:
+		fmt.Printf("verify:        %s\n", reason)
+	case hashfile.ReasonMismatch:
+		fmt.Printf("verify:        %s, stored %08X, computed %08X\n", reason, d.Verify.StoredCRC, d.Verify.ComputedCRC)
+		problems = append(problems, fmt.Sprintf("the content changed since it was stamped; run 'hashfile content %s' to see the bytes hashed", file))
+	case hashfile.ReasonNoComment:
+		fmt.Printf("verify:        %s\n", reason)
+		if d.Comment == "" {
+			problems = append(problems, fmt.Sprintf("the file is not stamped; run 'hashfile add %s'", file))
+		}
+	default:
+		fmt.Printf("verify:        %s, %v\n", reason, d.VerifyErr)
+		problems = append(problems, d.VerifyErr.Error())
+	}
+
+	if len(problems) == 0 {
+		return 0
+	}
+	fmt.Printf("\nProblems:\n")
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	return 1
+}
+
+// styleForm shows how comments in style look, e.g. "/* ... */"
+func styleForm(style hashfile.CommentStyle) string {
+	return strings.TrimSpace(style.Prefix + "..." + style.Suffix)
+}
+
+// styleName returns a -style name for style, or "?" if it has none
+func styleName(style hashfile.CommentStyle) string {
+	for _, name := range hashfile.SupportedStyles() {
+		if config, _ := hashfile.ConfigForStyleName(name); config.CommentStyle == style {
+			return name
+		}
+	}
+	return "?"
+}
+
+func runFormat(args []string) int {
+	fs := flag.NewFlagSet("format", flag.ExitOnError)
+	style := fs.String("style", "go", "Comment style (go|python|c|sql|html|shell|ruby|js|css|templ|matlab|mermaid|d2|fortran|f77|cobol)")
+	algorithm := fs.String("algorithm", "crc32", "Digest algorithm (crc32)")
+	fs.Parse(args)
+
+	if *algorithm != "crc32" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported algorithm '%s' (supported: crc32)\n", *algorithm)
+		return 1
+	}
+
+	config, err := hashfile.ConfigForStyleName(*style)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	writer := hashfile.NewWriter(config)
+
+	fmt.Printf("Style:     %s\n", *style)
+	fmt.Printf("Algorithm: %s\n", *algorithm)
+	fmt.Printf("Example:   %s", writer.FormatComment(0xABCD1234))
+	fmt.Printf("Pattern:   %s\n", writer.Pattern())
+	return 0
+}
+
+// runStyles lists every style name with its delimiters and the extensions detected as it.
+// Extensions are grouped by style, so names for identical styles share them.
+func runStyles(args []string) int {
+	fs := flag.NewFlagSet("styles", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: styles takes no arguments\n")
+		return 1
+	}
+
+	extensions := make(map[hashfile.CommentStyle][]string)
+	for ext, style := range hashfile.SupportedExtensions() {
+		extensions[style] = append(extensions[style], ext)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPREFIX\tSUFFIX\tEXTENSIONS")
+	for _, name := range hashfile.SupportedStyles() {
+		config, _ := hashfile.ConfigForStyleName(name)
+		style := config.CommentStyle
+		exts := extensions[style]
+		sort.Strings(exts)
+		fmt.Fprintf(w, "%s\t%q\t%q\t%s\n", name, style.Prefix, style.Suffix, strings.Join(exts, " "))
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runTreeDigest(args []string) int {
+	fs := flag.NewFlagSet("tree-digest", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	hidden := fs.Bool("hidden", false, "Include hidden files and directories")
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected exactly one directory\n")
+		return 1
+	}
+
+	digest, err := hashfile.TreeDigest(fs.Arg(0), hashfile.Options{
+		ConfigFor: func(path string) hashfile.Config {
+			return cf.config(path)
+		},
+		SkipHidden: !*hidden,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(digest)
+	return 0
+}
+
+// snapshotFile is the JSON document written by snapshot, as read by hashfile.ReadSnapshot
+type snapshotFile struct {
+	Files map[string]string `json:"files"`
+}
+
+func runSnapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	hidden := fs.Bool("hidden", false, "Include hidden files and directories")
+	base := fs.String("base", "", "Record paths relative to this directory instead of the snapshot root")
+	absolute := fs.Bool("absolute", false, "Record absolute paths")
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *base != "" && *absolute {
+		fmt.Fprintf(os.Stderr, "Error: -base and -absolute cannot be used together\n")
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected exactly one directory\n")
+		return 1
+	}
+
+	files, err := hashfile.TreeSnapshot(fs.Arg(0), hashfile.Options{
+		ConfigFor: func(path string) hashfile.Config {
+			return cf.config(path)
+		},
+		SkipHidden: !*hidden,
+	})
+	if err == nil && (*base != "" || *absolute) {
+		files, err = hashfile.RebaseSnapshot(files, fs.Arg(0), *base)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshotFile{Files: files}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runVerifySnapshot(args []string) int {
+	fs := flag.NewFlagSet("verify-snapshot", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	hidden := fs.Bool("hidden", false, "Include hidden files and directories")
+	quiet := fs.Bool("q", false, "Quiet mode (no output, only exit code)")
+	fs.BoolVar(quiet, "quiet", false, "Alias for -q")
+	fs.Parse(args)
+
+	if err := cf.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Error: expected a snapshot file and an optional directory\n")
+		return 1
+	}
+
+	snapshot, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	before, err := hashfile.ReadSnapshot(snapshot)
+	snapshot.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+
+	opts := hashfile.Options{
+		ConfigFor: func(path string) hashfile.Config {
+			return cf.config(path)
+		},
+		SkipHidden: !*hidden,
+	}
+	var diff hashfile.SnapshotDiff
+	checked := len(before)
+	if fs.NArg() == 1 {
+		// Without a directory, check the listed files where the snapshot says they are
+		diff, err = hashfile.CheckSnapshot(before, filepath.Dir(fs.Arg(0)), opts)
+	} else {
+		var after map[string]string
+		if after, err = hashfile.TreeSnapshot(fs.Arg(1), opts); err == nil {
+			diff, checked = hashfile.CompareSnapshots(before, after), len(after)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if diff.Empty() {
+		if !*quiet {
+			fmt.Printf("All %d file(s) match the snapshot\n", checked)
+		}
+		return 0
+	}
+	if !*quiet {
+		for _, path := range diff.Added {
+			fmt.Printf("Added: %s\n", path)
+		}
+		for _, path := range diff.Removed {
+			fmt.Printf("Removed: %s\n", path)
+		}
+		for _, path := range diff.Changed {
+			fmt.Printf("Changed: %s\n", path)
+		}
+		fmt.Fprintf(os.Stderr, "\nSnapshot differs: %d added, %d removed, %d changed\n",
+			len(diff.Added), len(diff.Removed), len(diff.Changed))
+	}
+	return 1
+}
+
+// printDiff prints the changes to a file as a unified diff hunk
+func printDiff(name string, d hashfile.TailDiff) {
+	if d.Empty() {
+		return
+	}
+
+	// An empty side of a hunk starts at the line before the change
+	oldStart, newStart := d.Line, d.Line
+	if len(d.Removed) == 0 {
+		oldStart--
+	}
+	if len(d.Added) == 0 {
+		newStart--
+	}
+
+	fmt.Printf("--- a/%s\n+++ b/%s\n", name, name)
+	fmt.Printf("@@ -%d,%d +%d,%d @@\n", oldStart, len(d.Removed), newStart, len(d.Added))
+	for _, line := range d.Removed {
+		fmt.Printf("-%s\n", line)
+	}
+	for _, line := range d.Added {
+		fmt.Printf("+%s\n", line)
+	}
+}
+
+// parseSize parses a byte count with an optional k, m, or g suffix (powers of 1024)
+func parseSize(s string) (int, error) {
+	multiplier := 1
+	num := strings.TrimSuffix(strings.ToLower(s), "b")
+	switch {
+	case strings.HasSuffix(num, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(num, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(num, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		num = num[:len(num)-1]
+	}
+
+	n, err := strconv.Atoi(num)
+	if err != nil || n <= 0 || n > math.MaxInt/multiplier {
+		return 0, fmt.Errorf("size %q must be a positive number with an optional k, m, or g suffix", s)
+	}
+	return n * multiplier, nil
+}
+
+// outputPaths maps each file to its copy under dir, at its path relative to base or, without
+// a base, to the working directory. Files outside that directory, or whose copies would
+// collide, are refused.
+func outputPaths(files []string, base, dir string) (map[string]string, error) {
+	root := base
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string]string, len(files))
+	sources := make(map[string]string, len(files))
+	for _, file := range files {
+		absFile, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(absRoot, absFile)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is outside %s; use -base to choose the directory copies are relative to", file, root)
+		}
+		dest := filepath.Join(dir, rel)
+		if other, ok := sources[dest]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", other, file, dest)
+		}
+		sources[dest] = file
+		outputs[file] = dest
+	}
+	return outputs, nil
+}
+
+// processToStdout writes the content add would give file to stdout, without modifying it
+func processToStdout(file string, config hashfile.Config) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	if _, err := hashfile.NewWriter(config).Process(src, out); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// checkPresence reports whether each file has an integrity comment, without hashing it
+func checkPresence(files []string, cf *configFlags, base string, quiet, porcelain, summaryJSON bool) int {
+	stamped, unstamped, errorCount := 0, 0, 0
+	stats := newSummary(true)
+
+	for _, file := range files {
+		name := displayPath(file, base)
+		found, err := hashfile.NewReader(cf.config(file)).HasComment(file)
+
+		reason := hashfile.ReasonOK
+		switch {
+		case err != nil:
+			reason = hashfile.ReasonFor(false, err)
+			errorCount++
+		case !found:
+			reason = hashfile.ReasonNoComment
+			unstamped++
+		default:
+			stamped++
+		}
+		stats.record(reason)
+
+		switch {
+		case summaryJSON:
+		case porcelain:
+			if !quiet || reason != hashfile.ReasonOK {
+				fmt.Printf("%s\t%s\n", reason, name)
+			}
+		case err != nil:
+			fmt.Printf("✗ %s (error: %v)\n", name, err)
+		case !found:
+			fmt.Printf("✗ %s (no integrity comment)\n", name)
+		case !quiet:
+			fmt.Printf("✓ %s\n", name)
+		}
+	}
+
+	if summaryJSON {
+		if err := stats.print(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	} else if !quiet && !porcelain {
+		fmt.Printf("\nTotal: %d files, %d with comments, %d without, %d errors\n",
+			len(files), stamped, unstamped, errorCount)
+	}
+
+	if unstamped > 0 || errorCount > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkEntry is one file's result in check -json output
+type checkEntry struct {
+	Path        string          `json:"path"`
+	Reason      hashfile.Reason `json:"reason"`
+	Error       string          `json:"error,omitempty"`
+	StoredCRC   string          `json:"stored_crc,omitempty"`
+	ComputedCRC string          `json:"computed_crc,omitempty"`
+}
+
+func newCheckEntry(name string, r hashfile.FileResult) checkEntry {
+	entry := checkEntry{Path: name, Reason: r.Reason}
+	if r.Err != nil {
+		entry.Error = r.Err.Error()
+	} else {
+		entry.StoredCRC = fmt.Sprintf("%08X", r.StoredCRC)
+		entry.ComputedCRC = fmt.Sprintf("%08X", r.ComputedCRC)
+	}
+	return entry
+}
+
+// configFlags holds the flags shared by commands that build a per-file configuration
+type configFlags struct {
+	style       string
+	key         string
+	acceptKeys  string
+	normalizeGo bool
+	modeline    bool
+	blankLine   bool
+	marker      string
+	noNewline   bool
+	lowercase   bool
+	version     int
+	parallel    bool
+	script      bool
+	noFollow    bool
+	readOnly    bool
+	permBits    bool
+	tempDir     string
+	tempPrefix  string
+	sidecarDir  string
+	maxHash     int
+	headTail    int
+	maxSize     string
+	buffer      string
+	ignoreLines string
+	ignoreMark  bool
+	namespace   string
+	retries     int
+	retryChange int
+
+	ignorePattern *regexp.Regexp
+	bufferSize    int
+	maxFileSize   int64
+}
+
+// addConfigFlags registers the configuration flags on fs
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	cf := &configFlags{}
+	fs.StringVar(&cf.style, "style", "", "Comment style (go|python|c|sql|html|shell|ruby|js|css|templ|matlab|mermaid|d2|fortran|f77|cobol)")
+	fs.StringVar(&cf.key, "key", hashfile.DefaultKey, "Key labelling the checksum in the comment")
+	fs.StringVar(&cf.acceptKeys, "accept-keys", "", "Comma-separated additional keys to accept, e.g. during a key migration")
+	fs.BoolVar(&cf.normalizeGo, "normalize-go", false, "Hash gofmt-normalized content for .go files")
+	fs.BoolVar(&cf.modeline, "preserve-modeline", false, "Keep a trailing vim/emacs modeline as the last line")
+	fs.BoolVar(&cf.lowercase, "lowercase", false, "Write the digest in lowercase hexadecimal")
+	fs.IntVar(&cf.version, "format-version", 0, "Comment format to write: 0 (legacy) or 1 (\"v1:\" token)")
+	fs.BoolVar(&cf.blankLine, "blank-line", false, "Separate the comment from the content with a blank line")
+	fs.StringVar(&cf.marker, "generated-marker", "", "Line to write just before the comment, e.g. a \"Code generated ... DO NOT EDIT.\" marker")
+	fs.BoolVar(&cf.noNewline, "no-final-newline", false, "End the file with the comment, without a trailing line ending")
+	fs.BoolVar(&cf.parallel, "parallel-hash", false, "Hash large files on multiple goroutines")
+	fs.StringVar(&cf.buffer, "buffer", "", "Streaming buffer size, e.g. 64k or 1m (default 64k)")
+	fs.IntVar(&cf.maxHash, "max-hash-bytes", 0, "Hash only the first N bytes of content (0 = all)")
+	fs.IntVar(&cf.headTail, "head-tail-bytes", 0, "Hash only the first and last N bytes of content (0 = all)")
+	fs.StringVar(&cf.maxSize, "max-file-size", "", "Refuse files larger than this, e.g. 100m (default unlimited)")
+	fs.BoolVar(&cf.script, "script-mode", false, "Write the comment below the shebang line of #-comment scripts")
+	fs.StringVar(&cf.ignoreLines, "ignore-lines", "", "Exclude lines matching this regular expression from the hash")
+	fs.BoolVar(&cf.ignoreMark, "ignore-markers", false, "Exclude regions between hashfile:ignore-start and hashfile:ignore-end lines from the hash")
+	fs.IntVar(&cf.retries, "retry", 0, "Retry transient I/O errors (EAGAIN, ETIMEDOUT) up to N times with backoff")
+	fs.IntVar(&cf.retryChange, "retry-on-change", 0, "Verify again up to N times if a file changes while it is read")
+	fs.StringVar(&cf.namespace, "namespace", "", "Hash this project namespace ahead of the content")
+	fs.BoolVar(&cf.permBits, "include-perm-bits", false, "Include the file's permission bits in the hash, so chmod invalidates it")
+	fs.StringVar(&cf.tempDir, "temp-dir", "", "Create temporary files for rewrites in this directory instead of the file's own")
+	fs.StringVar(&cf.tempPrefix, "temp-prefix", hashfile.DefaultTempPrefix, "Prefix of temporary file names; files named like them are refused")
+	fs.StringVar(&cf.sidecarDir, "sidecar-dir", "", "Keep digests in <file>.integrity sidecars under this directory instead of in the files")
+	fs.BoolVar(&cf.readOnly, "read-only", false, "Never write: fail on files that would be modified")
+	fs.BoolVar(&cf.noFollow, "no-follow", false, "Refuse symbolic links and detect files swapped during a rewrite")
+	fs.BoolVar(&warnings.fatal, "Werror", false, "Treat warnings as errors: exit 1 if any warning was reported")
+	return cf
+}
+
+// validate checks the flag values; it must be called after parsing
+func (cf *configFlags) validate() error {
+	if cf.style != "" {
+		if _, err := hashfile.ConfigForStyleName(cf.style); err != nil {
+			return err
+		}
+	}
+	if cf.maxHash < 0 {
+		return fmt.Errorf("invalid -max-hash-bytes %d", cf.maxHash)
+	}
+	if cf.headTail < 0 {
+		return fmt.Errorf("invalid -head-tail-bytes %d", cf.headTail)
+	}
+	if cf.maxHash > 0 && cf.headTail > 0 {
+		return fmt.Errorf("-max-hash-bytes and -head-tail-bytes cannot be combined")
+	}
+	if cf.retries < 0 {
+		return fmt.Errorf("invalid -retry %d", cf.retries)
+	}
+	if cf.retryChange < 0 {
+		return fmt.Errorf("invalid -retry-on-change %d", cf.retryChange)
+	}
+	if cf.buffer != "" {
+		size, err := parseSize(cf.buffer)
+		if err != nil {
+			return fmt.Errorf("invalid -buffer: %v", err)
+		}
+		cf.bufferSize = size
+		if err := cf.config("").Validate(); err != nil {
+			return fmt.Errorf("invalid -buffer: %v", err)
+		}
+	}
+	if cf.version < 0 || cf.version > 1 {
+		return fmt.Errorf("invalid -format-version %d (supported: 0, 1)", cf.version)
+	}
+	if cf.maxSize != "" {
+		size, err := parseSize(cf.maxSize)
+		if err != nil {
+			return fmt.Errorf("invalid -max-file-size: %v", err)
+		}
+		cf.maxFileSize = int64(size)
+	}
+	if cf.tempPrefix == "" || strings.ContainsAny(cf.tempPrefix, `/\`) {
+		return fmt.Errorf("invalid -temp-prefix %q", cf.tempPrefix)
+	}
+	if cf.key == "" || strings.ContainsAny(cf.key, "\r\n") {
+		return fmt.Errorf("invalid -key %q", cf.key)
+	}
+	if cf.acceptKeys != "" {
+		for _, key := range strings.Split(cf.acceptKeys, ",") {
+			if key == "" || strings.ContainsAny(key, "\r\n") {
+				return fmt.Errorf("invalid -accept-keys %q", cf.acceptKeys)
+			}
+		}
+	}
+	if cf.ignoreLines != "" {
+		pattern, err := regexp.Compile(cf.ignoreLines)
+		if err != nil {
+			return fmt.Errorf("invalid -ignore-lines pattern: %v", err)
+		}
+		cf.ignorePattern = pattern
+	}
+	return nil
+}
+
+// config returns configuration based on file extension or explicit style
+func (cf *configFlags) config(filename string) hashfile.Config {
+	var config hashfile.Config
+	if cf.style != "" {
+		// Style names are validated before processing starts
+		config, _ = hashfile.ConfigForStyleName(cf.style)
+	} else {
+		ext := filepath.Ext(filename)
+		config = hashfile.ConfigForExtension(ext)
+	}
+
+	config.Key = cf.key
+	if cf.acceptKeys != "" {
+		config.AcceptKeys = strings.Split(cf.acceptKeys, ",")
+	}
+	config.NormalizeGo = cf.normalizeGo && filepath.Ext(filename) == ".go"
+	config.PreserveModeline = cf.modeline
+	config.BlankLineBefore = cf.blankLine
+	config.GeneratedMarker = cf.marker
+	config.NoFinalNewline = cf.noNewline
+	config.LowercaseDigest = cf.lowercase
+	config.FormatVersion = cf.version
+	config.ParallelHash = cf.parallel
+	config.ScriptMode = cf.script
+	config.NoFollow = cf.noFollow
+	config.ReadOnly = cf.readOnly
+	config.IncludePermBits = cf.permBits
+	config.TempDir = cf.tempDir
+	config.TempPrefix = cf.tempPrefix
+	config.SidecarDir = cf.sidecarDir
+	config.Namespace = cf.namespace
+	config.Retries = cf.retries
+	config.RetryOnChange = cf.retryChange
+	config.MaxHashBytes = cf.maxHash
+	config.HeadTailBytes = cf.headTail
+	config.MaxFileSize = cf.maxFileSize
+	if cf.bufferSize > 0 {
+		config.BufferSize = cf.bufferSize
+	}
+	config.IgnoreLines = cf.ignorePattern
+	config.IgnoreMarkers = cf.ignoreMark
+	config.Warn = func(msg string) {
+		warnings.warn(filename, msg)
+	}
+	return config
+}
+
+// displayPath returns the path to report for a file. With a base directory the path is
+// made relative to it; if that is impossible the absolute path is used instead.
+func displayPath(file, base string) string {
+	if base == "" {
+		return file
+	}
+
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return absFile
+	}
+	rel, err := filepath.Rel(absBase, absFile)
+	if err != nil {
+		return absFile
+	}
+	return rel
+}
+
+// expandFlags holds the flags controlling how file arguments are expanded
+type expandFlags struct {
+	exts    extList
+	verbose bool
+}
+
+// addExpandFlags registers the file expansion flags on fs
+func addExpandFlags(fs *flag.FlagSet) *expandFlags {
+	ef := &expandFlags{}
+	fs.Var(&ef.exts, "ext", "Only process these comma-separated extensions in directories (repeatable)")
+	fs.BoolVar(&ef.verbose, "verbose", false, "Report how many files were duplicates or skipped for their extension")
+	return ef
+}
+
+// expand expands file arguments, reporting duplicates to stderr under -verbose
+func (ef *expandFlags) expand(patterns []string) ([]string, error) {
+	files, stats, err := hashfile.ExpandPatternsDetailed(patterns, ef.exts...)
+	if err != nil {
+		return nil, err
+	}
+	if ef.verbose {
+		fmt.Fprintf(os.Stderr, "Expanded to %d unique file(s), %d duplicate(s) and %d file(s) with other extensions skipped\n",
+			len(files), stats.Duplicates, stats.Skipped)
+	}
+	return files, nil
+}
+
+// extList is a repeatable flag of comma-separated file extensions, with or without the
+// leading dot
+type extList []string
+
+func (e *extList) String() string {
+	return strings.Join(*e, ",")
 }
 
-// containsWildcard checks if a string contains glob wildcards
-func containsWildcard(s string) bool {
-	for _, c := range s {
-		if c == '*' || c == '?' || c == '[' {
-			return true
+func (e *extList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		ext := strings.TrimPrefix(strings.TrimSpace(item), ".")
+		if ext == "" || strings.ContainsAny(ext, "./\\") {
+			return fmt.Errorf("invalid extension %q", item)
 		}
+		*e = append(*e, "."+ext)
 	}
-	return false
+	return nil
 }
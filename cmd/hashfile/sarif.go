@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dmoose/hashfile"
+)
+
+// sarifRules describes each failure reason as a SARIF rule
+var sarifRules = []struct {
+	reason      hashfile.Reason
+	id          string
+	description string
+}{
+	{hashfile.ReasonMismatch, "hashfile/integrity-mismatch", "The stored CRC does not match the file content"},
+	{hashfile.ReasonNoComment, "hashfile/no-comment", "The file has no integrity comment"},
+	{hashfile.ReasonBadFormat, "hashfile/bad-format", "The integrity comment is malformed"},
+	{hashfile.ReasonTrailing, "hashfile/trailing-data", "Content follows the integrity comment"},
+	{hashfile.ReasonTooLarge, "hashfile/too-large", "The file exceeds the maximum file size"},
+	{hashfile.ReasonReadError, "hashfile/read-error", "The file could not be read"},
+}
+
+// sarifLog is a SARIF 2.1.0 report of verify failures, one result per failed file
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+func newSARIF() *sarifLog {
+	driver := sarifDriver{
+		Name:           "hashfile",
+		Version:        version,
+		InformationURI: "https://github.com/dmoose/hashfile",
+	}
+	for _, rule := range sarifRules {
+		driver.Rules = append(driver.Rules, sarifRule{ID: rule.id, ShortDescription: sarifMessage{rule.description}})
+	}
+	return &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}},
+	}
+}
+
+// record adds a result for a failed file; valid files are not reported
+func (l *sarifLog) record(r hashfile.FileResult, path string) {
+	for i, rule := range sarifRules {
+		if rule.reason != r.Reason {
+			continue
+		}
+		message := rule.description
+		if r.Err != nil {
+			message = r.Err.Error()
+		}
+		result := sarifResult{
+			RuleID:    rule.id,
+			RuleIndex: i,
+			Level:     "error",
+			Message:   sarifMessage{message},
+			Locations: make([]sarifLocation, 1),
+		}
+		result.Locations[0].PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(path)
+		l.Runs[0].Results = append(l.Runs[0].Results, result)
+		return
+	}
+}
+
+// write saves the report to filename
+func (l *sarifLog) write(filename string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write SARIF report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dmoose/hashfile"
+)
+
+// checkGitRepo returns an error unless the current directory is inside a git work tree.
+func checkGitRepo() error {
+	out, err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "true" {
+		return errors.New("-staged requires running inside a git repository")
+	}
+	return nil
+}
+
+// stagedContent returns the content of file as staged in the git index.
+func stagedContent(file string) ([]byte, error) {
+	cmd := exec.Command("git", "-C", filepath.Dir(file), "cat-file", "blob", ":./"+filepath.Base(file))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("failed to read staged content: %s", msg)
+	}
+	return out, nil
+}
+
+// verifyStaged verifies the staged version of file rather than the working tree copy.
+func verifyStaged(file string, config hashfile.Config) hashfile.FileResult {
+	result := hashfile.FileResult{Path: file}
+	content, err := stagedContent(file)
+	if err == nil {
+		result.Valid, err = hashfile.NewReader(config).Verify(bytes.NewReader(content))
+	}
+	result.Err = err
+	result.Reason = hashfile.ReasonFor(result.Valid, err)
+	return result
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/dmoose/hashfile"
+)
+
+// summary is the aggregate printed by -summary-json
+type summary struct {
+	Total      int   `json:"total"`
+	Valid      int   `json:"valid"`
+	Invalid    int   `json:"invalid"`
+	Errors     int   `json:"errors"`
+	Unhashed   *int  `json:"unhashed,omitempty"` // nil for add, which stamps unhashed files
+	DurationMS int64 `json:"duration_ms"`
+
+	start time.Time
+}
+
+// newSummary starts a summary; unhashed counts files without a comment separately from errors,
+// which only verify and check report
+func newSummary(unhashed bool) *summary {
+	s := &summary{start: time.Now()}
+	if unhashed {
+		s.Unhashed = new(int)
+	}
+	return s
+}
+
+// record counts one file by the reason for its outcome
+func (s *summary) record(reason hashfile.Reason) {
+	s.Total++
+	switch reason {
+	case hashfile.ReasonOK:
+		s.Valid++
+	case hashfile.ReasonMismatch:
+		s.Invalid++
+	case hashfile.ReasonNoComment:
+		if s.Unhashed == nil {
+			s.Errors++
+			break
+		}
+		*s.Unhashed++
+	default:
+		s.Errors++
+	}
+}
+
+// print writes the summary to stdout as a single JSON object
+func (s *summary) print() error {
+	s.DurationMS = time.Since(s.start).Milliseconds()
+	return json.NewEncoder(os.Stdout).Encode(s)
+}
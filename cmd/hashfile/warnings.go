@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// warningLog collects the warnings reported while a command runs, so that -Werror can fail
+// a command that would otherwise succeed. Files verified concurrently warn concurrently.
+type warningLog struct {
+	mu    sync.Mutex
+	count int
+	quiet bool // Count warnings without printing them
+	fatal bool // Treat warnings as errors (-Werror)
+}
+
+// warnings is the log every command's configurations report to
+var warnings = &warningLog{}
+
+// warn records a warning about file and prints it to stderr unless quiet
+func (l *warningLog) warn(file, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	if !l.quiet {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", file, msg)
+	}
+}
+
+// exitCode returns the exit code for a command that finished with code: 1 instead of 0
+// if warnings are fatal and any were reported
+func (l *warningLog) exitCode(code int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if code != 0 || !l.fatal || l.count == 0 {
+		return code
+	}
+	if !l.quiet {
+		fmt.Fprintf(os.Stderr, "Error: %d warning(s) treated as errors (-Werror)\n", l.count)
+	}
+	return 1
+}
@@ -0,0 +1,62 @@
+package hashfile
+
+import (
+	"fmt"
+	"io"
+)
+
+// ContentRange locates the content and the integrity comment of a file in its bytes. The
+// content is the bytes before End, except the comment, which lies before End only when it
+// sits below a shebang in ScriptMode; a trailing comment starts after End, past the line
+// ending and separator that are not hashed either.
+type ContentRange struct {
+	End          int64 // Offset just past the content
+	CommentStart int64 // Offset of the integrity comment
+	CommentEnd   int64 // Offset just past the integrity comment, 0 if there is none
+	FileSize     int64 // Total bytes in the file
+}
+
+// HashedContent writes to out the exact bytes Digest feeds to the CRC for a file, to debug
+// verification failures: the content without its comment, final line ending, ignored lines
+// or regions, or bytes past MaxHashBytes, gofmt-normalized with NormalizeGo. The Namespace
+// and permission bits hashed ahead of the content are not written. It returns where the
+// content and the comment lie in the file.
+func (r *Reader) HashedContent(filename string, out io.Writer) (ContentRange, error) {
+	file, err := r.open(filename)
+	if err != nil {
+		return ContentRange{}, err
+	}
+	defer file.Close()
+
+	reader, err := r.forFile(file)
+	if err != nil {
+		return ContentRange{}, err
+	}
+	tee := &firstErrWriter{w: out}
+	config := reader.config
+	config.tee = tee
+	_, bounds, err := (&Reader{config: config, pattern: reader.pattern}).digest(file)
+	if err != nil {
+		return ContentRange{}, err
+	}
+	if tee.err != nil {
+		return ContentRange{}, fmt.Errorf("write error: %w", tee.err)
+	}
+	return bounds, nil
+}
+
+// firstErrWriter writes to w until a write fails, then keeps the error and discards the rest,
+// for writers whose errors cannot be returned where they occur.
+type firstErrWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (f *firstErrWriter) Write(p []byte) (int, error) {
+	if f.err == nil {
+		_, f.err = f.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// FileIntegrity: 05D515F0
@@ -0,0 +1,77 @@
+package hashfile
+
+import (
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestHashedContent ensures the bytes written are exactly those behind the digest
+func TestHashedContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		bounds  ContentRange
+		config  func(*Config)
+	}{
+		{"no comment", "package main\n", "package main",
+			ContentRange{End: 12, FileSize: 13}, nil},
+		{"comment", "package main\n// FileIntegrity: 7FE7DFB2\n", "package main",
+			ContentRange{End: 12, CommentStart: 13, CommentEnd: 40, FileSize: 40}, nil},
+		{"blank line", "package main\n\n// FileIntegrity: 7FE7DFB2\n", "package main",
+			ContentRange{End: 12, CommentStart: 14, CommentEnd: 41, FileSize: 41},
+			func(c *Config) { c.BlankLineBefore = true }},
+		{"ignored lines", "a\nbuilt: today\nb\n", "a\nb",
+			ContentRange{End: 16, FileSize: 17},
+			func(c *Config) { c.IgnoreLines = regexp.MustCompile(`^built:`) }},
+		{"limit", "package main\n", "pack",
+			ContentRange{End: 12, FileSize: 13}, func(c *Config) { c.MaxHashBytes = 4 }},
+		{"ends", "abcdefghij\n", "abij",
+			ContentRange{End: 10, FileSize: 11}, func(c *Config) { c.HeadTailBytes = 2 }},
+		{"normalized", "package  main\nfunc  f() {}\n", "package main\n\nfunc f() {}",
+			ContentRange{End: 26, FileSize: 27}, func(c *Config) { c.NormalizeGo = true }},
+		{"script", "#!/bin/sh\n# FileIntegrity: 00000000\necho hi\n", "#!/bin/sh\necho hi\n",
+			ContentRange{End: 44, CommentStart: 10, CommentEnd: 36, FileSize: 44},
+			func(c *Config) { c.CommentStyle = ShellStyle; c.ScriptMode = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.go")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			reader := NewReader(config)
+
+			var out bytes.Buffer
+			bounds, err := reader.HashedContent(path, &out)
+			if err != nil {
+				t.Fatalf("HashedContent() failed: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("content = %q, want %q", out.String(), tt.want)
+			}
+			if bounds != tt.bounds {
+				t.Errorf("bounds = %+v, want %+v", bounds, tt.bounds)
+			}
+
+			digest, err := reader.Digest(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if crc := crc32.ChecksumIEEE(out.Bytes()); crc != digest {
+				t.Errorf("CRC of content = %08X, Digest() = %08X", crc, digest)
+			}
+		})
+	}
+}
+
+// FileIntegrity: B99E478C
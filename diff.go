@@ -0,0 +1,130 @@
+package hashfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// TailDiff describes the lines ProcessFile would change in a file.
+type TailDiff struct {
+	Line    int      // 1-based line number of the first changed line
+	Removed []string // Lines removed, without line endings
+	Added   []string // Lines added, without line endings
+}
+
+// Empty reports whether the diff has no changes.
+func (d TailDiff) Empty() bool {
+	return len(d.Removed) == 0 && len(d.Added) == 0
+}
+
+// Diff reports the lines ProcessFile would change, without modifying the file. The output
+// is compared against the file as it is produced, so only the changed region is buffered.
+func (w *Writer) Diff(filename string) (TailDiff, error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return TailDiff{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+	if w.config.IncludePermBits {
+		info, err := src.Stat()
+		if err != nil {
+			return TailDiff{}, fmt.Errorf("failed to stat file: %w", err)
+		}
+		w = w.forFile(info)
+	}
+
+	orig, err := os.Open(filename)
+	if err != nil {
+		return TailDiff{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer orig.Close()
+
+	cmp := &diffWriter{orig: bufio.NewReader(orig)}
+	result, err := w.processStream(src, cmp)
+	if err != nil {
+		return TailDiff{}, err
+	}
+	if !result.Changed {
+		return TailDiff{}, nil
+	}
+
+	// Both sides resume at the start of the line where they diverged
+	rest, err := io.ReadAll(cmp.orig)
+	if err != nil {
+		return TailDiff{}, fmt.Errorf("read error: %w", err)
+	}
+	removed := splitLines(append(bytes.Clone(cmp.line), rest...))
+	added := splitLines(cmp.rest)
+	if !cmp.diverged {
+		added = splitLines(cmp.line)
+	}
+
+	// Drop unchanged trailing lines, such as a preserved modeline
+	for len(removed) > 0 && len(added) > 0 && removed[len(removed)-1] == added[len(added)-1] {
+		removed = removed[:len(removed)-1]
+		added = added[:len(added)-1]
+	}
+	diff := TailDiff{Line: cmp.lines + 1}
+	if len(removed) > 0 {
+		diff.Removed = removed
+	}
+	if len(added) > 0 {
+		diff.Added = added
+	}
+	return diff, nil
+}
+
+// diffWriter compares output with the original content until they first differ, then
+// keeps the rest of the output from the start of the line where they diverged.
+type diffWriter struct {
+	orig     *bufio.Reader
+	lines    int    // Complete lines before the divergence
+	line     []byte // Start of the current line, identical in both
+	diverged bool
+	rest     []byte // Output from the start of the diverging line
+}
+
+func (d *diffWriter) Write(p []byte) (int, error) {
+	if d.diverged {
+		d.rest = append(d.rest, p...)
+		return len(p), nil
+	}
+
+	for i, c := range p {
+		if b, err := d.orig.ReadByte(); err != nil || b != c {
+			if err == nil {
+				d.orig.UnreadByte()
+			}
+			d.diverged = true
+			d.rest = append(bytes.Clone(d.line), p[i:]...)
+			return len(p), nil
+		}
+		d.line = append(d.line, c)
+		if c == '\n' {
+			d.lines++
+			d.line = d.line[:0]
+		}
+	}
+	return len(p), nil
+}
+
+// splitLines splits content into lines without their line endings.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = string(trimLineEnding(line))
+	}
+	return result
+}
+
+// FileIntegrity: 25405C06
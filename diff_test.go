@@ -0,0 +1,82 @@
+package hashfile
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestDiff ensures Diff reports only the changed lines and leaves the file untouched
+func TestDiff(t *testing.T) {
+	crc := crc32.ChecksumIEEE([]byte("package main\n\nfunc main() {}"))
+	comment := fmt.Sprintf("// FileIntegrity: %08X", crc)
+
+	tests := []struct {
+		name     string
+		content  string
+		modeline bool
+		want     TailDiff
+	}{
+		{
+			name:    "first stamp",
+			content: "package main\n\nfunc main() {}\n",
+			want:    TailDiff{Line: 4, Added: []string{comment}},
+		},
+		{
+			name:    "wrong comment",
+			content: "package main\n\nfunc main() {}\n// FileIntegrity: 00000000\n",
+			want:    TailDiff{Line: 4, Removed: []string{"// FileIntegrity: 00000000"}, Added: []string{comment}},
+		},
+		{
+			name:    "correct comment",
+			content: "package main\n\nfunc main() {}\n" + comment + "\n",
+			want:    TailDiff{},
+		},
+		{
+			name:    "no trailing newline",
+			content: "package main\n\nfunc main() {}",
+			want:    TailDiff{Line: 3, Removed: []string{"func main() {}"}, Added: []string{"func main() {}", comment}},
+		},
+		{
+			name:     "before modeline",
+			content:  "package main\n\nfunc main() {}\n// vim: set ft=go:\n",
+			modeline: true,
+			want:     TailDiff{Line: 4, Added: []string{comment}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+			tmpfile.WriteString(tt.content)
+			tmpfile.Close()
+
+			config := DefaultConfig()
+			config.PreserveModeline = tt.modeline
+			config.BufferSize = 256
+			got, err := NewWriter(config).Diff(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("Diff() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != tt.want.Empty() {
+				t.Errorf("Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+
+			after, _ := os.ReadFile(tmpfile.Name())
+			if string(after) != tt.content {
+				t.Error("Diff() modified the file")
+			}
+		})
+	}
+}
+
+// FileIntegrity: F4017944
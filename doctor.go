@@ -0,0 +1,118 @@
+package hashfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// Diagnosis gathers what Reader.Diagnose found out about a file, to explain in one place why
+// it does not verify or was stamped unexpectedly.
+type Diagnosis struct {
+	Style          CommentStyle // Comment style the Reader is configured with
+	ExtensionStyle CommentStyle // Comment style for the file's extension, if KnownExtension
+	KnownExtension bool         // Whether the extension has a comment style
+
+	Comment      string       // The integrity comment found, without its line ending; empty if none
+	CommentStyle CommentStyle // Style of Comment, Style or another predefined style
+	Foreign      bool         // Whether Comment is in another style than Style
+
+	BOM  bool // Whether the file starts with a UTF-8 byte order mark
+	LF   int  // Lines ending in LF
+	CRLF int  // Lines ending in CRLF
+
+	Range     ContentRange // Where the content and the comment lie
+	Verify    VerifyResult // Outcome of VerifyDetailed
+	VerifyErr error        // Error from VerifyDetailed, if any
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Diagnose inspects a file: the comment style its extension maps to, the integrity comment it
+// carries and which predefined style that comment is in, its line endings and byte order mark,
+// and whether it verifies. Only failures to read the file are returned as errors; the outcome
+// of verification is part of the Diagnosis.
+func (r *Reader) Diagnose(filename string) (Diagnosis, error) {
+	d := Diagnosis{Style: r.config.CommentStyle}
+	ext := filepath.Ext(filename)
+	if d.ExtensionStyle, d.KnownExtension = r.config.ExtensionOverrides[ext]; !d.KnownExtension {
+		d.ExtensionStyle, d.KnownExtension = extensionStyles[ext]
+	}
+
+	var err error
+	if d.Range, err = r.HashedContent(filename, io.Discard); err != nil {
+		return d, err
+	}
+
+	file, err := r.open(filename)
+	if err != nil {
+		return d, err
+	}
+	defer file.Close()
+	if err := d.countLineEndings(bufio.NewReaderSize(file, r.config.BufferSize)); err != nil {
+		return d, fmt.Errorf("read error: %w", err)
+	}
+
+	if d.Range.CommentEnd > 0 {
+		line := make([]byte, d.Range.CommentEnd-d.Range.CommentStart)
+		if _, err := file.ReadAt(line, d.Range.CommentStart); err != nil {
+			return d, fmt.Errorf("read error: %w", err)
+		}
+		line = bytes.TrimRight(trimLineEnding(line), " \t")
+		d.Comment = string(line)
+		if r.pattern.Match(line) {
+			d.CommentStyle = d.Style
+		} else if style, ok := foreignStyle(line); ok {
+			d.CommentStyle, d.Foreign = style, true
+		}
+	}
+
+	d.Verify, d.VerifyErr = r.VerifyDetailed(filename)
+	return d, nil
+}
+
+// countLineEndings records the byte order mark and line endings of the content read from src.
+func (d *Diagnosis) countLineEndings(src *bufio.Reader) error {
+	if start, _ := src.Peek(len(utf8BOM)); bytes.Equal(start, utf8BOM) {
+		d.BOM = true
+	}
+	var prev byte
+	for {
+		line, err := src.ReadSlice('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			// A CR may end the previous slice if the line filled the buffer
+			if len(line) > 1 && line[len(line)-2] == '\r' || len(line) == 1 && prev == '\r' {
+				d.CRLF++
+			} else {
+				d.LF++
+			}
+		}
+		if len(line) > 0 {
+			prev = line[len(line)-1]
+		}
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// foreignStyle returns the predefined style of an integrity comment line, labelled with
+// DefaultKey. Styles that share a comment syntax, e.g. GoStyle and CStyle, are reported as the
+// first of predefinedStyles.
+func foreignStyle(line []byte) (CommentStyle, bool) {
+	for i, pattern := range foreignPatterns {
+		if pattern.Match(line) {
+			return predefinedStyles[i], true
+		}
+	}
+	return CommentStyle{}, false
+}
+
+// FileIntegrity: 640FC107
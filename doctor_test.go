@@ -0,0 +1,73 @@
+package hashfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDiagnose ensures the comment, its style, line endings and BOM of a file are reported
+func TestDiagnose(t *testing.T) {
+	long := strings.Repeat("x", 255) + "\r\n" // The CR ends a full buffer
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		comment   string
+		style     CommentStyle
+		foreign   bool
+		bom       bool
+		lf, crlf  int
+		verifyErr error
+	}{
+		{"stamped", "main.go", "package main\n// FileIntegrity: 7FE7DFB2\n",
+			"// FileIntegrity: 7FE7DFB2", GoStyle, false, false, 2, 0, nil},
+		{"foreign style", "tool.py", "print(1)\n// FileIntegrity: 12345678\n",
+			"// FileIntegrity: 12345678", GoStyle, true, false, 2, 0, ErrNoComment},
+		{"no comment", "page.html", "\xEF\xBB\xBF<p>\r\n</p>\r\n", "", CommentStyle{}, false, true, 0, 2, ErrNoComment},
+		{"mixed endings", "a.sql", "a\r\nb\nc", "", CommentStyle{}, false, false, 1, 1, ErrNoComment},
+		{"long CRLF line", "b.sql", long + long + "c\n", "", CommentStyle{}, false, false, 1, 2, ErrNoComment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := ConfigForFilename(path, DefaultConfig())
+			config.BufferSize = 256
+			d, err := NewReader(config).Diagnose(path)
+			if err != nil {
+				t.Fatalf("Diagnose() failed: %v", err)
+			}
+
+			if !d.KnownExtension || d.ExtensionStyle != config.CommentStyle || d.Style != config.CommentStyle {
+				t.Errorf("ExtensionStyle = %+v (known %v), Style = %+v; want %+v",
+					d.ExtensionStyle, d.KnownExtension, d.Style, config.CommentStyle)
+			}
+			if d.Comment != tt.comment || d.CommentStyle != tt.style || d.Foreign != tt.foreign {
+				t.Errorf("Comment = %q in %+v (foreign %v), want %q in %+v (foreign %v)",
+					d.Comment, d.CommentStyle, d.Foreign, tt.comment, tt.style, tt.foreign)
+			}
+			if d.BOM != tt.bom || d.LF != tt.lf || d.CRLF != tt.crlf {
+				t.Errorf("BOM = %v, LF = %d, CRLF = %d; want %v, %d, %d", d.BOM, d.LF, d.CRLF, tt.bom, tt.lf, tt.crlf)
+			}
+			if tt.verifyErr != nil {
+				if !errors.Is(d.VerifyErr, tt.verifyErr) {
+					t.Errorf("VerifyErr = %v, want %v", d.VerifyErr, tt.verifyErr)
+				}
+			} else if d.VerifyErr != nil || !d.Verify.Valid {
+				t.Errorf("Verify = %+v, %v; want valid", d.Verify, d.VerifyErr)
+			}
+		})
+	}
+
+	if _, err := NewReader(DefaultConfig()).Diagnose(filepath.Join(t.TempDir(), "missing.go")); err == nil {
+		t.Error("Diagnose() of a missing file succeeded")
+	}
+}
+
+// FileIntegrity: AB92D80B
@@ -0,0 +1,132 @@
+package hashfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandStats counts the files ExpandPatternsDetailed left out.
+type ExpandStats struct {
+	Duplicates int // Files named by more than one pattern, listed once
+	Skipped    int // Files in walked directories without an allowed extension
+}
+
+// ExpandPatterns expands file names, glob patterns, and directories into a list of files,
+// in the order given, and returns how many duplicates it removed: a file named by several
+// overlapping patterns is listed once. Directories are walked recursively for files with one of exts
+// (e.g. ".go"), or with an extension in SupportedExtensions if exts is empty, so unknown
+// file types are never picked up; hidden files and directories are skipped without being
+// counted. Files named explicitly or by a glob are kept whatever their extension, and file
+// names without wildcards are kept even if they do not exist, so the caller reports them.
+func ExpandPatterns(patterns []string, exts ...string) ([]string, int, error) {
+	files, stats, err := ExpandPatternsDetailed(patterns, exts...)
+	return files, stats.Duplicates, err
+}
+
+// ExpandPatternsDetailed is ExpandPatterns, also counting the files in walked directories
+// skipped for their extension.
+func ExpandPatternsDetailed(patterns []string, exts ...string) ([]string, ExpandStats, error) {
+	var files []string
+	var stats ExpandStats
+	seen := make(map[string]bool)
+	add := func(file string) {
+		// "a.go" and "./a.go" name the same file
+		key := filepath.Clean(file)
+		if seen[key] {
+			stats.Duplicates++
+			return
+		}
+		seen[key] = true
+		files = append(files, file)
+	}
+
+	for _, pattern := range patterns {
+		// Walk directories given by name
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			found, skipped, err := walkDir(pattern, exts)
+			if err != nil {
+				return nil, ExpandStats{}, err
+			}
+			stats.Skipped += skipped
+			for _, file := range found {
+				add(file)
+			}
+			continue
+		}
+
+		// Check if it's a plain file (no wildcards)
+		if !containsWildcard(pattern) {
+			add(pattern)
+			continue
+		}
+
+		// Expand glob pattern
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, ExpandStats{}, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			// Only include regular files
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			add(match)
+		}
+	}
+
+	return files, stats, nil
+}
+
+// walkDir returns the regular files under dir with one of exts, or with a known comment
+// style if exts is empty, and how many files it skipped for their extension. Hidden files
+// and directories (such as .git) are skipped.
+func walkDir(dir string, exts []string) ([]string, int, error) {
+	allowed := make(map[string]bool)
+	if len(exts) == 0 {
+		for ext := range extensionStyles {
+			allowed[ext] = true
+		}
+	}
+	for _, ext := range exts {
+		allowed[ext] = true
+	}
+
+	var files []string
+	skipped := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if allowed[filepath.Ext(path)] {
+			files = append(files, path)
+		} else {
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	return files, skipped, nil
+}
+
+// containsWildcard checks if a string contains glob wildcards
+func containsWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// FileIntegrity: 5E970D18
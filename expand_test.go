@@ -0,0 +1,196 @@
+package hashfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestExpandPatterns ensures overlapping patterns yield each file once and count the duplicates
+func TestExpandPatterns(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt", "sub/d.py", "sub/e.unknown", ".hidden/f.go"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(names ...string) []string {
+		for i, name := range names {
+			names[i] = filepath.Join(dir, name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name       string
+		patterns   []string
+		exts       []string
+		want       []string
+		duplicates int
+		skipped    int
+	}{
+		{"plain files", join("a.go", "b.go"), nil, join("a.go", "b.go"), 0, 0},
+		{"missing file kept", join("missing.go"), nil, join("missing.go"), 0, 0},
+		{"overlapping globs", join("*.go", "a.*", "*"), nil, join("a.go", "b.go", "c.txt"), 3, 0},
+		{"repeated file", append(join("a.go"), filepath.Join(dir, ".", "a.go")), nil, join("a.go"), 1, 0},
+		{"directory", []string{dir}, nil, join("a.go", "b.go", "sub/d.py"), 0, 2},
+		{"directory and glob", append([]string{dir}, join("*.go")...), nil, join("a.go", "b.go", "sub/d.py"), 2, 2},
+		{"directory with extensions", []string{dir}, []string{".txt", ".unknown"}, join("c.txt", "sub/e.unknown"), 0, 3},
+		{"explicit file kept", join("c.txt"), []string{".go"}, join("c.txt"), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, duplicates, err := ExpandPatterns(tt.patterns, tt.exts...)
+			if err != nil {
+				t.Fatalf("ExpandPatterns() failed: %v", err)
+			}
+			if !slices.Equal(files, tt.want) {
+				t.Errorf("files = %v, want %v", files, tt.want)
+			}
+			if duplicates != tt.duplicates {
+				t.Errorf("duplicates = %d, want %d", duplicates, tt.duplicates)
+			}
+
+			detailed, stats, err := ExpandPatternsDetailed(tt.patterns, tt.exts...)
+			if err != nil {
+				t.Fatalf("ExpandPatternsDetailed() failed: %v", err)
+			}
+			if !slices.Equal(detailed, tt.want) {
+				t.Errorf("ExpandPatternsDetailed() files = %v, want %v", detailed, tt.want)
+			}
+			if stats.Duplicates != tt.duplicates {
+				t.Errorf("Duplicates = %d, want %d", stats.Duplicates, tt.duplicates)
+			}
+			if stats.Skipped != tt.skipped {
+				t.Errorf("Skipped = %d, want %d", stats.Skipped, tt.skipped)
+			}
+		})
+	}
+
+	if _, _, err := ExpandPatterns([]string{"[invalid"}); err == nil {
+		t.Error("ExpandPatterns() accepted an invalid pattern")
+	}
+}
+
+// TestExpandPatternsAllowlist ensures an extension allowlist picks only those languages from a
+// mixed tree and counts the rest as skipped
+func TestExpandPatternsAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"main.go", "util.go", "tool.py", "schema.sql", "app.js", "style.css", "README.md", "sub/x.go", "sub/y.rb"}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, stats, err := ExpandPatternsDetailed([]string{dir}, ".go", ".py", ".sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"main.go", "schema.sql", "sub/x.go", "tool.py", "util.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if stats.Skipped != 4 {
+		t.Errorf("Skipped = %d, want 4", stats.Skipped)
+	}
+}
+
+// TestVerifyMixedTree ensures one walk over generated output in several languages picks each
+// file's style by extension, so every file verifies and only a hand-edited one fails
+func TestVerifyMixedTree(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]struct {
+		content string
+		comment string
+	}{
+		"views.templ":        {"package views\n\ntempl Hello(name string) {\n\t<p>{ name }</p>\n}\n", "const FileIntegrity = \""},
+		"views_templ.go":     {"// Code generated by templ - DO NOT EDIT.\n\npackage views\n", "// FileIntegrity: "},
+		"static/site.css":    {"p {\n  color: red;\n}\n", "/* FileIntegrity: "},
+		"api/v1/api.pb.go":   {"// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage v1\n", "// FileIntegrity: "},
+		"api/v1/theme.css":   {"body { margin: 0 }", "/* FileIntegrity: "},
+		"api/v1/empty.templ": {"", "const FileIntegrity = \""},
+	}
+	for name, file := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, _, err := ExpandPatterns([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(files) {
+		t.Fatalf("ExpandPatterns() found %d files, want %d", len(paths), len(files))
+	}
+	for _, path := range paths {
+		if err := NewWriter(ConfigForFilename(path, DefaultConfig())).ProcessFile(path); err != nil {
+			t.Fatalf("ProcessFile(%s) failed: %v", path, err)
+		}
+	}
+
+	verify := func() []string {
+		var invalid []string
+		for _, path := range paths {
+			valid, err := NewReader(ConfigForFilename(path, DefaultConfig())).VerifyFile(path)
+			if err != nil {
+				t.Fatalf("VerifyFile(%s) failed: %v", path, err)
+			}
+			if !valid {
+				rel, _ := filepath.Rel(dir, path)
+				invalid = append(invalid, filepath.ToSlash(rel))
+			}
+		}
+		return invalid
+	}
+	if invalid := verify(); len(invalid) > 0 {
+		t.Errorf("Freshly stamped files failed verification: %v", invalid)
+	}
+	for name, file := range files {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		if last := lines[len(lines)-1]; !strings.HasPrefix(last, file.comment) {
+			t.Errorf("%s ends with %q, want a %q comment", name, last, file.comment)
+		}
+	}
+
+	// A hand edit after generation is reported, and nothing else
+	edited := filepath.Join(dir, "views.templ")
+	content, err := os.ReadFile(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(edited, bytes.Replace(content, []byte("<p>"), []byte("<p class=\"x\">"), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if invalid := verify(); !slices.Equal(invalid, []string{"views.templ"}) {
+		t.Errorf("Invalid files after editing views.templ = %v", invalid)
+	}
+}
+
+// FileIntegrity: D8759010
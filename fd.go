@@ -0,0 +1,81 @@
+package hashfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ProcessFd adds or updates the integrity comment of an already open file, for callers that
+// hold a file descriptor but cannot use paths, e.g. in a sandbox. f must be open for reading
+// and writing; it is read from the start, whatever its offset.
+//
+// Unlike ProcessFile, the file is rewritten in place rather than replaced through a temporary
+// file, so the change is not atomic: a failure or crash part way through can leave a partial
+// comment, and concurrent readers may see one. In exchange the file keeps its identity (inode,
+// hard links, open descriptors), and only the end of the file is rewritten, except in
+// ScriptMode, where the comment moves the whole script and the output is held in memory.
+func (w *Writer) ProcessFd(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if err := w.config.checkSize(info.Size()); err != nil {
+		return err
+	}
+	w = w.forFile(info)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek error: %w", err)
+	}
+
+	// Only the final window, at most one buffer, differs from the input
+	offset := max(info.Size()-int64(w.config.BufferSize), 0)
+	if w.config.scriptMode() {
+		offset = 0
+	}
+	tail := &tailWriter{skip: offset}
+	result, err := w.processStream(f, tail)
+	if err != nil {
+		return fmt.Errorf("failed to process stream: %w", err)
+	}
+	if !result.Changed {
+		w.config.notify(f.Name(), false)
+		return nil
+	}
+	if w.config.ReadOnly {
+		return fmt.Errorf("%w: %s", ErrReadOnly, f.Name())
+	}
+
+	if _, err := f.WriteAt(tail.buf, offset); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	if err := f.Truncate(offset + int64(len(tail.buf))); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+	w.config.notify(f.Name(), true)
+	return nil
+}
+
+// VerifyFd checks the integrity comment of an already open file, like VerifyFile. f is read
+// from the start, whatever its offset.
+func (r *Reader) VerifyFd(f *os.File) (bool, error) {
+	if r.config.MaxFileSize > 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return false, fmt.Errorf("failed to stat file: %w", err)
+		}
+		if err := r.config.checkSize(info.Size()); err != nil {
+			return false, err
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("seek error: %w", err)
+	}
+	reader, err := r.forFile(f)
+	if err != nil {
+		return false, err
+	}
+	return reader.Verify(f)
+}
+
+// FileIntegrity: CD6DB5EC
@@ -0,0 +1,103 @@
+package hashfile
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProcessFd ensures rewriting an open file in place matches ProcessFile
+func TestProcessFd(t *testing.T) {
+	large := strings.Repeat("// filler line\n", 1000)
+	tests := []struct {
+		name    string
+		content string
+		config  func(*Config)
+	}{
+		{"empty", "", nil},
+		{"new comment", "package main\n", nil},
+		{"correct comment", "package main\n// FileIntegrity: 7FE7DFB2\n", nil},
+		{"stale comment", "package main\n// FileIntegrity: DEADBEEF\n", nil},
+		{"shorter comment", "package main\n// FileIntegrity: DEADBEEF first=100000\n", nil},
+		{"crlf", "package main\r\n", nil},
+		{"larger than buffer", large, func(c *Config) { c.BufferSize = 4096 }},
+		{"stale larger than buffer", large + "// FileIntegrity: DEADBEEF first=100000\n", func(c *Config) { c.BufferSize = 4096 }},
+		{"script", "#!/bin/sh\necho hi\n", func(c *Config) { c.CommentStyle = ShellStyle; c.ScriptMode = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			dir := t.TempDir()
+			want := filepath.Join(dir, "want.go")
+			path := filepath.Join(dir, "fd.go")
+			for _, name := range []string{want, path} {
+				if err := os.WriteFile(name, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := NewWriter(config).ProcessFile(want); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+
+			f, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			// The offset does not matter
+			if _, err := f.Seek(3, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewWriter(config).ProcessFd(f); err != nil {
+				t.Fatalf("ProcessFd() failed: %v", err)
+			}
+			if valid, err := NewReader(config).VerifyFd(f); err != nil || !valid {
+				t.Errorf("VerifyFd() = %v, %v; want true", valid, err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := os.ReadFile(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(expected) {
+				t.Errorf("content = %q, want %q", got, expected)
+			}
+		})
+	}
+}
+
+// TestVerifyFd ensures an open file that changed after stamping fails verification
+func TestVerifyFd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(path, []byte("package main\n// FileIntegrity: DEADBEEF\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	valid, err := NewReader(DefaultConfig()).VerifyFd(f)
+	if err != nil || valid {
+		t.Errorf("VerifyFd() = %v, %v; want false, nil", valid, err)
+	}
+
+	// A read-only descriptor cannot be stamped
+	if err := NewWriter(DefaultConfig()).ProcessFd(f); err == nil {
+		t.Error("ProcessFd() succeeded on a read-only file")
+	}
+}
+
+// FileIntegrity: 57CC5BBB
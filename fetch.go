@@ -0,0 +1,59 @@
+package hashfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultFetchTimeout bounds a whole FetchSnapshot request when no client is given.
+const DefaultFetchTimeout = 30 * time.Second
+
+// ReadSnapshot decodes a snapshot in the JSON form written by `hashfile snapshot`: an object
+// whose "files" member maps slash-separated paths to digests of 8 hexadecimal digits, as
+// returned by TreeSnapshot. Anything else is reported as ErrNotSnapshot.
+func ReadSnapshot(src io.Reader) (map[string]string, error) {
+	var doc struct {
+		Files map[string]string `json:"files"`
+	}
+	if err := json.NewDecoder(src).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotSnapshot, err)
+	}
+	if doc.Files == nil {
+		return nil, fmt.Errorf("%w: no files member", ErrNotSnapshot)
+	}
+	for path, digest := range doc.Files {
+		if _, err := strconv.ParseUint(digest, 16, 32); err != nil || len(digest) != 8 {
+			return nil, fmt.Errorf("%w: invalid digest %q for %s", ErrNotSnapshot, digest, path)
+		}
+	}
+	return doc.Files, nil
+}
+
+// FetchSnapshot downloads a snapshot from url, such as one published alongside a release, and
+// decodes it with ReadSnapshot. A nil client uses one that gives up after DefaultFetchTimeout.
+// Network errors and responses other than 200 OK are returned as errors naming the url.
+func FetchSnapshot(client *http.Client, url string) (map[string]string, error) {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultFetchTimeout}
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch error: %s returned %s", url, resp.Status)
+	}
+
+	files, err := ReadSnapshot(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return files, nil
+}
+
+// FileIntegrity: 7EA89FB6
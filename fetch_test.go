@@ -0,0 +1,76 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFetchSnapshot ensures a served snapshot is decoded, and failed requests are reported
+func TestFetchSnapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/snap.json":
+			fmt.Fprint(w, `{"files": {"main.go": "3108335F", "sub/util.py": "8cdc1683"}}`)
+		case "/broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		case "/page.html":
+			fmt.Fprint(w, "<html></html>")
+		case "/empty.json":
+			fmt.Fprint(w, `{}`)
+		case "/bad-digest.json":
+			fmt.Fprint(w, `{"files": {"main.go": "not hex!"}}`)
+		case "/slow":
+			time.Sleep(time.Second)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	files, err := FetchSnapshot(nil, server.URL+"/snap.json")
+	if err != nil {
+		t.Fatalf("FetchSnapshot() failed: %v", err)
+	}
+	if len(files) != 2 || files["main.go"] != "3108335F" || files["sub/util.py"] != "8cdc1683" {
+		t.Errorf("FetchSnapshot() = %v", files)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		want        string
+		notSnapshot bool
+	}{
+		{"not found", "/missing.json", "404 Not Found", false},
+		{"server error", "/broken", "500 Internal Server Error", false},
+		{"not json", "/page.html", "not a snapshot", true},
+		{"no files", "/empty.json", "not a snapshot", true},
+		{"bad digest", "/bad-digest.json", `invalid digest "not hex!"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FetchSnapshot(nil, server.URL+tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || errors.Is(err, ErrNotSnapshot) != tt.notSnapshot {
+				t.Errorf("FetchSnapshot() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := FetchSnapshot(client, server.URL+"/slow"); err == nil || !strings.Contains(err.Error(), "fetch error") {
+		t.Errorf("FetchSnapshot() past the client timeout = %v, want a fetch error", err)
+	}
+
+	url := server.URL + "/snap.json"
+	server.Close()
+	if _, err := FetchSnapshot(nil, url); err == nil || !strings.Contains(err.Error(), "fetch error") {
+		t.Errorf("FetchSnapshot() from a closed server = %v, want a fetch error", err)
+	}
+}
+
+// FileIntegrity: 1BBB4C02
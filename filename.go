@@ -0,0 +1,42 @@
+package hashfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// DefaultFilenameHash matches a digest between dots in a base name, as in "app.77A81829.js".
+var DefaultFilenameHash = regexp.MustCompile(`\.([0-9A-Fa-f]{8})\.`)
+
+// VerifyFilenameHash reports whether the digest embedded in a file's base name, located with
+// config.FilenameHash, matches the file's content digest (see Reader.Digest). This checks
+// content-addressed build outputs whose names carry the digest hashfile computes; digests
+// of other algorithms never match. Names without a digest return ErrNoFilenameHash.
+func VerifyFilenameHash(filename string, config Config) (bool, error) {
+	pattern := config.FilenameHash
+	if pattern == nil {
+		pattern = DefaultFilenameHash
+	}
+	base := filepath.Base(filename)
+	match := pattern.FindStringSubmatch(base)
+	if len(match) < 2 {
+		return false, fmt.Errorf("%w: %s", ErrNoFilenameHash, base)
+	}
+	if len(match[1]) != 8 {
+		return false, fmt.Errorf("%w: %q in file name", ErrInvalidFormat, match[1])
+	}
+	stored, err := strconv.ParseUint(match[1], 16, 32)
+	if err != nil {
+		return false, fmt.Errorf("%w: %q in file name", ErrInvalidFormat, match[1])
+	}
+
+	crc, err := NewReader(config).Digest(filename)
+	if err != nil {
+		return false, err
+	}
+	return crc == uint32(stored), nil
+}
+
+// FileIntegrity: 34EA15BC
@@ -0,0 +1,65 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestVerifyFilenameHash ensures the digest in a file name is compared with the content digest
+func TestVerifyFilenameHash(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("console.log('hello');\n")
+	probe := filepath.Join(dir, "probe.js")
+	if err := os.WriteFile(probe, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	crc, err := NewReader(ConfigForExtension(".js")).Digest(probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("%08X", crc)
+
+	custom := regexp.MustCompile(`^([0-9a-f]{8})-`)
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		pattern *regexp.Regexp
+		want    bool
+		wantErr error
+	}{
+		{"match", "app." + digest + ".js", string(content), nil, true, nil},
+		{"lowercase", "app." + strings.ToLower(digest) + ".min.js", string(content), nil, true, nil},
+		{"changed", "app." + digest + ".js", "console.log('bye');\n", nil, false, nil},
+		{"stamped", "app." + digest + ".js", string(content) + "// FileIntegrity: " + digest + "\n", nil, true, nil},
+		{"custom pattern", strings.ToLower(digest) + "-app.js", string(content), custom, true, nil},
+		{"no hash", "app.js", string(content), nil, false, ErrNoFilenameHash},
+		{"short hash", "app.abc.js", string(content), regexp.MustCompile(`\.([0-9a-f]+)\.`), false, ErrInvalidFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := ConfigForExtension(".js")
+			config.FilenameHash = tt.pattern
+
+			got, err := VerifyFilenameHash(filename, config)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyFilenameHash() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyFilenameHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// FileIntegrity: CFB47239
@@ -9,25 +9,108 @@ package hashfile
 
 import (
 	"bufio"
-	"encoding/hex"
+	"bytes"
+	"errors"
 	"fmt"
+	"go/format"
 	"hash"
 	"hash/crc32"
 	"io"
+	"io/fs"
+	"maps"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 )
 
+// Errors returned by verification.
+var (
+	// ErrNoComment indicates the file has no integrity comment, including empty files.
+	ErrNoComment = errors.New("no integrity comment found")
+	// ErrInvalidFormat indicates an integrity comment whose CRC cannot be parsed.
+	ErrInvalidFormat = errors.New("invalid CRC format")
+	// ErrUnsupportedVersion indicates an integrity comment whose "vN:" format version token
+	// names a version this package cannot parse, such as one written by a newer release.
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	// ErrUnknownStyle indicates a comment style name that is not recognized.
+	ErrUnknownStyle = errors.New("unknown comment style")
+	// ErrAmbiguousComment indicates a line that looks like an integrity comment but is
+	// followed by other content, so it may not have been written by this package.
+	ErrAmbiguousComment = errors.New("integrity-like comment is not the last line")
+	// ErrTrailingData indicates content after the integrity comment, such as junk appended
+	// to a stamped file. Trailing whitespace is tolerated. An integrity-like line whose CRC
+	// does not match the content before it is not taken for a comment, so a file that merely
+	// contains one mid-file is reported as ErrNoComment instead.
+	ErrTrailingData = errors.New("data after integrity comment")
+	// ErrFileTooLarge indicates a file larger than Config.MaxFileSize, which is not read.
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrTempFileName indicates a file named like the temporary files used for atomic
+	// rewrites (".hashfile_*.tmp" with the default Config.TempPrefix), which is never
+	// modified in case it is a leftover.
+	ErrTempFileName = errors.New("file name matches the temporary file pattern")
+	// ErrNoFilenameHash indicates a file name without a digest for VerifyFilenameHash.
+	ErrNoFilenameHash = errors.New("no hash found in file name")
+	// ErrFileSwapped indicates that, with Config.NoFollow, the path of a file being rewritten
+	// was replaced by another file before the rewrite could be committed.
+	ErrFileSwapped = errors.New("file was replaced during rewrite")
+	// ErrFileChangedDuringRead indicates that, with Config.RetryOnChange, a file kept being
+	// modified while it was verified, so no consistent result could be obtained.
+	ErrFileChangedDuringRead = errors.New("file changed during read")
+	// ErrReadOnly indicates that, with Config.ReadOnly, a file would have been modified.
+	ErrReadOnly = errors.New("file would be modified in read-only mode")
+	// ErrNotSnapshot indicates that a document read by ReadSnapshot is not a snapshot.
+	ErrNotSnapshot = errors.New("not a snapshot")
+	// ErrCommentSyntax indicates that, as far as ValidateStampedSyntax can tell, an integrity
+	// comment is not a comment in the language of its file.
+	ErrCommentSyntax = errors.New("integrity comment is not a comment in the file's language")
+)
+
+// FormatError describes an integrity comment that is present but malformed.
+// It is only reported when Config.StrictFormat is set, and wraps ErrInvalidFormat.
+type FormatError struct {
+	Line   string // The offending comment line
+	Reason string // Which part of the comment is malformed
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("malformed integrity comment: %s", e.Reason)
+}
+
+func (e *FormatError) Unwrap() error {
+	return ErrInvalidFormat
+}
+
+// DefaultKey is the key that labels the checksum in integrity comments.
+const DefaultKey = "FileIntegrity"
+
+// DefaultTempPrefix starts the names of the temporary files used for rewrites, which end in
+// ".tmp".
+const DefaultTempPrefix = ".hashfile_"
+
 // CommentStyle defines the comment format for different programming languages.
 type CommentStyle struct {
 	Prefix            string // Comment prefix (e.g., "// " for Go/C)
 	Suffix            string // Comment suffix (e.g., " -->" for HTML, empty for most)
-	PrefixContainsKey bool   // If true, Prefix already includes "FileIntegrity" (e.g., for const declarations)
+	PrefixContainsKey bool   // If true, Prefix already includes the key (e.g., for const declarations)
 }
 
-// Predefined comment styles for common languages.
+// Markers bracketing a region excluded from the hash with Config.IgnoreMarkers, each written
+// alone in a comment line such as "// hashfile:ignore-start".
+const (
+	IgnoreStartMarker = "hashfile:ignore-start"
+	IgnoreEndMarker   = "hashfile:ignore-end"
+)
+
+// Predefined comment styles for common languages. Treat them as read-only: changing one
+// affects configurations created afterwards (e.g. by DefaultConfig), though never an
+// existing Writer or Reader, which hold their own copy.
 var (
 	GoStyle     = CommentStyle{Prefix: "// ", Suffix: "", PrefixContainsKey: false}
 	CStyle      = CommentStyle{Prefix: "// ", Suffix: "", PrefixContainsKey: false}
@@ -39,12 +122,253 @@ var (
 	JSStyle     = CommentStyle{Prefix: "// ", Suffix: "", PrefixContainsKey: false}
 	CSSStyle    = CommentStyle{Prefix: "/* ", Suffix: " */", PrefixContainsKey: false}
 	TemplStyle  = CommentStyle{Prefix: "const FileIntegrity = \"", Suffix: "\"", PrefixContainsKey: true}
+	MatlabStyle = CommentStyle{Prefix: "% ", Suffix: "", PrefixContainsKey: false}
+
+	// Diagram-as-code sources: Mermaid comments start with "%%" and D2 comments with "#".
+	// Neither renderer draws a trailing comment.
+	MermaidStyle = CommentStyle{Prefix: "%% ", Suffix: "", PrefixContainsKey: false}
+	D2Style      = CommentStyle{Prefix: "# ", Suffix: "", PrefixContainsKey: false}
+
+	// Legacy column-sensitive formats get a trailing comment line with their comment indicator:
+	// "!" for free-form Fortran, "C" in column 1 for fixed-form Fortran, and "*" in column 7
+	// (after the sequence area) for fixed-format COBOL. The comment fits within column 72.
+	FortranStyle      = CommentStyle{Prefix: "! ", Suffix: "", PrefixContainsKey: false}
+	FixedFortranStyle = CommentStyle{Prefix: "C ", Suffix: "", PrefixContainsKey: false}
+	COBOLStyle        = CommentStyle{Prefix: "      * ", Suffix: "", PrefixContainsKey: false}
 )
 
+// predefinedStyles lists each distinct predefined comment style.
+var predefinedStyles = []CommentStyle{GoStyle, PythonStyle, SQLStyle, HTMLStyle, CSSStyle, TemplStyle,
+	MatlabStyle, MermaidStyle, FortranStyle, FixedFortranStyle, COBOLStyle}
+
+// foreignPatterns match the integrity comments of every predefined style, so a comment
+// left behind by processing a file with a different style can be recognized.
+var foreignPatterns = func() []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(predefinedStyles))
+	for i, style := range predefinedStyles {
+		patterns[i] = createCommentPattern(style, DefaultKey)
+	}
+	return patterns
+}()
+
 // Config holds processing configuration.
 type Config struct {
 	CommentStyle CommentStyle
-	BufferSize   int // Buffer size for streaming (default 64KB)
+	BufferSize   int    // Buffer size for streaming (default 64KB)
+	Key          string // Key labelling the checksum (default DefaultKey)
+
+	// AcceptKeys lists additional keys whose comments are accepted, e.g. the previous key
+	// during a key migration. Verification accepts them as if they were Key; ProcessFile
+	// replaces them with a comment labelled Key, and RemoveComment removes them.
+	AcceptKeys []string
+
+	// NormalizeGo hashes the gofmt-normalized form of the content instead of the raw bytes,
+	// so reformatting a Go file does not invalidate its integrity comment. The content is
+	// buffered in memory to be formatted. Source that fails to parse is hashed raw.
+	NormalizeGo bool
+
+	// ParallelHash hashes large files in 1MB segments on separate goroutines and combines
+	// the results, which produces the same CRC as sequential hashing. Content under one
+	// segment is hashed sequentially. It has no effect when NormalizeGo is set.
+	ParallelHash bool
+
+	// MaxHashBytes, if positive, hashes only the first MaxHashBytes bytes of content, trading
+	// completeness for speed on very large files: changes after that point go undetected.
+	// The rest of the file is still read, but not hashed. The limit is recorded in the
+	// comment (e.g. "FileIntegrity: ABCD1234 first=1048576"), and verification uses the
+	// recorded limit even if it differs from this one, re-reading the file if needed.
+	MaxHashBytes int
+
+	// HeadTailBytes, if positive, hashes only the first and the last HeadTailBytes bytes of
+	// content, which still catches truncation, appended data and damage at either end, but not
+	// changes in between. The rest is read without being hashed, and the last bytes are held
+	// in memory until the end of the content is known. The number is recorded in the comment
+	// (e.g. "FileIntegrity: ABCD1234 ends=65536") and used for verification like the limit of
+	// MaxHashBytes, which cannot be set as well.
+	HeadTailBytes int
+
+	// MaxFileSize, if positive, makes ProcessFile and VerifyFile refuse files larger than
+	// MaxFileSize bytes with ErrFileTooLarge, checked before any content is read.
+	MaxFileSize int64
+
+	// MaxConcurrentBytes, if positive, bounds the total BufferSize of the files VerifyFiles
+	// verifies at once: a file waits for others to finish rather than exceed the budget.
+	// A file whose buffer alone exceeds the budget is verified on its own.
+	MaxConcurrentBytes int64
+
+	// IgnoreLines excludes lines matching the pattern (tested without their line ending)
+	// from the hash, so volatile sections such as build timestamps can change freely.
+	// Each line is buffered and matched individually, which slows hashing noticeably
+	// on large files.
+	IgnoreLines *regexp.Regexp
+
+	// IgnoreMarkers excludes regions bracketed by IgnoreStartMarker and IgnoreEndMarker lines
+	// from the hash, markers included, so volatile blocks such as generated banners can change
+	// freely. A marker line is a comment holding nothing but the marker, in CommentStyle or any
+	// predefined style, e.g. "// hashfile:ignore-start" or "<!-- hashfile:ignore-end -->"; a
+	// marker elsewhere in a line is content. A region that is never closed is hashed like
+	// other content, so a stray start marker cannot hide the rest of the file. Like
+	// IgnoreLines, it buffers content line by line, and an open region until it is closed.
+	IgnoreMarkers bool
+
+	// ExtensionOverrides maps file extensions (with the leading dot) to the comment style
+	// ConfigForFilename picks for them, ahead of the built-in mapping. It customizes detection
+	// for this configuration only, without changing ConfigForExtension.
+	ExtensionOverrides map[string]CommentStyle
+
+	// Retries is how many times ProcessFile, VerifyFile, and VerifyDetailed retry an operation
+	// that failed with a transient I/O error (EAGAIN, ETIMEDOUT, or EINTR), as network
+	// filesystems occasionally return, with a backoff starting at 10ms and doubling with
+	// each attempt. Other errors, such as a missing file or denied permission, fail at once.
+	// A rewrite that fails leaves the file untouched, so it is retried from the start.
+	Retries int
+
+	// RetryOnChange, if positive, makes VerifyFile and VerifyDetailed compare the file's size
+	// and modification time before and after reading it, and verify again, up to this many
+	// times, if either changed. A file still changing after that returns
+	// ErrFileChangedDuringRead rather than a misleading mismatch. Zero skips the check.
+	RetryOnChange int
+
+	// Namespace, if set, is hashed ahead of the content, so a file stamped in one project does
+	// not verify in another: content stamped under a namespace only verifies under the same
+	// namespace, and never under none. It is not recorded in the comment and does not count
+	// towards MaxHashBytes.
+	Namespace string
+
+	// FilenameHash locates the digest in a file's base name for VerifyFilenameHash. Its
+	// first submatch must be 8 hexadecimal digits. Defaults to DefaultFilenameHash.
+	FilenameHash *regexp.Regexp
+
+	// StrictFormat makes verification report a final line that mentions the key but
+	// does not match the comment style as a *FormatError instead of ErrNoComment.
+	StrictFormat bool
+
+	// PreserveModeline keeps a trailing editor modeline (e.g. "// vim: set ft=go:") as the
+	// last line by writing the integrity comment before it. The modeline is not hashed.
+	// Modelines longer than maxModelineSize bytes are treated as content.
+	PreserveModeline bool
+
+	// BlankLineBefore separates the integrity comment from the content with a blank line.
+	// The blank line is not part of the content CRC; it is only recognized as a separator
+	// while this option is set.
+	BlankLineBefore bool
+
+	// GeneratedMarker, if set, is a whole line written just before the integrity comment,
+	// after any BlankLineBefore separator, such as "// Code generated by gen.sh. DO NOT EDIT."
+	// for tools that look for Go's generated-code marker anywhere in a file. ProcessFile adds
+	// it once, and keeps it on later runs. Like the separator, it is not part of the content
+	// CRC, and only recognized while this option is set. The go command itself only honors the
+	// marker before the package clause, which a generator must write.
+	GeneratedMarker string
+
+	// NoFinalNewline writes the integrity comment as the last line without a line ending, for
+	// files that must not end with a newline. ProcessFile removes a line ending found after an
+	// existing comment. A comment followed by a preserved modeline keeps its line ending.
+	// Verification accepts comments with or without one either way.
+	NoFinalNewline bool
+
+	// FormatVersion selects the comment format written: 0 for the legacy unversioned format
+	// ("FileIntegrity: ABCD1234"), or 1 to prefix the digest with a version token
+	// ("FileIntegrity: v1:ABCD1234"). Verification accepts both. Version 1 is a CRC32 with
+	// 8 hex digits, like the legacy format; later versions may change the digest.
+	FormatVersion int
+
+	// LowercaseDigest writes the CRC in lowercase hexadecimal. Verification accepts either
+	// case; ProcessFile rewrites a comment whose case does not match this setting.
+	LowercaseDigest bool
+
+	// Force makes ProcessFile rewrite files even when the stored CRC already matches, e.g. to
+	// migrate line endings or the key. The file's modification time is updated.
+	Force bool
+
+	// NoClobber makes ProcessFile fail with ErrAmbiguousComment instead of appending a new
+	// comment when an integrity-like line is found that is not the last line of the file.
+	// Without it, such a line is hashed as content and reported through Warn.
+	NoClobber bool
+
+	// ScriptMode writes the integrity comment on the second line of files that start with a
+	// shebang, so it is not lost when lines are appended. The CRC covers everything except
+	// the comment line. It applies only to styles whose prefix starts with "#"; other files
+	// get a trailing comment as usual. Processing reads a script twice.
+	ScriptMode bool
+
+	// TempFileMode sets the permissions of the temporary file a rewrite is written to before
+	// it replaces the original. It defaults to the original file's permissions, so the file
+	// is never briefly more restrictive; the original permissions are restored either way.
+	TempFileMode os.FileMode
+
+	// TempDir is the directory temporary files for rewrites are created in, e.g. to keep them
+	// out of directories watched by build tools. Empty means the file's own directory, where
+	// the rename that replaces the file is atomic. If the rename fails because TempDir is on
+	// another filesystem (EXDEV), the file is overwritten with the new content instead, which
+	// is not atomic; should that fail, the temporary file is kept and named in the error, as
+	// the file may have been truncated. NoFollow disables this fallback.
+	TempDir string
+
+	// TempPrefix starts the base names of temporary files, which end in ".tmp", in case the
+	// default DefaultTempPrefix clashes with other tools or file watchers. Files named like
+	// temporary files are refused with ErrTempFileName, judged by this prefix.
+	TempPrefix string
+
+	// NoFollow hardens rewrites against symlink races in shared directories. The file is
+	// opened without following a symbolic link (O_NOFOLLOW on Unix), so a link is refused;
+	// the temporary file defaults to mode 0600 instead of the original permissions; and the
+	// rewrite fails with ErrFileSwapped if the path no longer names the opened file just
+	// before the rename. InPlace is ignored, since appending cannot be checked this way.
+	NoFollow bool
+
+	// InPlace makes ProcessFile append the comment directly to files that only need a
+	// comment added, instead of rewriting them through a temporary file. The file is still
+	// read once to compute the CRC, but not copied. The append is not atomic: a failure
+	// part way through can leave a partial comment. Other changes are always rewritten.
+	InPlace bool
+
+	// ReadOnly guarantees that nothing is written, for auditing immutable or read-only
+	// trees: a Writer reports a file that needs a change with ErrReadOnly instead of
+	// modifying it, and does not create the temporary file it otherwise uses to detect a
+	// no-op. Files whose comment is already correct succeed. Verification never writes.
+	ReadOnly bool
+
+	// SidecarDir, if set, keeps each file's digest in a sidecar file instead of an integrity
+	// comment in the file itself, for files that cannot be modified, such as read-only or
+	// binary files. The sidecar of "src/a.go" is "src/a.go.integrity" under SidecarDir ("."
+	// keeps it next to a file named by a relative path); an absolute path is placed below
+	// SidecarDir too, and a relative path leaving its directory through ".." is rejected. It
+	// holds a single comment line without delimiters, e.g. "FileIntegrity: ABCD1234".
+	// ProcessFile writes the sidecar, leaving the file untouched, VerifyFile and
+	// VerifyDetailed check the file against it, HasComment reports whether it exists, and
+	// RemoveComment deletes it. The digest is the one Reader.Digest computes, so it ignores
+	// any comment the file carries. Other methods work on the file itself as usual.
+	SidecarDir string
+
+	// IncludePermBits mixes the file's permission bits into the hash, so a change such as
+	// chmod +x invalidates verification. This couples the hash to filesystem metadata: a
+	// file copied or archived without its permissions (zip, some CI caches, or git, which
+	// only records the executable bit) no longer verifies. Only methods that open the file
+	// themselves know its permissions; methods taking a stream, such as Process and Verify,
+	// hash as if it were unset.
+	IncludePermBits bool
+
+	// StampCache, if set, lets ProcessFile skip files whose size and modification time are
+	// unchanged since it last stamped them, or found them correctly stamped, with the same
+	// settings, without opening them. Skipped files count as no-ops. Modification times can
+	// lie, so an edit can be missed; see StampCache. Force bypasses the cache. Copies of the
+	// Config share the cache.
+	StampCache *StampCache
+
+	// Warn, if set, receives non-fatal warnings (e.g. Go source that could not be normalized).
+	Warn func(msg string)
+
+	// OnModified and OnNoOp, if set, are called with the path of each file ProcessFile,
+	// ProcessFiles, or ProcessFd stamps successfully: OnModified when the file was changed,
+	// OnNoOp when its comment was already correct, e.g. to skip downstream build steps.
+	// They are not called for files that fail. A Writer shared between goroutines calls
+	// them concurrently.
+	OnModified func(path string)
+	OnNoOp     func(path string)
+
+	perm *os.FileMode // Permission bits of the file being hashed, for IncludePermBits
+	tee  io.Writer    // Receives the transformed content as it is hashed, for HashedContent
 }
 
 // DefaultConfig returns configuration with Go-style comments and standard buffer size.
@@ -55,52 +379,395 @@ func DefaultConfig() Config {
 	}
 }
 
+// Clone returns a copy of c. CommentStyle is held by value, and AcceptKeys, ExtensionOverrides
+// and IgnoreLines are copied. The only mutable state the copy shares with c is StampCache,
+// which is safe for concurrent use and meant to be shared.
+func (c Config) Clone() Config {
+	if c.IgnoreLines != nil {
+		// Longest changes a Regexp in place, so the copy gets its own
+		ignoreLines := *c.IgnoreLines
+		c.IgnoreLines = &ignoreLines
+	}
+	c.AcceptKeys = slices.Clone(c.AcceptKeys)
+	c.ExtensionOverrides = maps.Clone(c.ExtensionOverrides)
+	return c
+}
+
+// Validate reports configuration that cannot be processed, such as a BufferSize too small
+// to hold the sliding window that contains the integrity comment.
+func (c Config) Validate() error {
+	if minSize := c.windowSize() + 1; c.BufferSize < minSize {
+		return fmt.Errorf("buffer size %d is below the minimum of %d bytes", c.BufferSize, minSize)
+	}
+	if c.MaxHashBytes < 0 {
+		return fmt.Errorf("negative MaxHashBytes %d", c.MaxHashBytes)
+	}
+	if c.HeadTailBytes < 0 {
+		return fmt.Errorf("negative HeadTailBytes %d", c.HeadTailBytes)
+	}
+	if c.MaxHashBytes > 0 && c.HeadTailBytes > 0 {
+		return errors.New("MaxHashBytes and HeadTailBytes cannot both be set")
+	}
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("negative MaxFileSize %d", c.MaxFileSize)
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("negative Retries %d", c.Retries)
+	}
+	if c.RetryOnChange < 0 {
+		return fmt.Errorf("negative RetryOnChange %d", c.RetryOnChange)
+	}
+	if strings.ContainsAny(c.GeneratedMarker, "\r\n") {
+		return fmt.Errorf("GeneratedMarker %q is not a single line", c.GeneratedMarker)
+	}
+	if strings.ContainsAny(c.TempPrefix, `/\`) {
+		return fmt.Errorf("TempPrefix %q contains a path separator", c.TempPrefix)
+	}
+	if c.FormatVersion < 0 || c.FormatVersion > 1 {
+		return fmt.Errorf("unsupported FormatVersion %d", c.FormatVersion)
+	}
+	return nil
+}
+
+// formatDigest formats crc as eight hexadecimal digits in the configured case.
+func (c Config) formatDigest(crc uint32) string {
+	if c.LowercaseDigest {
+		return fmt.Sprintf("%08x", crc)
+	}
+	return fmt.Sprintf("%08X", crc)
+}
+
+// hashedLen returns how many of n content bytes are hashed, given MaxHashBytes or
+// HeadTailBytes.
+func (c Config) hashedLen(n int64) int64 {
+	if c.MaxHashBytes > 0 {
+		return min(n, int64(c.MaxHashBytes))
+	}
+	if c.HeadTailBytes > 0 {
+		return min(n, 2*int64(c.HeadTailBytes))
+	}
+	return n
+}
+
+// checkSize returns ErrFileTooLarge if size exceeds MaxFileSize.
+func (c Config) checkSize(size int64) error {
+	if c.MaxFileSize > 0 && size > c.MaxFileSize {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrFileTooLarge, size, c.MaxFileSize)
+	}
+	return nil
+}
+
+// extensionStyles maps file extensions to their comment styles.
+var extensionStyles = map[string]CommentStyle{
+	".go":      GoStyle,
+	".c":       CStyle,
+	".h":       CStyle,
+	".cpp":     CStyle,
+	".mm":      CStyle,
+	".m":       CStyle, // Objective-C; MATLAB also uses .m, see MatlabStyle
+	".hpp":     CStyle,
+	".cc":      CStyle,
+	".cxx":     CStyle,
+	".java":    CStyle,
+	".js":      CStyle,
+	".ts":      CStyle,
+	".jsx":     CStyle,
+	".tsx":     CStyle,
+	".proto":   CStyle,
+	".graphql": CStyle,
+	".gql":     CStyle,
+	".dart":    CStyle,
+	".jsonc":   CStyle,
+	".json5":   CStyle,
+	".py":      PythonStyle,
+	".sql":     SQLStyle,
+	".html":    HTMLStyle,
+	".htm":     HTMLStyle,
+	".xml":     HTMLStyle,
+	".sh":      ShellStyle,
+	".bash":    ShellStyle,
+	".rb":      RubyStyle,
+	".css":     CSSStyle,
+	".scss":    CSSStyle,
+	".sass":    CSSStyle,
+	".templ":   TemplStyle,
+	".matlab":  MatlabStyle,
+	".mmd":     MermaidStyle,
+	".mermaid": MermaidStyle,
+	".d2":      D2Style,
+	".f90":     FortranStyle,
+	".f95":     FortranStyle,
+	".f":       FixedFortranStyle,
+	".for":     FixedFortranStyle,
+	".cob":     COBOLStyle,
+	".cbl":     COBOLStyle,
+}
+
 // ConfigForExtension returns a Config with appropriate comment style for the given file extension.
 // Returns DefaultConfig for unknown extensions.
 func ConfigForExtension(ext string) Config {
 	config := DefaultConfig()
+	if style, ok := extensionStyles[ext]; ok {
+		config.CommentStyle = style
+	}
+	return config
+}
+
+// ConfigForFilename returns base with the comment style for filename's extension, looked up
+// in base.ExtensionOverrides first and then in the built-in mapping. Other settings are kept,
+// as is the comment style of base for unknown extensions.
+func ConfigForFilename(filename string, base Config) Config {
+	ext := filepath.Ext(filename)
+	if style, ok := base.ExtensionOverrides[ext]; ok {
+		base.CommentStyle = style
+	} else if style, ok := extensionStyles[ext]; ok {
+		base.CommentStyle = style
+	}
+	return base
+}
+
+// styleNames maps comment style names (as accepted by the CLI -style flag) to their styles.
+var styleNames = map[string]CommentStyle{
+	"go":         GoStyle,
+	"python":     PythonStyle,
+	"py":         PythonStyle,
+	"c":          CStyle,
+	"cpp":        CStyle,
+	"java":       CStyle,
+	"js":         JSStyle,
+	"javascript": JSStyle,
+	"sql":        SQLStyle,
+	"html":       HTMLStyle,
+	"xml":        HTMLStyle,
+	"shell":      ShellStyle,
+	"sh":         ShellStyle,
+	"bash":       ShellStyle,
+	"ruby":       RubyStyle,
+	"rb":         RubyStyle,
+	"css":        CSSStyle,
+	"cblock":     CSSStyle,
+	"templ":      TemplStyle,
+	"objc":       CStyle,
+	"matlab":     MatlabStyle,
+	"mermaid":    MermaidStyle,
+	"mmd":        MermaidStyle,
+	"d2":         D2Style,
+	"fortran":    FortranStyle,
+	"f77":        FixedFortranStyle,
+	"cobol":      COBOLStyle,
+}
+
+// ConfigForStyleName returns a Config with the comment style registered under name
+// (e.g. "go", "python", "html"). Unknown names return an error wrapping ErrUnknownStyle.
+func ConfigForStyleName(name string) (Config, error) {
+	style, ok := styleNames[name]
+	if !ok {
+		return Config{}, fmt.Errorf("%w: %q", ErrUnknownStyle, name)
+	}
+	config := DefaultConfig()
+	config.CommentStyle = style
+	return config, nil
+}
 
-	switch ext {
-	case ".go":
-		config.CommentStyle = GoStyle
-	case ".c", ".h", ".cpp", ".hpp", ".cc", ".cxx", ".java", ".js", ".ts", ".jsx", ".tsx":
-		config.CommentStyle = CStyle
-	case ".py":
-		config.CommentStyle = PythonStyle
-	case ".sql":
-		config.CommentStyle = SQLStyle
-	case ".html", ".htm", ".xml":
-		config.CommentStyle = HTMLStyle
-	case ".sh", ".bash":
-		config.CommentStyle = ShellStyle
-	case ".rb":
-		config.CommentStyle = RubyStyle
-	case ".css", ".scss", ".sass":
-		config.CommentStyle = CSSStyle
-	case ".templ":
-		config.CommentStyle = TemplStyle
+// SupportedStyles returns the style names accepted by ConfigForStyleName, sorted.
+func SupportedStyles() []string {
+	names := make([]string, 0, len(styleNames))
+	for name := range styleNames {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	return config
+// RegisterExtension maps a file extension, such as ".vue", to a comment style, adding to or
+// replacing the built-in mapping used by ConfigForExtension, ConfigForFilename, directory
+// walks and SupportedExtensions. Registration is not synchronized with those lookups, so call
+// it during initialization, e.g. from an init function. The extension must start with "."
+// and the style must have a Prefix.
+func RegisterExtension(ext string, style CommentStyle) error {
+	if len(ext) < 2 || ext[0] != '.' || strings.ContainsAny(ext[1:], `./\`) {
+		return fmt.Errorf("invalid extension %q", ext)
+	}
+	if style.Prefix == "" {
+		return fmt.Errorf("comment style for %s has no prefix", ext)
+	}
+	extensionStyles[ext] = style
+	return nil
+}
+
+// SupportedExtensions returns the extension-to-style mapping used by ConfigForExtension,
+// including extensions added with RegisterExtension. The returned map is a copy and may be
+// modified by the caller.
+func SupportedExtensions() map[string]CommentStyle {
+	exts := make(map[string]CommentStyle, len(extensionStyles))
+	for ext, style := range extensionStyles {
+		exts[ext] = style
+	}
+	return exts
+}
+
+// withPerm returns c with the permission bits of info to hash, if IncludePermBits is set.
+func (c Config) withPerm(info os.FileInfo) Config {
+	if c.IncludePermBits {
+		perm := info.Mode().Perm()
+		c.perm = &perm
+	}
+	return c
+}
+
+// newHasher returns the hash used to checksum file content.
+func (c Config) newHasher() hash.Hash32 {
+	var hasher hash.Hash32 = crc32.NewIEEE()
+	if c.ParallelHash {
+		hasher = newParallelHash()
+	}
+	// The namespace and permission bits go beneath the filters and the limit, which apply
+	// to content only
+	prefix := []byte(c.Namespace)
+	if c.IncludePermBits && c.perm != nil {
+		prefix = append(prefix, byte(*c.perm>>8), byte(*c.perm))
+	}
+	hasher.Write(prefix)
+	if c.tee != nil {
+		hasher = &teeHash{Hash32: hasher, out: c.tee}
+	}
+	if c.NormalizeGo {
+		hasher = &normalizingHash{seed: crc32.ChecksumIEEE(prefix), warn: c.Warn, out: c.tee}
+	}
+	if c.IgnoreLines != nil || c.IgnoreMarkers {
+		filter := &lineFilterHash{pattern: c.IgnoreLines, next: hasher}
+		if c.IgnoreMarkers {
+			filter.markers = append([]CommentStyle{c.CommentStyle}, predefinedStyles...)
+		}
+		hasher = filter
+	}
+	if c.MaxHashBytes > 0 {
+		hasher = &limitHash{limit: int64(c.MaxHashBytes), next: hasher}
+	}
+	if c.HeadTailBytes > 0 {
+		hasher = &headTailHash{n: int64(c.HeadTailBytes), next: hasher}
+	}
+	return hasher
+}
+
+// maxModelineSize is the longest trailing modeline that PreserveModeline recognizes.
+const maxModelineSize = 200
+
+// modelinePattern matches vim and emacs modelines.
+var modelinePattern = regexp.MustCompile(`(?:^|\s)(?:vi|vim|Vim|ex):|-\*-.+-\*-`)
+
+// maxTrailingBlanks is how many spaces or tabs after a comment are guaranteed to be tolerated;
+// the pattern accepts more, as long as the comment still fits in the window.
+const maxTrailingBlanks = 8
+
+// windowSize returns the size of the sliding window kept back from hashing. It is large
+// enough to hold the comment of this or any predefined style, plus a preceding CRLF and
+// trailing blanks an editor may have added.
+func (c Config) windowSize() int {
+	size := c.maxCommentSize()
+	for _, style := range predefinedStyles {
+		size = max(size, Config{CommentStyle: style}.maxCommentSize())
+	}
+	for _, key := range c.AcceptKeys {
+		size = max(size, Config{CommentStyle: c.CommentStyle, Key: key}.maxCommentSize())
+	}
+	if c.PreserveModeline {
+		size += maxModelineSize
+	}
+	if c.BlankLineBefore {
+		size += 2 // Separating CRLF
+	}
+	if c.GeneratedMarker != "" {
+		size += len(c.GeneratedMarker) + 2
+	}
+	return size + maxTrailingBlanks + 2
 }
 
 // maxCommentSize calculates the maximum possible size of an integrity comment.
-// Format: "prefix + FileIntegrity: + 8hex + suffix + CRLF"
+// Format: "prefix + key: + 8hex + suffix + CRLF"
 func (c Config) maxCommentSize() int {
-	return len(c.CommentStyle.Prefix) + len("FileIntegrity: ") + 8 + len(c.CommentStyle.Suffix) + 2
+	style := c.style()
+	return len(style.Prefix) + len(c.key()) + len(": ") + len("v1:") + 8 + len(" first=") + 19 + len(style.Suffix) + 2
+}
+
+// trimSeparator removes the GeneratedMarker line and the blank line written between content
+// and comment when they are configured. content is everything before the comment.
+func (c Config) trimSeparator(content []byte) []byte {
+	content, _ = c.trimMarker(content)
+	if !c.BlankLineBefore {
+		return content
+	}
+	line := trimLineEnding(content)
+	if len(line) < len(content) && len(trimLineEnding(line)) < len(line) {
+		return line
+	}
+	return content
+}
+
+// trimMarker removes the GeneratedMarker line from the end of content, reporting whether it
+// was there. content is everything before the comment.
+func (c Config) trimMarker(content []byte) ([]byte, bool) {
+	if c.GeneratedMarker == "" {
+		return content, false
+	}
+	line := trimLineEnding(content)
+	rest, ok := bytes.CutSuffix(line, []byte(c.GeneratedMarker))
+	if len(line) == len(content) || !ok || len(rest) > 0 && rest[len(rest)-1] != '\n' {
+		return content, false
+	}
+	return rest, true
+}
+
+// tempPrefix returns the configured temporary file prefix, or DefaultTempPrefix if none is set.
+func (c Config) tempPrefix() string {
+	if c.TempPrefix == "" {
+		return DefaultTempPrefix
+	}
+	return c.TempPrefix
+}
+
+// key returns the configured key, or DefaultKey if none is set.
+func (c Config) key() string {
+	if c.Key == "" {
+		return DefaultKey
+	}
+	return c.Key
+}
+
+// keys returns the configured key followed by AcceptKeys.
+func (c Config) keys() []string {
+	return append([]string{c.key()}, c.AcceptKeys...)
+}
+
+// style returns the comment style with the configured key substituted into
+// prefixes that contain it.
+func (c Config) style() CommentStyle {
+	style := c.CommentStyle
+	if style.PrefixContainsKey && c.key() != DefaultKey {
+		style.Prefix = strings.Replace(style.Prefix, DefaultKey, c.key(), 1)
+	}
+	return style
 }
 
 // Writer processes files using efficient streaming algorithm.
 type Writer struct {
-	config  Config
-	pattern *regexp.Regexp // Pre-compiled pattern for performance
+	config   Config
+	pattern  *regexp.Regexp // Pre-compiled pattern for performance
+	accepted *regexp.Regexp // Also matches comments labelled with AcceptKeys
+
+	mu    sync.Mutex
+	keyed map[string]*Writer // Writers for keys other than the configured one
+
+	buffers sync.Pool // *[]byte streaming buffers of BufferSize bytes, reused across files
 }
 
 // NewWriter creates a Writer with the given configuration.
 func NewWriter(config Config) *Writer {
+	config = config.Clone()
 	return &Writer{
-		config:  config,
-		pattern: createCommentPattern(config.CommentStyle),
+		config:   config,
+		pattern:  createCommentPattern(config.CommentStyle, config.key()),
+		accepted: createCommentPattern(config.CommentStyle, config.keys()...),
 	}
 }
 
@@ -109,22 +776,319 @@ func NewWriter(config Config) *Writer {
 // the file if the integrity comment is missing or incorrect.
 // File attributes (permissions, ownership) are preserved.
 func (w *Writer) ProcessFile(filename string) error {
-	// Get original file info for attribute preservation
-	origInfo, err := os.Stat(filename)
+	_, err := w.processFile(filename, nil)
+	return err
+}
+
+// ProcessFileInfo is like ProcessFile, but uses info instead of calling os.Stat, saving a
+// system call per file when the caller has already stat'ed it. The caller is responsible
+// for info being current: it determines the permissions and ownership the file keeps.
+func (w *Writer) ProcessFileInfo(filename string, info os.FileInfo) error {
+	_, err := w.processFile(filename, info)
+	return err
+}
+
+func (w *Writer) processFile(filename string, info os.FileInfo) (ProcessResult, error) {
+	result, err := retry(w.config.Retries, func() (ProcessResult, error) {
+		return w.processFileOnce(filename, info)
+	})
+	if err == nil {
+		if w.config.StampCache != nil {
+			w.config.StampCache.record(filename, w.config)
+		}
+		w.config.notify(filename, result.Changed)
+	}
+	return result, err
+}
+
+// notify calls the OnModified or OnNoOp hook for a file processed successfully.
+func (c Config) notify(path string, changed bool) {
+	if changed && c.OnModified != nil {
+		c.OnModified(path)
+	} else if !changed && c.OnNoOp != nil {
+		c.OnNoOp(path)
+	}
+}
+
+func (w *Writer) processFileOnce(filename string, info os.FileInfo) (ProcessResult, error) {
+	if w.config.isTempName(filename) {
+		return ProcessResult{}, fmt.Errorf("%w: %s", ErrTempFileName, filename)
+	}
+	if info == nil {
+		var err error
+		if info, err = os.Stat(filename); err != nil {
+			return ProcessResult{}, fmt.Errorf("failed to stat source file: %w", err)
+		}
+	}
+	if w.config.StampCache != nil && !w.config.Force && w.config.StampCache.unchanged(filename, info, w.config) {
+		return ProcessResult{}, nil
+	}
+	if err := w.config.checkSize(info.Size()); err != nil {
+		return ProcessResult{}, err
+	}
+	if w.config.SidecarDir != "" {
+		return w.processSidecar(filename, info)
+	}
+	w = w.forFile(info)
+
+	if w.config.InPlace && !w.config.NoFollow {
+		return w.processInPlace(filename, info)
+	}
+	return w.rewrite(filename, info)
+}
+
+// forFile returns a Writer for the file described by info: w itself, unless the file's
+// permission bits must be hashed.
+func (w *Writer) forFile(info os.FileInfo) *Writer {
+	if !w.config.IncludePermBits {
+		return w
+	}
+	return NewWriter(w.config.withPerm(info))
+}
+
+// rewrite replaces the file with its processed content through a temporary file.
+func (w *Writer) rewrite(filename string, info os.FileInfo) (ProcessResult, error) {
+	var result ProcessResult
+	err := w.config.rewriteFile(filename, info, func(src io.Reader, dst io.Writer) (bool, error) {
+		var err error
+		result, err = w.processStream(src, dst)
+		return !result.Changed, err
+	})
+	return result, err
+}
+
+// ProcessResult describes the change ProcessFile makes to a file.
+type ProcessResult struct {
+	Changed    bool // The integrity comment is missing or incorrect
+	AppendOnly bool // The change only appends to the file, leaving existing bytes untouched
+
+	// HashedBytes is the number of content bytes covered by the CRC: the content without its
+	// comment, separator, or final line ending, before IgnoreLines filtering and up to
+	// MaxHashBytes. It helps diagnose content that was stripped unexpectedly.
+	HashedBytes int64
+}
+
+// Process copies content from src to dst with its integrity comment added or updated, for
+// content that is not in a file, such as a blob held in memory. Unlike ProcessFile, dst
+// receives the full content even when the comment is already correct.
+func (w *Writer) Process(src io.Reader, dst io.Writer) (ProcessResult, error) {
+	return w.processStream(src, dst)
+}
+
+// Inspect reports the change ProcessFile would make to a file, without modifying it.
+// A file without any integrity comment is usually AppendOnly; replacing an existing
+// comment or writing before a preserved modeline is not.
+func (w *Writer) Inspect(filename string) (ProcessResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	if w.config.IncludePermBits {
+		info, err := file.Stat()
+		if err != nil {
+			return ProcessResult{}, fmt.Errorf("failed to stat file: %w", err)
+		}
+		w = w.forFile(info)
+	}
+
+	return w.processStream(file, io.Discard)
+}
+
+// processInPlace appends the comment to the file when the change is append-only,
+// and falls back to a full rewrite otherwise.
+func (w *Writer) processInPlace(filename string, info os.FileInfo) (ProcessResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to open source file: %w", err)
+	}
+
+	// The output of an append-only change is the file followed by the bytes to append
+	tail := &tailWriter{skip: info.Size()}
+	result, err := w.processStream(file, tail)
+	file.Close()
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to process stream: %w", err)
+	}
+	if !result.Changed {
+		return result, nil
+	}
+	if !result.AppendOnly {
+		return w.rewrite(filename, info)
+	}
+	if w.config.ReadOnly {
+		return result, fmt.Errorf("%w: %s", ErrReadOnly, filename)
+	}
+
+	dst, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to open file for append: %w", err)
+	}
+	if _, err := dst.Write(tail.buf); err != nil {
+		dst.Close()
+		return ProcessResult{}, fmt.Errorf("failed to append comment: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to append comment: %w", err)
+	}
+	return result, nil
+}
+
+// tailWriter discards the first skip bytes written to it and keeps the rest.
+type tailWriter struct {
+	skip int64
+	buf  []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if t.skip > 0 {
+		drop := min(t.skip, int64(len(p)))
+		t.skip -= drop
+		p = p[drop:]
+	}
+	t.buf = append(t.buf, p...)
+	return n, nil
+}
+
+// RemoveComment strips the integrity comment from a file, reporting whether one was found.
+// Files without a comment are left untouched. The line ending that preceded the comment
+// is kept, and a preserved modeline stays in place. With SidecarDir, the file's sidecar is
+// deleted instead.
+func (w *Writer) RemoveComment(filename string) (bool, error) {
+	if w.config.isTempName(filename) {
+		return false, fmt.Errorf("%w: %s", ErrTempFileName, filename)
+	}
+	if w.config.SidecarDir != "" {
+		return w.removeSidecar(filename)
+	}
+	var removed bool
+	err := w.config.rewriteFile(filename, nil, func(src io.Reader, dst io.Writer) (bool, error) {
+		var err error
+		removed, err = w.removeStream(src, dst)
+		return !removed, err
+	})
+	return removed, err
+}
+
+// StripComment returns content without its integrity comment, and whether one was found,
+// like RemoveComment but in memory. The blank line written with BlankLineBefore is removed
+// too. Content without a comment is returned as is.
+func StripComment(content []byte, config Config) ([]byte, bool) {
+	var buf bytes.Buffer
+	// removeStream only fails when reading src or writing dst fails, which a bytes.Reader and
+	// a bytes.Buffer never do. Should that change, the content is left as it is rather than
+	// returned partly copied.
+	removed, err := NewWriter(config).removeStream(bytes.NewReader(content), &buf)
+	if err != nil || !removed {
+		return content, false
+	}
+	return buf.Bytes(), true
+}
+
+// removeStream copies src to dst without its integrity comment.
+// Returns false if there was no comment to remove.
+func (w *Writer) removeStream(src io.Reader, dst io.Writer) (bool, error) {
+	if w.config.scriptMode() {
+		reader := bufio.NewReaderSize(src, w.config.BufferSize)
+		header, ok, err := readScriptHeader(reader, w.accepted)
+		if err != nil {
+			return false, err
+		}
+		if ok && header.comment != nil {
+			return true, removeScriptComment(header, reader, dst)
+		}
+		// Look for a trailing comment instead, in the content as read so far
+		src = io.MultiReader(bytes.NewReader(header.shebang), reader)
+	}
+
+	writer := bufio.NewWriter(dst)
+	reader := &Reader{config: w.config, pattern: w.accepted}
+
+	_, window, _, err := reader.scanStream(src, writer)
 	if err != nil {
-		return fmt.Errorf("failed to stat source file: %w", err)
+		return false, err
+	}
+
+	var modeline []byte
+	if w.config.PreserveModeline {
+		window, modeline = splitModeline(window)
+	}
+
+	match, _ := findComment(w.accepted, window)
+	if match == nil {
+		return false, nil
+	}
+
+	if _, err := writer.Write(w.config.trimSeparator(window[:match[0]])); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	if _, err := writer.Write(modeline); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	return true, nil
+}
+
+// rewriteFile streams a file through rewrite into a temporary file in the same directory,
+// then atomically replaces the original. If rewrite reports a no-op, the original is left
+// untouched. File attributes (permissions, ownership) are preserved.
+func (c Config) rewriteFile(filename string, origInfo os.FileInfo, rewrite func(src io.Reader, dst io.Writer) (bool, error)) error {
+	// Get original file info for attribute preservation, unless the caller has it. With
+	// NoFollow it comes from the opened file instead, since the path may name a symlink.
+	if origInfo == nil && !c.NoFollow {
+		var err error
+		if origInfo, err = os.Stat(filename); err != nil {
+			return fmt.Errorf("failed to stat source file: %w", err)
+		}
 	}
 
 	// Open source file
-	src, err := os.Open(filename)
+	open := os.Open
+	if c.NoFollow {
+		open = openNoFollow
+	}
+	src, err := open(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer src.Close()
 
-	// Create temporary output file in same directory for atomic replacement
-	dir := filepath.Dir(filename)
-	dst, err := os.CreateTemp(dir, ".hashfile_*.tmp")
+	if c.NoFollow {
+		if origInfo, err = src.Stat(); err != nil {
+			return fmt.Errorf("failed to stat source file: %w", err)
+		}
+		if !origInfo.Mode().IsRegular() {
+			return fmt.Errorf("failed to open source file: %s is not a regular file", filename)
+		}
+	}
+
+	if c.ReadOnly {
+		isNoOp, err := rewrite(src, io.Discard)
+		if err != nil {
+			return fmt.Errorf("failed to process stream: %w", err)
+		}
+		if !isNoOp {
+			return fmt.Errorf("%w: %s", ErrReadOnly, filename)
+		}
+		return nil
+	}
+
+	// Create temporary output file, by default in the same directory for atomic replacement
+	tempMode := c.TempFileMode
+	if tempMode == 0 && c.NoFollow {
+		tempMode = 0600
+	}
+	if tempMode == 0 {
+		tempMode = origInfo.Mode().Perm()
+	}
+	tempDir := c.TempDir
+	if tempDir == "" {
+		tempDir = filepath.Dir(filename)
+	}
+	dst, err := createTemp(tempDir, c.tempPrefix(), tempMode)
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -139,8 +1103,8 @@ func (w *Writer) ProcessFile(filename string) error {
 		}
 	}()
 
-	// Process stream - returns true if no-op (existing CRC matches calculated CRC)
-	isNoOp, err := w.processStream(src, dst)
+	// Process stream - returns true if no-op (e.g. existing CRC matches calculated CRC)
+	isNoOp, err := rewrite(src, dst)
 	if err != nil {
 		return fmt.Errorf("failed to process stream: %w", err)
 	}
@@ -150,7 +1114,7 @@ func (w *Writer) ProcessFile(filename string) error {
 	dst.Close()
 
 	if isNoOp {
-		// File already has correct hash - no-op, delete temp file
+		// File needs no change - no-op, delete temp file
 		os.Remove(tmpName)
 		success = true
 		return nil
@@ -161,125 +1125,231 @@ func (w *Writer) ProcessFile(filename string) error {
 		return fmt.Errorf("failed to preserve attributes: %w", err)
 	}
 
+	// The path must still name the file that was read, not one swapped in since
+	if c.NoFollow {
+		current, err := os.Lstat(filename)
+		if err != nil || !os.SameFile(current, origInfo) {
+			return fmt.Errorf("%w: %s", ErrFileSwapped, filename)
+		}
+	}
+
 	// Atomic replace
-	if err := os.Rename(tmpName, filename); err != nil {
-		return fmt.Errorf("failed to replace file: %w", err)
+	if err := renameFile(tmpName, filename); err != nil {
+		if c.TempDir == "" || c.NoFollow || !errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("failed to replace file: %w", err)
+		}
+		if err := copyContent(tmpName, filename); err != nil {
+			// The file may be truncated, so the temporary file is the only complete copy
+			success = true
+			return fmt.Errorf("failed to replace file: %w; its new content is kept in %s", err, tmpName)
+		}
+		os.Remove(tmpName)
 	}
 
 	success = true
 	return nil
 }
 
-// processStream implements the efficient sliding window algorithm.
-// Returns true if no-op (file already has correct hash), false if file was modified.
-func (w *Writer) processStream(src io.Reader, dst io.Writer) (bool, error) {
-	windowSize := w.config.maxCommentSize() + 2 // +2 for potential CRLF before comment
-	buffer := make([]byte, w.config.BufferSize) // Single allocation
+// renameFile replaces files with their rewritten copy; tests replace it to simulate renames
+// across filesystems.
+var renameFile = os.Rename
 
-	hasher := crc32.NewIEEE()
-	writer := bufio.NewWriter(dst)
-	defer writer.Flush()
+// copyContent overwrites dst with the content of src, for when src cannot be renamed over
+// dst. dst keeps its identity and attributes. The copy is not atomic.
+func copyContent(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-	// First read - fill entire buffer
-	n, err := src.Read(buffer)
-	if err != nil && err != io.EOF {
-		return false, fmt.Errorf("read error: %w", err)
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
 	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
 
-	if n == 0 {
-		// Empty file - just add comment
-		if err := w.finalizeEmpty(writer, hasher); err != nil {
-			return false, err
-		}
-		return false, nil // Empty file always needs hash added
+// ProcessFileWithKey is like ProcessFile but labels the checksum with key instead of the
+// configured key. Patterns for each key are compiled once and cached, so a single Writer can
+// serve many keys efficiently. It is safe for concurrent use.
+func (w *Writer) ProcessFileWithKey(filename, key string) error {
+	return w.withKey(key).ProcessFile(filename)
+}
+
+// withKey returns a Writer identical to w but using key, creating and caching it on first use.
+func (w *Writer) withKey(key string) *Writer {
+	if key == w.config.key() {
+		return w
 	}
 
-	firstRead := true
-	eof := (err == io.EOF)
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	for !eof {
-		if firstRead {
-			// First read: CRC and write everything except last windowSize bytes
-			if n > windowSize {
-				writeLen := n - windowSize
-				if _, err := writer.Write(buffer[:writeLen]); err != nil {
-					return false, fmt.Errorf("write error: %w", err)
-				}
-				hasher.Write(buffer[:writeLen])
+	if kw, ok := w.keyed[key]; ok {
+		return kw
+	}
+	if w.keyed == nil {
+		w.keyed = make(map[string]*Writer)
+	}
+	config := w.config
+	config.Key = key
+	kw := NewWriter(config)
+	w.keyed[key] = kw
+	return kw
+}
 
-				// Slide window to start of buffer
-				copy(buffer, buffer[writeLen:n])
-				n = n - writeLen
-			}
-			firstRead = false
-		} else {
-			// Subsequent reads: CRC and write everything in buffer before window
-			// (the window is at buffer[0:n] from previous iteration)
-			if _, err := writer.Write(buffer[:n-windowSize]); err != nil {
-				return false, fmt.Errorf("write error: %w", err)
+// processStream implements the efficient sliding window algorithm.
+// The result reports whether the file needed a change, and whether it was append-only.
+func (w *Writer) processStream(src io.Reader, dst io.Writer) (ProcessResult, error) {
+	if w.config.scriptMode() {
+		if seeker, ok := src.(io.ReadSeeker); ok {
+			if result, handled, err := w.processScript(seeker, dst); handled || err != nil {
+				return result, err
 			}
-			hasher.Write(buffer[:n-windowSize])
-
-			// Slide window to start
-			copy(buffer, buffer[n-windowSize:n])
-			n = windowSize
 		}
+	}
 
-		// Read more data starting after the window
-		bytesRead, err := src.Read(buffer[n:])
-		if err != nil && err != io.EOF {
-			return false, fmt.Errorf("read error: %w", err)
-		}
-		n += bytesRead
-		eof = (err == io.EOF)
+	windowSize := w.config.windowSize()
+	bufp, _ := w.buffers.Get().(*[]byte)
+	if bufp == nil {
+		buf := make([]byte, w.config.BufferSize)
+		bufp = &buf
 	}
+	defer w.buffers.Put(bufp)
+	buffer := *bufp
 
-	// At EOF: buffer[0:n] contains the last bytes of the file (the window)
-	return w.finalizeWindow(writer, hasher, buffer[:n])
-}
+	hasher := &countingHash{Hash32: w.config.newHasher()}
+	writer := bufio.NewWriter(dst)
+	defer writer.Flush()
 
-// finalizeEmpty handles empty files.
-func (w *Writer) finalizeEmpty(writer *bufio.Writer, hasher hash.Hash32) error {
+	// Write and CRC everything except the final window
+	window, _, err := slideWindow(src, buffer, windowSize, func(p []byte) error {
+		if _, err := writer.Write(p); err != nil {
+			return fmt.Errorf("write error: %w", err)
+		}
+		hasher.Write(p)
+		return nil
+	})
+	if err != nil {
+		return ProcessResult{}, err
+	}
+
+	if len(window) == 0 {
+		// Empty file - just add comment
+		if err := w.finalizeEmpty(writer, hasher); err != nil {
+			return ProcessResult{}, err
+		}
+		return ProcessResult{Changed: true, AppendOnly: true}, nil // Empty file always needs hash added
+	}
+
+	result, err := w.finalizeWindow(writer, hasher, window)
+	result.HashedBytes = w.config.hashedLen(hasher.written)
+	return result, err
+}
+
+// finalizeEmpty handles empty files.
+func (w *Writer) finalizeEmpty(writer *bufio.Writer, hasher hash.Hash32) error {
 	crc := hasher.Sum32()
 	lineEnding := "\n"
+	if w.config.NoFinalNewline {
+		lineEnding = ""
+	}
 	comment := w.createComment(crc, lineEnding)
 
+	if err := w.writeMarker(writer, "\n"); err != nil {
+		return err
+	}
 	if _, err := writer.Write(comment); err != nil {
 		return fmt.Errorf("write error: %w", err)
 	}
 	return nil
 }
 
+// writeMarker writes the GeneratedMarker line, if one is configured.
+func (w *Writer) writeMarker(writer *bufio.Writer, lineEnding string) error {
+	if w.config.GeneratedMarker == "" {
+		return nil
+	}
+	if _, err := writer.WriteString(w.config.GeneratedMarker + lineEnding); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	return nil
+}
+
 // finalizeWindow processes the final window at EOF.
-// Returns true if no-op (existing CRC matches calculated CRC), false if file needs update.
-func (w *Writer) finalizeWindow(writer *bufio.Writer, hasher hash.Hash32, window []byte) (bool, error) {
+// The result is unchanged if the existing CRC matches the calculated CRC.
+func (w *Writer) finalizeWindow(writer *bufio.Writer, hasher hash.Hash32, window []byte) (ProcessResult, error) {
+	// Detect line ending style from content
+	lineEnding := detectLineEnding(window)
+
+	// Hold back a trailing modeline so the comment is written before it
+	var modeline []byte
+	if w.config.PreserveModeline {
+		window, modeline = splitModeline(window)
+	}
+
 	// Check if there's an existing integrity comment in the window
-	match := w.pattern.FindSubmatchIndex(window)
+	match, ambiguous := findComment(w.pattern, window)
+	if ambiguous {
+		if w.config.NoClobber {
+			return ProcessResult{}, ErrAmbiguousComment
+		}
+		// Most likely a pasted comment; trusting it would leave the content after it unhashed
+		if w.config.Warn != nil {
+			w.config.Warn("integrity-like line is followed by content; appending a new comment at end of file")
+		}
+	}
 
 	var contentPart []byte
 	var existingCRC uint32
 	var hasExistingComment bool
 
 	if match != nil {
-		// Found existing comment - content is everything before it
-		contentPart = window[:match[0]]
-
-		// Parse the existing CRC
-		crcHex := window[match[2]:match[3]]
-		crcBytes, err := hex.DecodeString(string(crcHex))
-		if err == nil && len(crcBytes) == 4 {
-			existingCRC = uint32(crcBytes[0])<<24 | uint32(crcBytes[1])<<16 |
-				uint32(crcBytes[2])<<8 | uint32(crcBytes[3])
-			hasExistingComment = true
+		// Found existing comment - content is everything before it. The hasher already holds
+		// any earlier content, so a file holding only the comment hashes nothing at all,
+		// like an empty file being stamped.
+		contentPart = w.config.trimSeparator(window[:match[0]])
+
+		// Parse the existing CRC. A comment in a newer format is not replaced by an older one.
+		crc, err := storedDigest(window, match)
+		if errors.Is(err, ErrUnsupportedVersion) {
+			return ProcessResult{}, err
+		}
+		if err == nil {
+			existingCRC = crc
+			// A comment written differently (limit, digest case, version) must be rewritten;
+			// whitespace an editor added after it is tolerated
+			existing := bytes.TrimRight(trimLineEnding(window[match[0]:match[1]]), " \t")
+			hasExistingComment = bytes.Equal(existing, w.createComment(existingCRC, ""))
+			// So must a final comment followed by a line ending that NoFinalNewline forbids
+			if w.config.NoFinalNewline && len(modeline) == 0 && bytes.HasSuffix(window, []byte("\n")) {
+				hasExistingComment = false
+			}
+			// And one still missing its GeneratedMarker
+			if _, ok := w.config.trimMarker(window[:match[0]]); w.config.GeneratedMarker != "" && !ok {
+				hasExistingComment = false
+			}
+		}
+	} else if accepted, _ := findComment(w.accepted, window); accepted != nil {
+		// Comment with an accepted key - replace it with one labelled with the current key
+		contentPart = w.config.trimSeparator(window[:accepted[0]])
+	} else if foreign := findForeignComment(window); foreign != nil {
+		// Comment of another style - drop it so comments don't accumulate
+		contentPart = w.config.trimSeparator(window[:foreign[0]])
+		if w.config.Warn != nil {
+			w.config.Warn(fmt.Sprintf("replacing integrity comment of another style: %q",
+				trimLineEnding(window[foreign[0]:foreign[1]])))
 		}
 	} else {
 		// No existing comment - all of window is content
 		contentPart = window
 	}
 
-	// Detect line ending style from content
-	lineEnding := detectLineEnding(window)
-
 	// CRC the content part (excluding trailing newline if present)
 	crcContent := contentPart
 	needsNewline := false
@@ -306,57 +1376,112 @@ func (w *Writer) finalizeWindow(writer *bufio.Writer, hasher hash.Hash32, window
 	calculatedCRC := hasher.Sum32()
 
 	// If we have an existing comment with the same CRC, this is a no-op
-	if hasExistingComment && calculatedCRC == existingCRC {
+	if hasExistingComment && calculatedCRC == existingCRC && !w.config.Force {
 		// File already has correct hash - signal no-op
 		// Still write to temp file for consistency, but signal caller to skip replace
 		if _, err := writer.Write(window); err != nil {
-			return false, fmt.Errorf("write error: %w", err)
+			return ProcessResult{}, fmt.Errorf("write error: %w", err)
+		}
+		if _, err := writer.Write(modeline); err != nil {
+			return ProcessResult{}, fmt.Errorf("write error: %w", err)
 		}
-		return true, nil
+		return ProcessResult{}, nil
 	}
 
 	// Write the content part
 	if _, err := writer.Write(contentPart); err != nil {
-		return false, fmt.Errorf("write error: %w", err)
+		return ProcessResult{}, fmt.Errorf("write error: %w", err)
 	}
 
 	// Add newline if content doesn't end with one
 	if needsNewline {
 		if _, err := writer.Write([]byte(lineEnding)); err != nil {
-			return false, fmt.Errorf("write error: %w", err)
+			return ProcessResult{}, fmt.Errorf("write error: %w", err)
+		}
+	}
+
+	// Separate the comment from the content
+	if w.config.BlankLineBefore && len(contentPart) > 0 {
+		if _, err := writer.Write([]byte(lineEnding)); err != nil {
+			return ProcessResult{}, fmt.Errorf("write error: %w", err)
 		}
 	}
+	if err := w.writeMarker(writer, lineEnding); err != nil {
+		return ProcessResult{}, err
+	}
 
-	// Write new comment with calculated CRC
-	comment := w.createComment(calculatedCRC, lineEnding)
+	// Write new comment with calculated CRC, ending the file unless a modeline follows
+	commentEnding := lineEnding
+	if w.config.NoFinalNewline && len(modeline) == 0 {
+		commentEnding = ""
+	}
+	comment := w.createComment(calculatedCRC, commentEnding)
 	if _, err := writer.Write(comment); err != nil {
-		return false, fmt.Errorf("write error: %w", err)
+		return ProcessResult{}, fmt.Errorf("write error: %w", err)
 	}
 
-	return false, nil // File was modified
+	// Restore the modeline as the last line
+	if _, err := writer.Write(modeline); err != nil {
+		return ProcessResult{}, fmt.Errorf("write error: %w", err)
+	}
+
+	// Appending leaves the window intact only if it was all content
+	appendOnly := len(contentPart) == len(window) && len(modeline) == 0
+	return ProcessResult{Changed: true, AppendOnly: appendOnly}, nil
 }
 
 // createComment generates the integrity comment with proper line ending.
 func (w *Writer) createComment(crc uint32, lineEnding string) []byte {
+	return w.config.comment(crc, lineEnding)
+}
+
+// comment formats the integrity comment for crc in the configured style.
+func (c Config) comment(crc uint32, lineEnding string) []byte {
+	style := c.style()
+
+	digest := c.formatDigest(crc)
+	if c.FormatVersion > 0 {
+		digest = fmt.Sprintf("v%d:%s", c.FormatVersion, digest)
+	}
+	if c.MaxHashBytes > 0 {
+		digest += fmt.Sprintf(" first=%d", c.MaxHashBytes)
+	}
+	if c.HeadTailBytes > 0 {
+		digest += fmt.Sprintf(" ends=%d", c.HeadTailBytes)
+	}
+
 	var comment string
-	if w.config.CommentStyle.PrefixContainsKey {
-		// Prefix already contains "FileIntegrity" part (e.g., "const FileIntegrity = \"")
-		comment = fmt.Sprintf("%s%08X%s%s",
-			w.config.CommentStyle.Prefix,
-			crc,
-			w.config.CommentStyle.Suffix,
+	if style.PrefixContainsKey {
+		// Prefix already contains the key (e.g., "const FileIntegrity = \"")
+		comment = fmt.Sprintf("%s%s%s%s",
+			style.Prefix,
+			digest,
+			style.Suffix,
 			lineEnding)
 	} else {
 		// Traditional comment format with "FileIntegrity: " in the middle
-		comment = fmt.Sprintf("%sFileIntegrity: %08X%s%s",
-			w.config.CommentStyle.Prefix,
-			crc,
-			w.config.CommentStyle.Suffix,
+		comment = fmt.Sprintf("%s%s: %s%s%s",
+			style.Prefix,
+			c.key(),
+			digest,
+			style.Suffix,
 			lineEnding)
 	}
 	return []byte(comment)
 }
 
+// FormatComment returns the integrity comment the Writer would emit for the given CRC,
+// terminated with an LF line ending.
+func (w *Writer) FormatComment(crc uint32) string {
+	return string(w.createComment(crc, "\n"))
+}
+
+// Pattern returns the regular expression used to locate existing integrity comments. Its
+// submatch "digest" holds the stored digest and "version" the format version, if any.
+func (w *Writer) Pattern() *regexp.Regexp {
+	return w.pattern
+}
+
 // Reader verifies file integrity using the same efficient streaming approach.
 type Reader struct {
 	config  Config
@@ -365,132 +1490,606 @@ type Reader struct {
 
 // NewReader creates a Reader with the given configuration.
 func NewReader(config Config) *Reader {
+	config = config.Clone()
 	return &Reader{
 		config:  config,
-		pattern: createCommentPattern(config.CommentStyle),
+		pattern: createCommentPattern(config.CommentStyle, config.keys()...),
 	}
 }
 
 // VerifyFile checks if a file's integrity comment matches its content.
 func (r *Reader) VerifyFile(filename string) (bool, error) {
+	if r.config.SidecarDir != "" {
+		result, err := r.VerifyDetailed(filename)
+		return result.Valid, err
+	}
+	return retry(r.config.Retries, func() (bool, error) {
+		return readStable(r, filename, (*Reader).verifyStream)
+	})
+}
+
+// HasComment reports whether a file ends with an integrity comment, without checking it.
+// Only the end of the file is read and nothing is hashed, which makes it much cheaper than
+// VerifyFile for coverage checks that only care whether files are stamped at all. In
+// ScriptMode, a comment below the shebang counts too. A malformed comment does not count.
+// With SidecarDir, the file's sidecar is checked instead.
+func (r *Reader) HasComment(filename string) (bool, error) {
+	if r.config.SidecarDir != "" {
+		return r.hasSidecar(filename)
+	}
+	file, err := r.open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if r.config.scriptMode() {
+		header, ok, err := readScriptHeader(bufio.NewReaderSize(file, r.config.BufferSize), r.pattern)
+		if err != nil {
+			return false, err
+		}
+		if ok && header.comment != nil {
+			return true, nil
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file: %w", err)
+	}
+	offset := max(info.Size()-int64(r.config.windowSize()), 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return false, fmt.Errorf("read error: %w", err)
+	}
+	if offset > 0 {
+		// Drop the partial first line, which could end like a comment; the window always
+		// holds the line ending before the comment
+		if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+	}
+
+	if r.config.PreserveModeline {
+		tail, _ = splitModeline(tail)
+	}
+	match, _ := findComment(r.pattern, tail)
+	return match != nil, nil
+}
+
+// forFile returns a Reader for the open file f: r itself, unless the file's permission
+// bits must be hashed.
+func (r *Reader) forFile(f *os.File) (*Reader, error) {
+	if !r.config.IncludePermBits {
+		return r, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return &Reader{config: r.config.withPerm(info), pattern: r.pattern}, nil
+}
+
+// open opens a file for verification, refusing files larger than MaxFileSize.
+func (r *Reader) open(filename string) (*os.File, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return false, fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if r.config.MaxFileSize > 0 {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+		if err := r.config.checkSize(info.Size()); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// Verify checks content read from src, such as a blob held in memory, like VerifyFile.
+// Files stamped with a different MaxHashBytes can only be verified if src is seekable.
+func (r *Reader) Verify(src io.Reader) (bool, error) {
+	return r.verifyStream(src)
+}
+
+// VerifyResult describes a verification in detail, to help diagnose mismatches.
+type VerifyResult struct {
+	Valid       bool   // Whether the stored CRC matches the content
+	ContentLen  int64  // Bytes of content covered by the CRC, before IgnoreLines filtering
+	FileSize    int64  // Total bytes in the file, including the comment
+	StoredCRC   uint32 // CRC recorded in the integrity comment
+	ComputedCRC uint32 // CRC calculated from the content
+}
+
+// VerifyDetailed verifies a file like VerifyFile, additionally reporting the lengths and
+// CRCs that were compared. On error the result holds whatever was determined so far.
+func (r *Reader) VerifyDetailed(filename string) (VerifyResult, error) {
+	return retry(r.config.Retries, func() (VerifyResult, error) {
+		if r.config.SidecarDir != "" {
+			return r.verifySidecar(filename)
+		}
+		return readStable(r, filename, func(r *Reader, src io.Reader) (VerifyResult, error) {
+			return r.verifyDetailed(src, nil, false)
+		})
+	})
+}
+
+// VerifyTee verifies the content read from src while copying it to out, so content can be
+// verified and consumed in a single pass. If stripComment is set, the integrity comment line
+// is not written to out. Content reaches out before verification completes, so callers must
+// check the result before trusting what was written.
+func (r *Reader) VerifyTee(src io.Reader, out io.Writer, stripComment bool) (bool, error) {
+	result, err := r.verifyDetailed(src, out, stripComment)
+	return result.Valid, err
+}
+
+// Digest returns the CRC of a file's content, excluding any integrity comment.
+// This is the value ProcessFile would record in the comment.
+func (r *Reader) Digest(filename string) (uint32, error) {
+	file, err := r.open(filename)
+	if err != nil {
+		return 0, err
 	}
 	defer file.Close()
 
-	return r.verifyStream(file)
+	reader, err := r.forFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return reader.DigestReader(file)
+}
+
+// DigestReader is like Digest for content read from src, such as a string held in memory.
+func (r *Reader) DigestReader(src io.Reader) (uint32, error) {
+	crc, _, err := r.digest(src)
+	return crc, err
+}
+
+// digest returns the CRC of the content read from src, excluding any integrity comment, and
+// where the content and the comment lie in src.
+func (r *Reader) digest(src io.Reader) (uint32, ContentRange, error) {
+	if r.config.scriptMode() {
+		reader := bufio.NewReaderSize(src, r.config.BufferSize)
+		header, ok, err := readScriptHeader(reader, r.pattern)
+		if err != nil {
+			return 0, ContentRange{}, err
+		}
+		if ok {
+			crc, length, err := r.config.hashScript(header, reader, nil)
+			if err != nil {
+				return 0, ContentRange{}, err
+			}
+			// The content runs to the end, around the comment on the second line
+			size := length + int64(len(header.comment))
+			if !bytes.HasSuffix(header.shebang, []byte("\n")) {
+				size-- // Line ending hashed but not in the file
+			}
+			start := int64(len(header.shebang))
+			return crc, ContentRange{End: size, CommentStart: start, CommentEnd: start + int64(len(header.comment)), FileSize: size}, nil
+		}
+		src = reader
+	}
+
+	hasher, window, size, err := r.scanStream(src, nil)
+	if err != nil {
+		return 0, ContentRange{}, err
+	}
+	base := size - int64(len(window))
+	bounds := ContentRange{FileSize: size}
+
+	if r.config.PreserveModeline {
+		window, _ = splitModeline(window)
+	}
+
+	// Content is everything before an existing comment, without its trailing newline
+	match, _ := findComment(r.pattern, window)
+	if match == nil {
+		match = findForeignComment(window)
+	}
+	if match != nil {
+		bounds.CommentStart, bounds.CommentEnd = base+int64(match[0]), base+int64(match[1])
+		window = r.config.trimSeparator(window[:match[0]])
+	}
+	content := trimLineEnding(window)
+	bounds.End = base + int64(len(content))
+	hasher.Write(content)
+	return hasher.Sum32(), bounds, nil
 }
 
 // verifyStream implements streaming verification with same sliding window algorithm.
 func (r *Reader) verifyStream(src io.Reader) (bool, error) {
-	windowSize := r.config.maxCommentSize() + 2
-	buffer := make([]byte, r.config.BufferSize)
+	result, err := r.verifyDetailed(src, nil, false)
+	return result.Valid, err
+}
 
-	hasher := crc32.NewIEEE()
+// verifyDetailed verifies a stream and records what was compared. If out is non-nil the
+// stream is copied to it, without the integrity comment when stripComment is set.
+func (r *Reader) verifyDetailed(src io.Reader, out io.Writer, stripComment bool) (VerifyResult, error) {
+	if r.config.scriptMode() {
+		reader := bufio.NewReaderSize(src, r.config.BufferSize)
+		header, ok, err := readScriptHeader(reader, r.pattern)
+		if err != nil {
+			return VerifyResult{}, err
+		}
+		if ok {
+			return r.verifyScript(header, reader, out, stripComment)
+		}
+		src = reader
+	}
 
-	// First read
-	n, err := src.Read(buffer)
-	if err != nil && err != io.EOF {
-		return false, fmt.Errorf("read error: %w", err)
+	hasher, window, size, err := r.scanStream(src, out)
+	if err != nil {
+		return VerifyResult{}, err
 	}
+	result := VerifyResult{FileSize: size}
 
-	if n == 0 {
-		return false, fmt.Errorf("empty file")
+	if len(window) == 0 {
+		// An empty file has never been processed, so it cannot carry a comment
+		return result, ErrNoComment
 	}
 
-	firstRead := true
-	eof := (err == io.EOF)
+	var modeline []byte
+	if r.config.PreserveModeline {
+		window, modeline = splitModeline(window)
+	}
 
-	for !eof {
-		if firstRead {
-			// First read: CRC everything except last windowSize bytes
-			if n > windowSize {
-				hashLen := n - windowSize
-				hasher.Write(buffer[:hashLen])
+	// Find the integrity comment
+	match, ambiguous := findComment(r.pattern, window)
 
-				// Slide window to start
-				copy(buffer, buffer[hashLen:n])
-				n = n - hashLen
-			}
-			firstRead = false
-		} else {
-			// Subsequent reads: CRC everything before window
-			hasher.Write(buffer[:n-windowSize])
+	// Pass the tail through, dropping the comment if requested
+	if out != nil {
+		tail := window
+		if match != nil && stripComment {
+			tail = window[:match[0]]
+		}
+		if _, err := out.Write(tail); err != nil {
+			return result, fmt.Errorf("write error: %w", err)
+		}
+		if _, err := out.Write(modeline); err != nil {
+			return result, fmt.Errorf("write error: %w", err)
+		}
+	}
 
-			// Slide window to start
-			copy(buffer, buffer[n-windowSize:n])
-			n = windowSize
+	if ambiguous && r.stampedBefore(hasher, window) {
+		return result, ErrTrailingData
+	}
+	if match == nil {
+		if r.config.StrictFormat {
+			line := lastLine(window)
+			if bytes.Contains(line, []byte(r.config.key())) {
+				return result, &FormatError{
+					Line:   string(line),
+					Reason: diagnoseComment(r.config.style(), r.config.key(), string(line)),
+				}
+			}
 		}
+		return result, ErrNoComment
+	}
 
-		// Read more data
-		bytesRead, err := src.Read(buffer[n:])
-		if err != nil && err != io.EOF {
-			return false, fmt.Errorf("read error: %w", err)
+	// Extract stored CRC
+	stored, err := storedDigest(window, match)
+	if err != nil {
+		return result, err
+	}
+	result.StoredCRC = stored
+
+	// CRC the content before the comment (excluding trailing newline)
+	content := trimLineEnding(r.config.trimSeparator(window[:match[0]]))
+	hasher.Write(content)
+	result.ContentLen = size - int64(len(window)+len(modeline)) + int64(len(content))
+
+	recorded := r.config.withRecordedLimit(window, match)
+	if recorded.MaxHashBytes == r.config.MaxHashBytes && recorded.HeadTailBytes == r.config.HeadTailBytes {
+		result.ComputedCRC = hasher.Sum32()
+	} else {
+		// The file was stamped with another limit, so hash its content again using that one
+		result.ComputedCRC, err = recorded.rehash(src, result.ContentLen)
+		if err != nil {
+			return result, err
 		}
-		n += bytesRead
-		eof = (err == io.EOF)
 	}
+	result.ContentLen = recorded.hashedLen(result.ContentLen)
+	result.Valid = result.ComputedCRC == result.StoredCRC
+	return result, nil
+}
 
-	// At EOF: buffer[0:n] contains the final window
-	return r.verifyWindow(hasher, buffer[:n])
+// stampedBefore reports whether the last integrity-like line in window, which other content
+// follows, records the CRC of the content before it. Such a line was written by ProcessFile and
+// the content after it added since, while a line that does not match was pasted or generated
+// mid-file and the file was never stamped. hasher holds the content before window and is left
+// unusable.
+func (r *Reader) stampedBefore(hasher hash.Hash32, window []byte) bool {
+	matches := r.pattern.FindAllSubmatchIndex(window, -1)
+	last := matches[len(matches)-1]
+	stored, err := storedDigest(window, last)
+	if err != nil {
+		return false
+	}
+	hasher.Write(trimLineEnding(r.config.trimSeparator(window[:last[0]])))
+	return hasher.Sum32() == stored
 }
 
-// verifyWindow extracts and verifies the CRC from the final window.
-func (r *Reader) verifyWindow(hasher hash.Hash32, window []byte) (bool, error) {
-	// Find the integrity comment
-	match := r.pattern.FindSubmatchIndex(window)
-	if match == nil {
-		return false, fmt.Errorf("no integrity comment found")
+// rehash computes the CRC of the first contentLen bytes of src, which were stamped with the
+// limit of c rather than the configured one. src must be seekable, since it has already been
+// read to the end.
+func (c Config) rehash(src io.Reader, contentLen int64) (uint32, error) {
+	seeker, ok := src.(io.ReadSeeker)
+	if !ok {
+		return 0, fmt.Errorf("comment records a hash limit (%s), unlike the configuration, and the input cannot be re-read", c.limitString())
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek error: %w", err)
 	}
 
-	// Extract stored CRC
-	crcHex := window[match[2]:match[3]]
-	crcBytes, err := hex.DecodeString(string(crcHex))
-	if err != nil || len(crcBytes) != 4 {
-		return false, fmt.Errorf("invalid CRC format")
+	if c.MaxHashBytes > 0 {
+		contentLen = min(contentLen, int64(c.MaxHashBytes))
 	}
+	hasher := c.newHasher()
+	if _, err := io.CopyN(hasher, seeker, contentLen); err != nil {
+		return 0, fmt.Errorf("read error: %w", err)
+	}
+	return hasher.Sum32(), nil
+}
 
-	storedCRC := uint32(crcBytes[0])<<24 | uint32(crcBytes[1])<<16 |
-		uint32(crcBytes[2])<<8 | uint32(crcBytes[3])
+// limitString describes the hash limit of c as recorded in a comment.
+func (c Config) limitString() string {
+	switch {
+	case c.MaxHashBytes > 0:
+		return fmt.Sprintf("first=%d", c.MaxHashBytes)
+	case c.HeadTailBytes > 0:
+		return fmt.Sprintf("ends=%d", c.HeadTailBytes)
+	}
+	return "none"
+}
 
-	// CRC the content before the comment (excluding trailing newline)
-	contentPart := window[:match[0]]
+// withRecordedLimit returns c with MaxHashBytes and HeadTailBytes set to the limit recorded
+// in a comment matched in window; both are 0 if the whole content was hashed.
+func (c Config) withRecordedLimit(window []byte, match []int) Config {
+	c.MaxHashBytes = recordedNumber(window, match, groupFirst)
+	c.HeadTailBytes = recordedNumber(window, match, groupEnds)
+	return c
+}
 
-	if len(contentPart) > 0 {
-		// Strip trailing newline before CRCing
-		if contentPart[len(contentPart)-1] == '\n' {
-			if len(contentPart) > 1 && contentPart[len(contentPart)-2] == '\r' {
-				contentPart = contentPart[:len(contentPart)-2]
-			} else {
-				contentPart = contentPart[:len(contentPart)-1]
+// storedDigest parses the digest of a comment matched in window, choosing the parser by the
+// format version the comment records. Unversioned comments and version 1 hold a CRC32 as 8
+// hexadecimal digits; other versions are reported as ErrUnsupportedVersion.
+func storedDigest(window []byte, match []int) (uint32, error) {
+	if start := match[2*groupVersion]; start >= 0 {
+		if version := string(window[start:match[2*groupVersion+1]]); version != "1" {
+			return 0, fmt.Errorf("%w: v%s", ErrUnsupportedVersion, version)
+		}
+	}
+	crc, err := strconv.ParseUint(string(window[match[2*groupDigest]:match[2*groupDigest+1]]), 16, 32)
+	if err != nil {
+		return 0, ErrInvalidFormat
+	}
+	return uint32(crc), nil
+}
+
+// recordedNumber returns the number captured by group in a comment matched in window, or 0
+// if the group did not match.
+func recordedNumber(window []byte, match []int, group int) int {
+	if len(match) < 2*group+2 || match[2*group] < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(string(window[match[2*group]:match[2*group+1]]))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// scanStream hashes everything except the final window, which is returned for inspection
+// along with the total number of bytes read. The window is empty for an empty stream.
+// If out is non-nil, every hashed byte is also written to it.
+func (r *Reader) scanStream(src io.Reader, out io.Writer) (hash.Hash32, []byte, int64, error) {
+	windowSize := r.config.windowSize()
+	buffer := make([]byte, r.config.BufferSize)
+
+	hasher := r.config.newHasher()
+	window, total, err := slideWindow(src, buffer, windowSize, func(p []byte) error {
+		hasher.Write(p)
+		if out != nil {
+			if _, err := out.Write(p); err != nil {
+				return fmt.Errorf("write error: %w", err)
 			}
 		}
-		hasher.Write(contentPart)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, 0, err
 	}
+	return hasher, window, total, nil
+}
 
-	calculatedCRC := hasher.Sum32()
-	return calculatedCRC == storedCRC, nil
+// slideWindow is the sliding window loop shared by the Writer and the Reader. It reads src
+// through buffer, passing everything except the final window to emit, and returns that
+// window, a slice of buffer holding at least the last windowSize bytes (or all of them for
+// shorter content), along with the total number of bytes read. Reads may be short, so the
+// buffer can hold less than a full window between reads.
+func slideWindow(src io.Reader, buffer []byte, windowSize int, emit func(p []byte) error) ([]byte, int64, error) {
+	n := 0
+	var total int64
+	for {
+		if n > windowSize {
+			// Pass on everything before the window, then slide the window to the start
+			emitLen := n - windowSize
+			if err := emit(buffer[:emitLen]); err != nil {
+				return nil, 0, err
+			}
+			copy(buffer, buffer[emitLen:n])
+			n = windowSize
+		}
+
+		bytesRead, err := src.Read(buffer[n:])
+		n += bytesRead
+		total += int64(bytesRead)
+		if err == io.EOF {
+			return buffer[:n], total, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("read error: %w", err)
+		}
+	}
 }
 
 // Helper functions
 
-// createCommentPattern creates a regex pattern for finding integrity comments.
-func createCommentPattern(style CommentStyle) *regexp.Regexp {
-	prefix := regexp.QuoteMeta(style.Prefix)
+// patternKey identifies a compiled comment pattern in patternCache.
+type patternKey struct {
+	style CommentStyle
+	keys  string // Keys joined by NUL
+}
+
+// patternCache holds the compiled comment patterns, so Writers and Readers created per file
+// share them instead of compiling the same expression again. It only grows by one entry per
+// distinct style and key set in use.
+var patternCache sync.Map // patternKey -> *regexp.Regexp
+
+// createCommentPattern returns a regex pattern for finding integrity comments labelled
+// with any of keys, compiling it only the first time.
+func createCommentPattern(style CommentStyle, keys ...string) *regexp.Regexp {
+	key := patternKey{style: style, keys: strings.Join(keys, "\x00")}
+	if cached, ok := patternCache.Load(key); ok {
+		return cached.(*regexp.Regexp)
+	}
+	pattern, _ := patternCache.LoadOrStore(key, compileCommentPattern(style, keys...))
+	return pattern.(*regexp.Regexp)
+}
+
+// Submatches of the pattern returned by createCommentPattern
+const (
+	groupVersion = 1 // Digits of the "vN:" format version token, if any
+	groupDigest  = 2
+	groupFirst   = 3 // MaxHashBytes recorded as " first=N"
+	groupEnds    = 4 // HeadTailBytes recorded as " ends=N"
+)
+
+// compileCommentPattern compiles the pattern returned by createCommentPattern.
+func compileCommentPattern(style CommentStyle, keys ...string) *regexp.Regexp {
 	suffix := regexp.QuoteMeta(style.Suffix)
 
+	var alternatives []string
+	for _, key := range keys {
+		if style.PrefixContainsKey {
+			alternatives = append(alternatives, regexp.QuoteMeta(strings.Replace(style.Prefix, DefaultKey, key, 1)))
+		} else {
+			alternatives = append(alternatives, regexp.QuoteMeta(key))
+		}
+	}
+	keyPattern := alternatives[0]
+	if len(alternatives) > 1 {
+		keyPattern = "(?:" + strings.Join(alternatives, "|") + ")"
+	}
+
 	var pattern string
 	if style.PrefixContainsKey {
-		// Prefix already contains "FileIntegrity" part, so just match hash
-		pattern = fmt.Sprintf(`(?m)^%s([0-9A-F]{8})%s\r?\n?$`, prefix, suffix)
+		// Prefix already contains the key, so just match hash
+		pattern = fmt.Sprintf(`(?m)^%s(?:v(?P<version>[0-9]+):)?(?P<digest>[0-9A-Fa-f]{8})(?: first=(?P<first>[0-9]+)| ends=(?P<ends>[0-9]+))?%s[ \t]*\r?\n?$`, keyPattern, suffix)
 	} else {
 		// Traditional format with "FileIntegrity: " in the middle
-		pattern = fmt.Sprintf(`(?m)^%sFileIntegrity: ([0-9A-F]{8})%s\r?\n?$`, prefix, suffix)
+		pattern = fmt.Sprintf(`(?m)^%s%s: (?:v(?P<version>[0-9]+):)?(?P<digest>[0-9A-Fa-f]{8})(?: first=(?P<first>[0-9]+)| ends=(?P<ends>[0-9]+))?%s[ \t]*\r?\n?$`, regexp.QuoteMeta(style.Prefix), keyPattern, suffix)
 	}
 	return regexp.MustCompile(pattern)
 }
 
+// findComment locates the integrity comment in the final window. Only a comment followed by
+// nothing but whitespace is the last line of the file; an earlier match is treated as content
+// and reported as ambiguous.
+func findComment(pattern *regexp.Regexp, window []byte) (match []int, ambiguous bool) {
+	matches := pattern.FindAllSubmatchIndex(window, -1)
+	if matches == nil {
+		return nil, false
+	}
+	last := matches[len(matches)-1]
+	if len(bytes.TrimSpace(window[last[1]:])) > 0 {
+		return nil, true
+	}
+	return last, false
+}
+
+// findForeignComment locates an integrity comment of any predefined style at the end of window.
+func findForeignComment(window []byte) []int {
+	for _, pattern := range foreignPatterns {
+		if match, _ := findComment(pattern, window); match != nil {
+			return match
+		}
+	}
+	return nil
+}
+
+// splitModeline separates a trailing editor modeline from window. The modeline must be
+// preceded by a line ending within the window, so a line cut off by the window is never split.
+func splitModeline(window []byte) (rest, modeline []byte) {
+	i := bytes.LastIndexByte(trimLineEnding(window), '\n')
+	if i < 0 || !modelinePattern.Match(window[i+1:]) {
+		return window, nil
+	}
+	return window[:i+1], window[i+1:]
+}
+
+// trimLineEnding strips a single trailing LF or CRLF from content.
+func trimLineEnding(content []byte) []byte {
+	if len(content) > 0 && content[len(content)-1] == '\n' {
+		if len(content) > 1 && content[len(content)-2] == '\r' {
+			return content[:len(content)-2]
+		}
+		return content[:len(content)-1]
+	}
+	return content
+}
+
+// lastLine returns the final line of content without its line ending.
+func lastLine(content []byte) []byte {
+	content = bytes.TrimSuffix(content, []byte("\n"))
+	content = bytes.TrimSuffix(content, []byte("\r"))
+	if i := bytes.LastIndexByte(content, '\n'); i >= 0 {
+		return content[i+1:]
+	}
+	return content
+}
+
+// diagnoseComment explains why line is not a well-formed integrity comment for style and key.
+func diagnoseComment(style CommentStyle, key, line string) string {
+	if !strings.HasPrefix(line, style.Prefix) {
+		return fmt.Sprintf("missing prefix %q", style.Prefix)
+	}
+	rest := line[len(style.Prefix):]
+
+	if !style.PrefixContainsKey {
+		if !strings.HasPrefix(rest, key+": ") {
+			return fmt.Sprintf("missing key %q", key+": ")
+		}
+		rest = rest[len(key+": "):]
+	}
+
+	if !strings.HasSuffix(rest, style.Suffix) {
+		return fmt.Sprintf("missing suffix %q", style.Suffix)
+	}
+	digest, _, _ := strings.Cut(rest[:len(rest)-len(style.Suffix)], " first=")
+	digest, _, _ = strings.Cut(digest, " ends=")
+	if version, after, ok := strings.Cut(digest, ":"); ok {
+		if version != "v1" {
+			return fmt.Sprintf("unsupported format version %q", version)
+		}
+		digest = after
+	}
+
+	if len(digest) != 8 {
+		return fmt.Sprintf("digest %q has %d digits, want 8", digest, len(digest))
+	}
+	for _, c := range digest {
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'F' || c >= 'a' && c <= 'f') {
+			return fmt.Sprintf("digest %q is not hexadecimal", digest)
+		}
+	}
+	return "unexpected text around comment"
+}
+
 // detectLineEnding detects whether the content uses CRLF or LF line endings.
 func detectLineEnding(content []byte) string {
 	// Scan for the first newline
@@ -506,6 +2105,205 @@ func detectLineEnding(content []byte) string {
 	return "\n"
 }
 
+// normalizingHash buffers Go source and computes the CRC32 of its gofmt-normalized form,
+// continuing from seed, the CRC of anything hashed before the source.
+type normalizingHash struct {
+	buf  bytes.Buffer
+	seed uint32
+	warn func(msg string)
+	out  io.Writer // If set, receives the content hashed once it is known
+}
+
+func (h *normalizingHash) Write(p []byte) (int, error) { return h.buf.Write(p) }
+func (h *normalizingHash) Reset()                      { h.buf.Reset() }
+func (h *normalizingHash) Size() int                   { return crc32.Size }
+func (h *normalizingHash) BlockSize() int              { return 1 }
+
+func (h *normalizingHash) Sum(b []byte) []byte {
+	s := h.Sum32()
+	return append(b, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+// Sum32 formats the buffered source and returns its CRC, excluding the trailing newline
+// gofmt always emits. Unparseable source falls back to the CRC of the raw bytes.
+func (h *normalizingHash) Sum32() uint32 {
+	content := h.buf.Bytes()
+	if len(content) == 0 {
+		return h.seed
+	}
+
+	formatted, err := format.Source(content)
+	if err != nil {
+		if h.warn != nil {
+			h.warn(fmt.Sprintf("cannot normalize Go source, hashing raw content: %v", err))
+		}
+	} else {
+		content = bytes.TrimSuffix(formatted, []byte("\n"))
+	}
+	if h.out != nil {
+		h.out.Write(content)
+	}
+	return crc32.Update(h.seed, crc32.IEEETable, content)
+}
+
+// limitHash passes only the first limit bytes written to the next hash.
+type limitHash struct {
+	limit   int64
+	written int64
+	next    hash.Hash32
+}
+
+func (h *limitHash) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := h.limit - h.written; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	h.written += int64(len(p))
+	h.next.Write(p)
+	return n, nil
+}
+
+func (h *limitHash) Reset()              { h.written = 0; h.next.Reset() }
+func (h *limitHash) Size() int           { return h.next.Size() }
+func (h *limitHash) BlockSize() int      { return 1 }
+func (h *limitHash) Sum(b []byte) []byte { return h.next.Sum(b) }
+func (h *limitHash) Sum32() uint32       { return h.next.Sum32() }
+
+// teeHash copies the bytes written to the embedded hash to out.
+type teeHash struct {
+	hash.Hash32
+	out io.Writer
+}
+
+func (h *teeHash) Write(p []byte) (int, error) {
+	h.out.Write(p)
+	return h.Hash32.Write(p)
+}
+
+// countingHash counts the bytes written to the embedded hash.
+type countingHash struct {
+	hash.Hash32
+	written int64
+}
+
+func (h *countingHash) Write(p []byte) (int, error) {
+	h.written += int64(len(p))
+	return h.Hash32.Write(p)
+}
+
+func (h *countingHash) Reset() { h.written = 0; h.Hash32.Reset() }
+
+// lineFilterHash passes content to the next hash line by line, dropping lines that match pattern
+// and, if markers is set, regions between ignore markers.
+type lineFilterHash struct {
+	pattern *regexp.Regexp // May be nil
+	markers []CommentStyle // Comment syntaxes of marker lines; nil to hash markers as content
+	region  []byte         // Lines of an open ignored region, nil outside one
+	next    hash.Hash32
+	line    []byte // Incomplete line awaiting its newline
+}
+
+func (h *lineFilterHash) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			h.line = append(h.line, p...)
+			break
+		}
+		h.line = append(h.line, p[:i+1]...)
+		h.flush()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// flush hashes the buffered line unless it is ignored. Lines of an open region are held back
+// until its end marker drops them.
+func (h *lineFilterHash) flush() {
+	line := trimLineEnding(h.line)
+	switch {
+	case h.region != nil && isMarkerLine(line, IgnoreEndMarker, h.markers):
+		h.region = nil
+	case h.region != nil:
+		h.region = append(h.region, h.line...)
+	case isMarkerLine(line, IgnoreStartMarker, h.markers):
+		h.region = append([]byte{}, h.line...)
+	case h.pattern != nil && h.pattern.Match(line):
+	default:
+		h.next.Write(h.line)
+	}
+	h.line = h.line[:0]
+}
+
+// isMarkerLine reports whether line is a comment in one of styles holding nothing but marker.
+func isMarkerLine(line []byte, marker string, styles []CommentStyle) bool {
+	text := bytes.TrimSpace(line)
+	if !bytes.Contains(text, []byte(marker)) {
+		return false
+	}
+	for _, style := range styles {
+		if style.PrefixContainsKey {
+			continue
+		}
+		body, ok := bytes.CutPrefix(text, []byte(strings.TrimSpace(style.Prefix)))
+		if !ok {
+			continue
+		}
+		if body, ok = bytes.CutSuffix(body, []byte(strings.TrimSpace(style.Suffix))); ok && string(bytes.TrimSpace(body)) == marker {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *lineFilterHash) Reset()         { h.line = h.line[:0]; h.region = nil; h.next.Reset() }
+func (h *lineFilterHash) Size() int      { return h.next.Size() }
+func (h *lineFilterHash) BlockSize() int { return 1 }
+
+func (h *lineFilterHash) Sum(b []byte) []byte {
+	s := h.Sum32()
+	return append(b, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+// Sum32 flushes the final line, which has no line ending once the content is complete, and
+// hashes a region left open as content.
+func (h *lineFilterHash) Sum32() uint32 {
+	if len(h.line) > 0 {
+		h.flush()
+	}
+	if h.region != nil {
+		h.next.Write(h.region)
+		h.region = nil
+	}
+	return h.next.Sum32()
+}
+
+// tempSuffix ends the base names of the temporary files created by createTemp.
+const tempSuffix = ".tmp"
+
+// isTempName reports whether filename is named like a temporary file from createTemp
+// with the configured prefix.
+func (c Config) isTempName(filename string) bool {
+	base := filepath.Base(filename)
+	prefix := c.tempPrefix()
+	return len(base) >= len(prefix)+len(tempSuffix) && strings.HasPrefix(base, prefix) && strings.HasSuffix(base, tempSuffix)
+}
+
+// createTemp creates a new temporary file in dir, named prefix followed by a random number
+// and tempSuffix, with the given permissions, unlike os.CreateTemp which always uses 0600.
+// The permissions are subject to the umask.
+func createTemp(dir, prefix string, perm os.FileMode) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+tempSuffix)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, fs.ErrExist) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
 // preserveAttributes copies file attributes from source to destination.
 func preserveAttributes(dst string, srcInfo os.FileInfo) error {
 	// Preserve permissions
@@ -552,4 +2350,4 @@ func VerifyFile(filename string) (bool, error) {
 	return reader.VerifyFile(filename)
 }
 
-// FileIntegrity: 353BE8BC
+// FileIntegrity: 0A80F7F9
@@ -2,8 +2,19 @@ package hashfile
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 // TestBasicProcessAndVerify tests the basic functionality of adding and verifying integrity comments
@@ -390,6 +401,31 @@ func TestDifferentCommentStyles(t *testing.T) {
 			style:   HTMLStyle,
 			content: "<html><body></body></html>\n",
 		},
+		{
+			name:    "Fortran style",
+			style:   FortranStyle,
+			content: "program hello\n  print *, 'Hello'\nend program hello\n",
+		},
+		{
+			name:    "fixed-form Fortran style",
+			style:   FixedFortranStyle,
+			content: "      PROGRAM HELLO\n      PRINT *, 'HELLO'\n      END\n",
+		},
+		{
+			name:    "COBOL style",
+			style:   COBOLStyle,
+			content: "000100 IDENTIFICATION DIVISION.\n000200 PROGRAM-ID. HELLO.\n",
+		},
+		{
+			name:    "Mermaid style",
+			style:   MermaidStyle,
+			content: "flowchart LR\n  A --> B\n",
+		},
+		{
+			name:    "D2 style",
+			style:   D2Style,
+			content: "x -> y: hello\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -446,10 +482,25 @@ func TestConfigForExtension(t *testing.T) {
 		{".html", HTMLStyle},
 		{".c", CStyle},
 		{".cpp", CStyle},
+		{".m", CStyle},
+		{".mm", CStyle},
+		{".matlab", MatlabStyle},
+		{".mmd", MermaidStyle},
+		{".mermaid", MermaidStyle},
+		{".d2", D2Style},
 		{".java", CStyle},
 		{".js", CStyle},
+		{".proto", CStyle},
+		{".graphql", CStyle},
+		{".gql", CStyle},
+		{".dart", CStyle},
+		{".jsonc", CStyle},
+		{".json5", CStyle},
 		{".sh", ShellStyle},
 		{".rb", RubyStyle},
+		{".f90", FortranStyle},
+		{".f", FixedFortranStyle},
+		{".cbl", COBOLStyle},
 		{".unknown", GoStyle}, // default
 	}
 
@@ -649,6 +700,89 @@ func TestEmptyFile(t *testing.T) {
 	}
 }
 
+// TestCommentOnlyFile ensures a file holding nothing but a comment is treated as a stamped
+// empty file: the comment covers no content, so the only valid CRC is that of empty input
+func TestCommentOnlyFile(t *testing.T) {
+	empty := DefaultConfig().newHasher().Sum32()
+	stamped := string(NewWriter(DefaultConfig()).createComment(empty, "\n"))
+
+	tests := []struct {
+		name    string
+		content string
+		want    string // Content after ProcessFile
+		valid   bool   // Verification result before ProcessFile
+		config  func(*Config)
+	}{
+		{"correct", stamped, stamped, true, nil},
+		{"stale", "// FileIntegrity: DEADBEEF\n", stamped, false, nil},
+		{"no trailing newline", "// FileIntegrity: DEADBEEF", stamped, false, nil},
+		{"crlf", "// FileIntegrity: DEADBEEF\r\n", strings.TrimSuffix(stamped, "\n") + "\r\n", false, nil},
+		{"blank line", "// FileIntegrity: DEADBEEF\n", stamped, false, func(c *Config) { c.BlankLineBefore = true }},
+		{"modeline", "// FileIntegrity: DEADBEEF\n// vim: set ts=4:\n", stamped + "// vim: set ts=4:\n", false,
+			func(c *Config) { c.PreserveModeline = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			filename := filepath.Join(t.TempDir(), "empty.go")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := NewReader(config).VerifyDetailed(filename)
+			if err != nil {
+				t.Fatalf("VerifyDetailed() failed: %v", err)
+			}
+			if result.Valid != tt.valid || result.ComputedCRC != empty || result.ContentLen != 0 {
+				t.Errorf("VerifyDetailed() = %+v, want Valid %v over no content", result, tt.valid)
+			}
+
+			writer := NewWriter(config)
+			if err := writer.ProcessFile(filename); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			content, _ := os.ReadFile(filename)
+			if string(content) != tt.want {
+				t.Errorf("content = %q, want %q", content, tt.want)
+			}
+
+			// Re-stamping is a no-op and the result verifies
+			if again, err := writer.Inspect(filename); err != nil || again.Changed {
+				t.Errorf("Inspect() after ProcessFile() = %+v, %v; want unchanged", again, err)
+			}
+			if valid, err := NewReader(config).VerifyFile(filename); err != nil || !valid {
+				t.Errorf("VerifyFile() = %v, %v; want true", valid, err)
+			}
+
+			// Removing the comment leaves an empty file, apart from a preserved modeline
+			stripped, removed := StripComment(content, config)
+			if !removed || strings.Contains(string(stripped), "FileIntegrity") {
+				t.Errorf("StripComment() = %q, %v", stripped, removed)
+			}
+		})
+	}
+}
+
+// BenchmarkNewReader measures creating a Reader per file, as the CLI does, with the comment
+// pattern cached and compiled every time
+func BenchmarkNewReader(b *testing.B) {
+	config := DefaultConfig()
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewReader(config)
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			compileCommentPattern(config.CommentStyle, config.keys()...)
+		}
+	})
+}
+
 // BenchmarkProcessFile benchmarks file processing
 func BenchmarkProcessFile(b *testing.B) {
 	// Create a temporary file
@@ -1196,4 +1330,2855 @@ func TestPrefixContainsKeyFlag(t *testing.T) {
 		t.Error("Templ style should contain 'const FileIntegrity = '")
 	}
 }
-// FileIntegrity: 77A81829
+
+// TestFormatComment ensures the exposed comment format round-trips through the pattern
+func TestFormatComment(t *testing.T) {
+	for _, style := range []CommentStyle{GoStyle, HTMLStyle, CSSStyle, TemplStyle} {
+		writer := NewWriter(Config{CommentStyle: style, BufferSize: 64 * 1024})
+
+		comment := writer.FormatComment(0xABCD1234)
+		match := writer.Pattern().FindStringSubmatch(comment)
+		if match == nil {
+			t.Errorf("Pattern %q does not match comment %q", writer.Pattern(), comment)
+			continue
+		}
+		if digest := match[writer.Pattern().SubexpIndex("digest")]; digest != "ABCD1234" {
+			t.Errorf("Pattern captured %q, want %q", digest, "ABCD1234")
+		}
+	}
+}
+
+// TestNormalizeGo ensures reformatting a Go file keeps its integrity comment valid
+func TestNormalizeGo(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n")); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	config := DefaultConfig()
+	config.NormalizeGo = true
+	writer := NewWriter(config)
+	reader := NewReader(config)
+
+	if err := writer.ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+
+	// Reformat the body without changing its meaning
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reformatted := bytes.Replace(content, []byte("func main() {\n\tprintln(\"hi\")\n}"), []byte("func   main()  {\n  println( \"hi\" )\n}"), 1)
+	if bytes.Equal(content, reformatted) {
+		t.Fatal("Test content was not reformatted")
+	}
+	if err := os.WriteFile(tmpfile.Name(), reformatted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := reader.VerifyFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyFile() failed: %v", err)
+	}
+	if !valid {
+		t.Error("VerifyFile() returned false for reformatted file")
+	}
+
+	// Raw hashing must still see the change
+	valid, err = NewReader(DefaultConfig()).VerifyFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyFile() failed: %v", err)
+	}
+	if valid {
+		t.Error("VerifyFile() without NormalizeGo returned true for reformatted file")
+	}
+}
+
+// TestNormalizeGoFallback ensures unparseable Go is hashed raw with a warning
+func TestNormalizeGoFallback(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte("this is not go\n")); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	var warnings []string
+	config := DefaultConfig()
+	config.NormalizeGo = true
+	config.Warn = func(msg string) { warnings = append(warnings, msg) }
+
+	if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	if len(warnings) == 0 {
+		t.Error("Expected a warning for unparseable Go source")
+	}
+
+	// Raw fallback produces the same hash as plain processing
+	valid, err := NewReader(DefaultConfig()).VerifyFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyFile() failed: %v", err)
+	}
+	if !valid {
+		t.Error("Fallback hash does not match raw hash")
+	}
+}
+
+// TestVerifyMissingComment ensures unhashed files, including empty ones, report ErrNoComment
+func TestVerifyMissingComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "empty file", content: ""},
+		{name: "no comment", content: "package main\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			if _, err := tmpfile.Write([]byte(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			tmpfile.Close()
+
+			valid, err := NewReader(DefaultConfig()).VerifyFile(tmpfile.Name())
+			if !errors.Is(err, ErrNoComment) {
+				t.Errorf("VerifyFile() error = %v, want ErrNoComment", err)
+			}
+			if valid {
+				t.Error("VerifyFile() returned true for unhashed file")
+			}
+		})
+	}
+}
+
+// TestSupportedExtensions ensures the listed mapping agrees with ConfigForExtension
+func TestSupportedExtensions(t *testing.T) {
+	exts := SupportedExtensions()
+	if len(exts) == 0 {
+		t.Fatal("SupportedExtensions() returned no extensions")
+	}
+
+	for ext, style := range exts {
+		if got := ConfigForExtension(ext).CommentStyle; got != style {
+			t.Errorf("ConfigForExtension(%q) = %+v, SupportedExtensions() says %+v", ext, got, style)
+		}
+	}
+
+	// Mutating the result must not affect the package mapping
+	exts[".go"] = PythonStyle
+	if ConfigForExtension(".go").CommentStyle != GoStyle {
+		t.Error("Modifying SupportedExtensions() result changed ConfigForExtension")
+	}
+}
+
+// TestRegisterExtension ensures a registered extension is used for lookups and listed, and
+// invalid registrations are rejected
+func TestRegisterExtension(t *testing.T) {
+	vue := CommentStyle{Prefix: "<!-- ", Suffix: " -->"}
+	if err := RegisterExtension(".vue", vue); err != nil {
+		t.Fatalf("RegisterExtension() failed: %v", err)
+	}
+	defer delete(extensionStyles, ".vue")
+
+	if got := ConfigForExtension(".vue").CommentStyle; got != vue {
+		t.Errorf("ConfigForExtension(.vue) = %+v, want %+v", got, vue)
+	}
+	if got := ConfigForFilename("App.vue", DefaultConfig()).CommentStyle; got != vue {
+		t.Errorf("ConfigForFilename(App.vue) = %+v, want %+v", got, vue)
+	}
+	if got, ok := SupportedExtensions()[".vue"]; !ok || got != vue {
+		t.Errorf("SupportedExtensions()[.vue] = %+v, %v; want %+v", got, ok, vue)
+	}
+
+	for _, ext := range []string{"", ".", "vue", ".a.b", "./x"} {
+		if err := RegisterExtension(ext, vue); err == nil {
+			t.Errorf("RegisterExtension(%q) succeeded", ext)
+		}
+	}
+	if err := RegisterExtension(".x", CommentStyle{}); err == nil {
+		t.Error("RegisterExtension() accepted a style without a prefix")
+	}
+}
+
+// TestSupportedStyles ensures every listed style name resolves
+func TestSupportedStyles(t *testing.T) {
+	names := SupportedStyles()
+	if len(names) == 0 {
+		t.Fatal("SupportedStyles() returned no names")
+	}
+	for i, name := range names {
+		if _, err := ConfigForStyleName(name); err != nil {
+			t.Errorf("ConfigForStyleName(%q) failed: %v", name, err)
+		}
+		if i > 0 && names[i-1] >= name {
+			t.Errorf("SupportedStyles() not sorted: %q before %q", names[i-1], name)
+		}
+	}
+}
+
+// TestMermaidStyle ensures a Mermaid "%%" comment is told apart from a MATLAB "%" comment
+func TestMermaidStyle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flow.mmd")
+	if err := os.WriteFile(path, []byte("flowchart LR\n  %% a note\n  A --> B\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWriter(ConfigForFilename(path, DefaultConfig())).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`\n%% FileIntegrity: [0-9A-F]{8}\n$`).Match(content) {
+		t.Errorf("Content = %q, want a trailing %%%% comment", content)
+	}
+
+	matlab := DefaultConfig()
+	matlab.CommentStyle = MatlabStyle
+	if _, err := NewReader(matlab).VerifyFile(path); !errors.Is(err, ErrNoComment) {
+		t.Errorf("VerifyFile() with MatlabStyle error = %v, want ErrNoComment", err)
+	}
+
+	// Restamping as MATLAB replaces the Mermaid comment rather than keeping both
+	if err := NewWriter(matlab).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() with MatlabStyle failed: %v", err)
+	}
+	content, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, []byte("%% FileIntegrity")) || !bytes.Contains(content, []byte("\n% FileIntegrity: ")) {
+		t.Errorf("Content after restamping = %q", content)
+	}
+}
+
+// TestConfigForStyleName tests style name resolution
+func TestConfigForStyleName(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantStyle CommentStyle
+		wantErr   bool
+	}{
+		{"go", GoStyle, false},
+		{"py", PythonStyle, false},
+		{"java", CStyle, false},
+		{"xml", HTMLStyle, false},
+		{"bash", ShellStyle, false},
+		{"css", CSSStyle, false},
+		{"cblock", CSSStyle, false},
+		{"templ", TemplStyle, false},
+		{"fortran", FortranStyle, false},
+		{"cobol", COBOLStyle, false},
+		{"objc", CStyle, false},
+		{"matlab", MatlabStyle, false},
+		{"mermaid", MermaidStyle, false},
+		{"mmd", MermaidStyle, false},
+		{"d2", D2Style, false},
+		{"pascal", CommentStyle{}, true},
+		{"", CommentStyle{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ConfigForStyleName(tt.name)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownStyle) {
+					t.Errorf("ConfigForStyleName(%q) error = %v, want ErrUnknownStyle", tt.name, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConfigForStyleName(%q) failed: %v", tt.name, err)
+			}
+			if config.CommentStyle != tt.wantStyle {
+				t.Errorf("ConfigForStyleName(%q) = %+v, want %+v", tt.name, config.CommentStyle, tt.wantStyle)
+			}
+		})
+	}
+}
+
+// TestStrictFormat ensures malformed comments are reported as format errors in strict mode
+func TestStrictFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   CommentStyle
+		content string
+		reason  string
+	}{
+		{"non-hex digest", GoStyle, "package main\n// FileIntegrity: ABCD12G4\n", "not hexadecimal"},
+		{"too many digits", GoStyle, "package main\n// FileIntegrity: ABCD12345\n", "has 9 digits"},
+		{"malformed version", GoStyle, "package main\n// FileIntegrity: v1.5:ABCD1234\n", "unsupported format version"},
+		{"missing suffix", HTMLStyle, "<p></p>\n<!-- FileIntegrity: ABCD1234\n", "missing suffix"},
+		{"wrong prefix", PythonStyle, "pass\n// FileIntegrity: ABCD1234\n", "missing prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			if _, err := tmpfile.Write([]byte(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			tmpfile.Close()
+
+			config := Config{CommentStyle: tt.style, BufferSize: 64 * 1024}
+
+			// Without strict mode the comment is simply not found
+			_, err = NewReader(config).VerifyFile(tmpfile.Name())
+			if !errors.Is(err, ErrNoComment) {
+				t.Errorf("VerifyFile() error = %v, want ErrNoComment", err)
+			}
+
+			config.StrictFormat = true
+			_, err = NewReader(config).VerifyFile(tmpfile.Name())
+			var formatErr *FormatError
+			if !errors.As(err, &formatErr) {
+				t.Fatalf("VerifyFile() error = %v, want *FormatError", err)
+			}
+			if !errors.Is(err, ErrInvalidFormat) {
+				t.Error("FormatError does not wrap ErrInvalidFormat")
+			}
+			if !bytes.Contains([]byte(formatErr.Reason), []byte(tt.reason)) {
+				t.Errorf("Reason = %q, want it to mention %q", formatErr.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+// TestForeignComment ensures an integrity-like line followed by content is never overwritten
+func TestForeignComment(t *testing.T) {
+	// The trailing text is short enough for the line to sit inside the final window
+	content := "func f() {\n// FileIntegrity: ABCD1234\n}\n"
+
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	// NoClobber refuses and leaves the file untouched
+	config := DefaultConfig()
+	config.NoClobber = true
+	err = NewWriter(config).ProcessFile(tmpfile.Name())
+	if !errors.Is(err, ErrAmbiguousComment) {
+		t.Fatalf("ProcessFile() error = %v, want ErrAmbiguousComment", err)
+	}
+	result, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != content {
+		t.Error("File was modified despite NoClobber")
+	}
+
+	// By default the line is kept as content, with a warning, and a new comment is appended
+	var warnings []string
+	config = DefaultConfig()
+	config.Warn = func(msg string) { warnings = append(warnings, msg) }
+	if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Got %d warnings, want 1: %q", len(warnings), warnings)
+	}
+	result, err = os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(result, []byte(content)) {
+		t.Errorf("Existing content was not preserved: %q", result)
+	}
+	if bytes.Count(result, []byte("FileIntegrity")) != 2 {
+		t.Errorf("Expected the pasted line plus one new comment, got %q", result)
+	}
+
+	// The new comment is genuine, so processing again neither warns nor changes the file
+	warnings = nil
+	if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("Second ProcessFile() failed: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Second run warned: %q", warnings)
+	}
+	if again, _ := os.ReadFile(tmpfile.Name()); !bytes.Equal(again, result) {
+		t.Error("Second run modified the file")
+	}
+
+	valid, err := NewReader(DefaultConfig()).VerifyFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyFile() failed: %v", err)
+	}
+	if !valid {
+		t.Error("VerifyFile() returned false")
+	}
+}
+
+// TestContentAfterComment ensures content appended after the comment is not ignored
+func TestContentAfterComment(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte("package main\n")); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	if err := ProcessGoFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessGoFile() failed: %v", err)
+	}
+
+	f, err := os.OpenFile(tmpfile.Name(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("}\n"))
+	f.Close()
+
+	_, err = VerifyGoFile(tmpfile.Name())
+	if !errors.Is(err, ErrTrailingData) {
+		t.Errorf("VerifyGoFile() error = %v, want ErrTrailingData", err)
+	}
+}
+
+// TestTrailingData ensures junk after the comment is rejected while trailing whitespace is not
+func TestTrailingData(t *testing.T) {
+	tests := []struct {
+		name    string
+		trailer string
+		wantErr error
+	}{
+		{"junk", "garbage", ErrTrailingData},
+		{"junk line", "\x00\x01junk\n", ErrTrailingData},
+		{"blank lines", "\n\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.go")
+			if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ProcessGoFile(path); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.WriteString(tt.trailer)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			valid, err := VerifyGoFile(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyGoFile() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !valid {
+				t.Error("VerifyGoFile() = false, want true")
+			}
+		})
+	}
+}
+
+// TestIntegrityLikeLineMidFile ensures an unstamped file containing an integrity-like line
+// followed by code reports no comment rather than trailing data
+func TestIntegrityLikeLineMidFile(t *testing.T) {
+	for _, content := range []string{
+		"package main\n// FileIntegrity: 12345678\nfunc main() {}\n",
+		"package main\n// FileIntegrity: 12345678 first=4\nfunc main() {}\n",
+	} {
+		got, err := NewReader(DefaultConfig()).Verify(strings.NewReader(content))
+		if got || !errors.Is(err, ErrNoComment) {
+			t.Errorf("Verify(%q) = %v, %v; want false, ErrNoComment", content, got, err)
+		}
+		if reason := ReasonFor(got, err); reason != ReasonNoComment {
+			t.Errorf("ReasonFor() = %s, want %s", reason, ReasonNoComment)
+		}
+	}
+}
+
+// TestIgnoreLines ensures lines matching IgnoreLines can change without invalidating the hash
+func TestIgnoreLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		modified string
+		wantOK   bool
+	}{
+		{
+			name:     "ignored line changes",
+			content:  "package main\n// Built: 2024-01-01\nfunc main() {}\n",
+			modified: "package main\n// Built: 2025-06-30\nfunc main() {}\n",
+			wantOK:   true,
+		},
+		{
+			name:     "ignored last line without newline",
+			content:  "package main\n// Built: 2024-01-01",
+			modified: "package main\n// Built: 2025-06-30",
+			wantOK:   true,
+		},
+		{
+			name:     "other line changes",
+			content:  "package main\n// Built: 2024-01-01\nfunc main() {}\n",
+			modified: "package main\n// Built: 2024-01-01\nfunc other() {}\n",
+			wantOK:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			if _, err := tmpfile.Write([]byte(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			tmpfile.Close()
+
+			config := DefaultConfig()
+			config.IgnoreLines = regexp.MustCompile(`^// Built: `)
+			if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+
+			result, err := os.ReadFile(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			modified := bytes.Replace(result, []byte(tt.content), []byte(tt.modified), 1)
+			if err := os.WriteFile(tmpfile.Name(), modified, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			valid, err := NewReader(config).VerifyFile(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("VerifyFile() failed: %v", err)
+			}
+			if valid != tt.wantOK {
+				t.Errorf("VerifyFile() = %v, want %v", valid, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestIgnoreMarkers ensures regions between ignore markers can change without invalidating the hash
+func TestIgnoreMarkers(t *testing.T) {
+	const banner = "// hashfile:ignore-start\n// Generated 2024-01-01\n// hashfile:ignore-end\n"
+	tests := []struct {
+		name     string
+		content  string
+		modified string
+		wantOK   bool
+	}{
+		{
+			name:     "region changes",
+			content:  "package main\n" + banner + "func main() {}\n",
+			modified: "package main\n// hashfile:ignore-start\n// Generated 2025-06-30\n// by ci\n// hashfile:ignore-end\nfunc main() {}\n",
+			wantOK:   true,
+		},
+		{
+			name:     "region removed",
+			content:  "package main\n" + banner + "func main() {}\n",
+			modified: "package main\nfunc main() {}\n",
+			wantOK:   true,
+		},
+		{
+			name:     "multiple regions",
+			content:  banner + "package main\n" + banner + "func main() {}\n",
+			modified: "// hashfile:ignore-start\n// v2\n// hashfile:ignore-end\npackage main\n/* hashfile:ignore-start */\nvar built = \"today\"\n/* hashfile:ignore-end */\nfunc main() {}\n",
+			wantOK:   true,
+		},
+		{
+			name:     "content between regions changes",
+			content:  banner + "package main\n" + banner + "func main() {}\n",
+			modified: banner + "package other\n" + banner + "func main() {}\n",
+			wantOK:   false,
+		},
+		{
+			name:     "unterminated region",
+			content:  "package main\n// hashfile:ignore-start\n// Generated 2024-01-01\n",
+			modified: "package main\n// hashfile:ignore-start\n// Generated 2025-06-30\n",
+			wantOK:   false,
+		},
+		{
+			name:     "unterminated region after a closed one",
+			content:  "package main\n" + banner + "// hashfile:ignore-start\nfunc main() {}\n",
+			modified: "package main\n" + banner + "// hashfile:ignore-start\nfunc other() {}\n",
+			wantOK:   false,
+		},
+		{
+			name:     "marker within a line",
+			content:  "package main\nvar s = \"hashfile:ignore-start\"\nfunc main() {}\nvar e = \"hashfile:ignore-end\"\n",
+			modified: "package main\nvar s = \"hashfile:ignore-start\"\nfunc other() {}\nvar e = \"hashfile:ignore-end\"\n",
+			wantOK:   false,
+		},
+		{
+			name:     "marker with other text",
+			content:  "package main\n// see hashfile:ignore-start\nfunc main() {}\n// hashfile:ignore-end\n",
+			modified: "package main\n// see hashfile:ignore-start\nfunc other() {}\n// hashfile:ignore-end\n",
+			wantOK:   false,
+		},
+		{
+			name:     "html markers",
+			content:  "package main\n<!-- hashfile:ignore-start -->\n// v1\n  <!--hashfile:ignore-end-->\n",
+			modified: "package main\n<!-- hashfile:ignore-start -->\n// v2\n  <!--hashfile:ignore-end-->\n",
+			wantOK:   true,
+		},
+		{
+			name:     "end marker alone",
+			content:  "package main\n// hashfile:ignore-end\nfunc main() {}\n",
+			modified: "package main\n// hashfile:ignore-end\nfunc other() {}\n",
+			wantOK:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := DefaultConfig()
+			config.IgnoreMarkers = true
+			if err := NewWriter(config).ProcessFile(filename); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+
+			result, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			modified := bytes.Replace(result, []byte(tt.content), []byte(tt.modified), 1)
+			if err := os.WriteFile(filename, modified, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			valid, err := NewReader(config).VerifyFile(filename)
+			if err != nil {
+				t.Fatalf("VerifyFile() failed: %v", err)
+			}
+			if valid != tt.wantOK {
+				t.Errorf("VerifyFile() = %v, want %v", valid, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestVerifyDetailed ensures detailed results report the compared CRCs and lengths
+func TestVerifyDetailed(t *testing.T) {
+	content := "package main\n\nfunc main() {}\n"
+
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	if err := ProcessGoFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessGoFile() failed: %v", err)
+	}
+	info, err := os.Stat(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewReader(DefaultConfig())
+	result, err := reader.VerifyDetailed(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyDetailed() failed: %v", err)
+	}
+	if !result.Valid || result.StoredCRC != result.ComputedCRC {
+		t.Errorf("VerifyDetailed() = %+v, want valid with matching CRCs", result)
+	}
+	if result.FileSize != info.Size() {
+		t.Errorf("FileSize = %d, want %d", result.FileSize, info.Size())
+	}
+	// The trailing newline before the comment is not hashed
+	if want := int64(len(content) - 1); result.ContentLen != want {
+		t.Errorf("ContentLen = %d, want %d", result.ContentLen, want)
+	}
+
+	// Corrupt the content and check the CRCs diverge
+	stamped, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tmpfile.Name(), bytes.Replace(stamped, []byte("main()"), []byte("mainX()"), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = reader.VerifyDetailed(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyDetailed() failed: %v", err)
+	}
+	if result.Valid || result.StoredCRC == result.ComputedCRC {
+		t.Errorf("VerifyDetailed() = %+v, want invalid with differing CRCs", result)
+	}
+	if result.FileSize != info.Size()+1 {
+		t.Errorf("FileSize = %d, want %d", result.FileSize, info.Size()+1)
+	}
+}
+
+// TestMixedStyleComments ensures a comment of another style is replaced rather than kept as content
+func TestMixedStyleComments(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "test_*.py")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte("def main():\n    pass\n")); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	// Stamp with the wrong style first, leaving a // comment behind
+	if err := NewWriter(DefaultConfig()).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() with GoStyle failed: %v", err)
+	}
+
+	var warnings []string
+	config := Config{CommentStyle: PythonStyle, BufferSize: 64 * 1024}
+	config.Warn = func(msg string) { warnings = append(warnings, msg) }
+	if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() with PythonStyle failed: %v", err)
+	}
+
+	result, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(result, []byte("// FileIntegrity:")) {
+		t.Errorf("Go style comment was not removed: %q", result)
+	}
+	if bytes.Count(result, []byte("FileIntegrity:")) != 1 {
+		t.Errorf("Expected exactly one integrity comment: %q", result)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Expected one warning, got %v", warnings)
+	}
+
+	valid, err := NewReader(config).VerifyFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyFile() failed: %v", err)
+	}
+	if !valid {
+		t.Error("VerifyFile() returned false")
+	}
+
+	// Switching back replaces the # comment in turn
+	if err := NewWriter(DefaultConfig()).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() with GoStyle failed: %v", err)
+	}
+	result, err = os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result[:len(result)-len("// FileIntegrity: 00000000\n")], []byte("def main():\n    pass\n")) {
+		t.Errorf("Unexpected content after switching styles back: %q", result)
+	}
+}
+
+// TestVerifyTee ensures content is copied while verifying, with and without the comment
+func TestVerifyTee(t *testing.T) {
+	content := "package main\n\n" + strings.Repeat("// filler line\n", 100) + "func main() {}\n"
+
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	if err := ProcessGoFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessGoFile() failed: %v", err)
+	}
+	stamped, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		stripComment bool
+		want         string
+	}{
+		{"with comment", false, string(stamped)},
+		{"strip comment", true, content},
+	}
+
+	reader := NewReader(DefaultConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One byte at a time exercises short reads in the sliding window
+			var out bytes.Buffer
+			src := iotest.OneByteReader(bytes.NewReader(stamped))
+			valid, err := reader.VerifyTee(src, &out, tt.stripComment)
+			if err != nil {
+				t.Fatalf("VerifyTee() failed: %v", err)
+			}
+			if !valid {
+				t.Error("VerifyTee() returned false")
+			}
+			if out.String() != tt.want {
+				t.Errorf("VerifyTee() copied %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestProcessFileWithKey ensures per-call keys are written, verifiable, and cached
+func TestProcessFileWithKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		style CommentStyle
+		key   string
+		want  string
+	}{
+		{"go style", GoStyle, "TenantA", "// TenantA: "},
+		{"html style", HTMLStyle, "TenantB", "<!-- TenantB: "},
+		{"templ style", TemplStyle, "TenantC", "const TenantC = \""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			if _, err := tmpfile.Write([]byte("content\n")); err != nil {
+				t.Fatal(err)
+			}
+			tmpfile.Close()
+
+			config := Config{CommentStyle: tt.style, BufferSize: 64 * 1024}
+			writer := NewWriter(config)
+			if err := writer.ProcessFileWithKey(tmpfile.Name(), tt.key); err != nil {
+				t.Fatalf("ProcessFileWithKey() failed: %v", err)
+			}
+			if writer.withKey(tt.key) != writer.withKey(tt.key) {
+				t.Error("Writer for key was not cached")
+			}
+
+			result, err := os.ReadFile(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(result, []byte(tt.want)) {
+				t.Errorf("Expected %q in output, got %q", tt.want, result)
+			}
+			if bytes.Contains(result, []byte(DefaultKey)) {
+				t.Errorf("Default key should not appear in output: %q", result)
+			}
+
+			config.Key = tt.key
+			valid, err := NewReader(config).VerifyFile(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("VerifyFile() failed: %v", err)
+			}
+			if !valid {
+				t.Error("VerifyFile() returned false")
+			}
+		})
+	}
+}
+
+// TestPreserveModeline ensures the comment goes before a trailing modeline and stays idempotent
+func TestPreserveModeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		modeline string
+	}{
+		{"vim", "package main\n", "// vim: set ft=go:\n"},
+		{"emacs", "def main():\n    pass\n", "# -*- mode: python -*-\n"},
+		{"no trailing newline", "package main\n", "// vim: ts=4"},
+		{"CRLF", "package main\r\n", "// vim: set ff=dos:\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			if _, err := tmpfile.Write([]byte(tt.content + tt.modeline)); err != nil {
+				t.Fatal(err)
+			}
+			tmpfile.Close()
+
+			config := DefaultConfig()
+			config.PreserveModeline = true
+			writer := NewWriter(config)
+			reader := NewReader(config)
+
+			if err := writer.ProcessFile(tmpfile.Name()); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			content1, err := os.ReadFile(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(content1, []byte(tt.modeline)) {
+				t.Errorf("Modeline is not the last line: %q", content1)
+			}
+			if !bytes.HasPrefix(content1, []byte(tt.content)) {
+				t.Errorf("Content was not preserved: %q", content1)
+			}
+
+			valid, err := reader.VerifyFile(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("VerifyFile() failed: %v", err)
+			}
+			if !valid {
+				t.Error("VerifyFile() returned false")
+			}
+
+			// Second run is a no-op
+			info1, err := os.Stat(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.ProcessFile(tmpfile.Name()); err != nil {
+				t.Fatalf("Second ProcessFile() failed: %v", err)
+			}
+			info2, err := os.Stat(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			content2, err := os.ReadFile(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content1, content2) || !info1.ModTime().Equal(info2.ModTime()) {
+				t.Error("File changed on second process")
+			}
+
+			// The modeline is not part of the hash
+			edited := bytes.Replace(content2, []byte(tt.modeline), []byte("// vim: set ft=text:\n"), 1)
+			if err := os.WriteFile(tmpfile.Name(), edited, 0644); err != nil {
+				t.Fatal(err)
+			}
+			valid, err = reader.VerifyFile(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("VerifyFile() after editing modeline failed: %v", err)
+			}
+			if !valid {
+				t.Error("Editing the modeline invalidated the hash")
+			}
+		})
+	}
+}
+
+// TestBlankLineBefore ensures the separating blank line is written once and not hashed
+func TestBlankLineBefore(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   CommentStyle
+		content string
+		want    string
+	}{
+		{"LF", GoStyle, "package main\n", "package main\n\n// FileIntegrity: "},
+		{"CRLF", HTMLStyle, "<p></p>\r\n", "<p></p>\r\n\r\n<!-- FileIntegrity: "},
+		{"no trailing newline", GoStyle, "package main", "package main\n\n// FileIntegrity: "},
+		{"existing blank line", GoStyle, "package main\n\n", "package main\n\n\n// FileIntegrity: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			if _, err := tmpfile.Write([]byte(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			tmpfile.Close()
+
+			config := Config{CommentStyle: tt.style, BufferSize: 64 * 1024, BlankLineBefore: true}
+			writer := NewWriter(config)
+
+			if err := writer.ProcessFile(tmpfile.Name()); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			content1, err := os.ReadFile(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(content1, []byte(tt.want)) {
+				t.Errorf("Output %q does not start with %q", content1, tt.want)
+			}
+
+			valid, err := NewReader(config).VerifyFile(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("VerifyFile() failed: %v", err)
+			}
+			if !valid {
+				t.Error("VerifyFile() returned false")
+			}
+
+			// Second run with the same setting is a no-op
+			info1, err := os.Stat(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.ProcessFile(tmpfile.Name()); err != nil {
+				t.Fatalf("Second ProcessFile() failed: %v", err)
+			}
+			info2, err := os.Stat(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			content2, err := os.ReadFile(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content1, content2) || !info1.ModTime().Equal(info2.ModTime()) {
+				t.Errorf("File changed on second process: %q -> %q", content1, content2)
+			}
+		})
+	}
+}
+
+// TestGeneratedMarker ensures the marker is written once just before the comment and not hashed
+func TestGeneratedMarker(t *testing.T) {
+	const marker = "// Code generated by gen. DO NOT EDIT."
+	tests := []struct {
+		name    string
+		content string
+		config  func(*Config)
+		want    string
+	}{
+		{"new", "package main\n", nil, "package main\n" + marker + "\n// FileIntegrity: "},
+		{"CRLF", "package main\r\n", nil, "package main\r\n" + marker + "\r\n// FileIntegrity: "},
+		{"empty", "", nil, marker + "\n// FileIntegrity: "},
+		{"stamped without marker", "package main\n// FileIntegrity: 7FE7DFB2\n", nil,
+			"package main\n" + marker + "\n// FileIntegrity: 7FE7DFB2\n"},
+		{"blank line", "package main\n", func(c *Config) { c.BlankLineBefore = true },
+			"package main\n\n" + marker + "\n// FileIntegrity: 7FE7DFB2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gen.go")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := DefaultConfig()
+			config.GeneratedMarker = marker
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			writer := NewWriter(config)
+
+			if err := writer.ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			content1, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(content1, []byte(tt.want)) {
+				t.Errorf("Output %q does not start with %q", content1, tt.want)
+			}
+
+			// The marker is not hashed, so the digest is that of the content alone
+			plain := DefaultConfig()
+			crc, err := NewReader(plain).DigestReader(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := NewReader(config).VerifyDetailed(path)
+			if err != nil || !result.Valid || result.StoredCRC != crc {
+				t.Errorf("VerifyDetailed() = %+v, %v; want valid with CRC %08X", result, err, crc)
+			}
+
+			// Reprocessing neither duplicates the marker nor rewrites the file
+			if err := writer.ProcessFile(path); err != nil {
+				t.Fatalf("Second ProcessFile() failed: %v", err)
+			}
+			content2, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content1, content2) {
+				t.Errorf("File changed on second process: %q -> %q", content1, content2)
+			}
+			if n := bytes.Count(content2, []byte(marker)); n != 1 {
+				t.Errorf("Marker written %d times", n)
+			}
+
+			// Removing the comment removes the marker with it
+			if _, err := writer.RemoveComment(path); err != nil {
+				t.Fatal(err)
+			}
+			if content, _ := os.ReadFile(path); bytes.Contains(content, []byte(marker)) {
+				t.Errorf("Content after RemoveComment() = %q", content)
+			}
+		})
+	}
+
+	config := DefaultConfig()
+	config.GeneratedMarker = "// a\n// b"
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() accepted a multi-line GeneratedMarker")
+	}
+}
+
+// TestNoFinalNewline ensures the comment can end the file without a line ending
+func TestNoFinalNewline(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		config  func(*Config)
+	}{
+		{"empty", "", "// FileIntegrity: 00000000", nil},
+		{"no trailing newline", "token", "token\n// FileIntegrity: ", nil},
+		{"trailing newline", "token\n", "token\n// FileIntegrity: ", nil},
+		{"CRLF", "token\r\n", "token\r\n// FileIntegrity: ", nil},
+		{"newline after comment", "token\n// FileIntegrity: 5F37A13B\n", "token\n// FileIntegrity: 5F37A13B", nil},
+		{"modeline", "token\n// vim: set ft=go:\n", "token\n// FileIntegrity: 5F37A13B\n// vim: set ft=go:\n",
+			func(c *Config) { c.PreserveModeline = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "token.go")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := DefaultConfig()
+			config.NoFinalNewline = true
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			writer := NewWriter(config)
+
+			if err := writer.ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			content1, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(content1, []byte(tt.want)) {
+				t.Errorf("Output %q does not start with %q", content1, tt.want)
+			}
+			if tt.config == nil && bytes.HasSuffix(content1, []byte("\n")) {
+				t.Errorf("Output %q ends with a newline", content1)
+			}
+
+			valid, err := NewReader(config).VerifyFile(path)
+			if err != nil || !valid {
+				t.Errorf("VerifyFile() = %v, %v; want true", valid, err)
+			}
+
+			// Processing again is a no-op
+			result, err := writer.Inspect(path)
+			if err != nil {
+				t.Fatalf("Inspect() failed: %v", err)
+			}
+			if result.Changed {
+				t.Error("Inspect() reports a change after processing")
+			}
+		})
+	}
+}
+
+// TestRemoveComment ensures stamping then removing restores the content
+func TestRemoveComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		content string
+	}{
+		{"go style", DefaultConfig(), "package main\n\nfunc main() {}\n"},
+		{"html CRLF", Config{CommentStyle: HTMLStyle, BufferSize: 64 * 1024}, "<p>hi</p>\r\n"},
+		{"blank line", Config{CommentStyle: GoStyle, BufferSize: 64 * 1024, BlankLineBefore: true}, "package main\n"},
+		{"modeline", Config{CommentStyle: GoStyle, BufferSize: 64 * 1024, PreserveModeline: true}, "package main\n// vim: set ft=go:\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+
+			if _, err := tmpfile.Write([]byte(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			tmpfile.Close()
+
+			writer := NewWriter(tt.config)
+			if err := writer.ProcessFile(tmpfile.Name()); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+
+			removed, err := writer.RemoveComment(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("RemoveComment() failed: %v", err)
+			}
+			if !removed {
+				t.Error("RemoveComment() reported no comment")
+			}
+
+			result, err := os.ReadFile(tmpfile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.content {
+				t.Errorf("Content after removal = %q, want %q", result, tt.content)
+			}
+
+			// Removing again is a no-op
+			removed, err = writer.RemoveComment(tmpfile.Name())
+			if err != nil {
+				t.Fatalf("Second RemoveComment() failed: %v", err)
+			}
+			if removed {
+				t.Error("Second RemoveComment() reported a comment")
+			}
+		})
+	}
+}
+
+// TestStripComment ensures comments are removed in memory exactly as RemoveComment does on disk
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		content string
+	}{
+		{"go style", DefaultConfig(), "package main\n\nfunc main() {}\n"},
+		{"html CRLF", Config{CommentStyle: HTMLStyle, BufferSize: 64 * 1024}, "<p>hi</p>\r\n"},
+		{"blank line", Config{CommentStyle: GoStyle, BufferSize: 64 * 1024, BlankLineBefore: true}, "package main\n"},
+		{"modeline", Config{CommentStyle: GoStyle, BufferSize: 64 * 1024, PreserveModeline: true}, "package main\n// vim: set ft=go:\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stamped bytes.Buffer
+			if _, err := NewWriter(tt.config).processStream(strings.NewReader(tt.content), &stamped); err != nil {
+				t.Fatalf("processStream() failed: %v", err)
+			}
+
+			got, found := StripComment(stamped.Bytes(), tt.config)
+			if !found {
+				t.Error("StripComment() reported no comment")
+			}
+			if string(got) != tt.content {
+				t.Errorf("StripComment() = %q, want %q", got, tt.content)
+			}
+
+			got, found = StripComment([]byte(tt.content), tt.config)
+			if found || string(got) != tt.content {
+				t.Errorf("StripComment() without a comment = %q, %v; want content unchanged, false", got, found)
+			}
+		})
+	}
+}
+
+// TestStyleMutationAfterConstruction ensures changing a predefined style does not affect existing writers
+func TestStyleMutationAfterConstruction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := NewWriter(DefaultConfig())
+	reader := NewReader(DefaultConfig())
+
+	saved := GoStyle
+	GoStyle.Prefix = "xx "
+	defer func() { GoStyle = saved }()
+
+	if err := writer.ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "\n// FileIntegrity: ") {
+		t.Errorf("Writer used mutated style:\n%s", content)
+	}
+
+	valid, err := reader.VerifyFile(path)
+	if err != nil || !valid {
+		t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+	}
+}
+
+// TestConfigClone ensures a cloned config is independent of the original
+func TestConfigClone(t *testing.T) {
+	config := DefaultConfig()
+	clone := config.Clone()
+	clone.CommentStyle.Prefix = "# "
+	clone.Key = "Other"
+
+	if config.CommentStyle.Prefix != "// " || config.Key != "" {
+		t.Errorf("Modifying clone changed original: %+v", config)
+	}
+
+	config.AcceptKeys = []string{"Old"}
+	clone = config.Clone()
+	clone.AcceptKeys[0] = "Changed"
+	if config.AcceptKeys[0] != "Old" {
+		t.Errorf("Modifying clone's AcceptKeys changed original: %q", config.AcceptKeys)
+	}
+
+	config.ExtensionOverrides = map[string]CommentStyle{".txt": PythonStyle}
+	clone = config.Clone()
+	clone.ExtensionOverrides[".txt"] = SQLStyle
+	if config.ExtensionOverrides[".txt"] != PythonStyle {
+		t.Errorf("Modifying clone's ExtensionOverrides changed original: %v", config.ExtensionOverrides)
+	}
+
+	config.IgnoreLines = regexp.MustCompile(`^// Built: `)
+	clone = config.Clone()
+	if clone.IgnoreLines == config.IgnoreLines || clone.IgnoreLines.String() != config.IgnoreLines.String() {
+		t.Errorf("Clone() IgnoreLines = %p, want a copy of %p", clone.IgnoreLines, config.IgnoreLines)
+	}
+}
+
+// TestConfigForFilename ensures extension overrides apply to one Config only
+func TestConfigForFilename(t *testing.T) {
+	overridden := DefaultConfig()
+	overridden.Key = "Checksum"
+	overridden.ExtensionOverrides = map[string]CommentStyle{".txt": PythonStyle, ".go": CSSStyle}
+	plain := DefaultConfig()
+	plain.CommentStyle = SQLStyle
+
+	tests := []struct {
+		filename string
+		base     Config
+		want     CommentStyle
+	}{
+		{"notes.txt", overridden, PythonStyle},
+		{"main.go", overridden, CSSStyle},
+		{"page.html", overridden, HTMLStyle},
+		{"notes.unknown", overridden, GoStyle},
+		{"notes.txt", plain, SQLStyle},
+		{"main.go", plain, GoStyle},
+	}
+
+	for _, tt := range tests {
+		got := ConfigForFilename(tt.filename, tt.base)
+		if got.CommentStyle != tt.want {
+			t.Errorf("ConfigForFilename(%q) style = %+v, want %+v", tt.filename, got.CommentStyle, tt.want)
+		}
+		if got.Key != tt.base.Key {
+			t.Errorf("ConfigForFilename(%q) changed Key to %q", tt.filename, got.Key)
+		}
+	}
+
+	// The built-in mapping is unchanged
+	if style := ConfigForExtension(".txt").CommentStyle; style != GoStyle {
+		t.Errorf("ConfigForExtension(.txt) style = %+v, want the default", style)
+	}
+	if _, ok := SupportedExtensions()[".txt"]; ok {
+		t.Error("override leaked into SupportedExtensions()")
+	}
+
+	// A file processed with the override gets its style
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWriter(ConfigForFilename(path, overridden)).ProcessFile(path); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "# Checksum: ") {
+		t.Errorf("override not applied:\n%s", content)
+	}
+}
+
+// TestInspect ensures Inspect distinguishes appending a comment from rewriting one
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		stamp    bool
+		modeline bool
+		want     ProcessResult
+	}{
+		{"empty", "", false, false, ProcessResult{Changed: true, AppendOnly: true}},
+		{"no comment", "package main\n", false, false, ProcessResult{Changed: true, AppendOnly: true, HashedBytes: 12}},
+		{"crlf", "package main\r\n", false, false, ProcessResult{Changed: true, AppendOnly: true, HashedBytes: 12}},
+		{"no trailing newline", "package main", false, false, ProcessResult{Changed: true, AppendOnly: true, HashedBytes: 12}},
+		{"correct comment", "package main\n", true, false, ProcessResult{HashedBytes: 12}},
+		{"wrong comment", "package main\n// FileIntegrity: 00000000\n", false, false, ProcessResult{Changed: true, HashedBytes: 12}},
+		{"modeline", "package main\n// vim: set ft=go:\n", false, true, ProcessResult{Changed: true, HashedBytes: 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.go")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := DefaultConfig()
+			config.PreserveModeline = tt.modeline
+			writer := NewWriter(config)
+
+			if tt.stamp {
+				if err := writer.ProcessFile(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := writer.Inspect(path)
+			if err != nil {
+				t.Fatalf("Inspect() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Inspect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestInPlace ensures in-place processing produces the same result as a rewrite
+func TestInPlace(t *testing.T) {
+	inputs := []string{
+		"",
+		"package main\n",
+		"package main",
+		"package main\r\nfunc main() {}\r\n",
+		"package main\n// FileIntegrity: 00000000\n",
+		"package main\n# FileIntegrity: 00000000\n",
+		strings.Repeat("// filler line\n", 10000),
+	}
+
+	for _, input := range inputs {
+		var outputs [2][]byte
+		for i, inPlace := range []bool{false, true} {
+			path := filepath.Join(t.TempDir(), "test.go")
+			if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := DefaultConfig()
+			config.InPlace = inPlace
+			config.BufferSize = 4096
+			if err := NewWriter(config).ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile(InPlace=%v) failed: %v", inPlace, err)
+			}
+			var err error
+			if outputs[i], err = os.ReadFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("InPlace output differs for %.40q:\nrewrite: %.80q\nin place: %.80q", input, outputs[0], outputs[1])
+		}
+	}
+}
+
+// TestTempFileMode ensures the temp file is created with the requested mode and the original mode is restored
+func TestTempFileMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		srcMode  os.FileMode
+		tempMode os.FileMode
+		noFollow bool
+		want     os.FileMode
+	}{
+		{"default uses source mode", 0644, 0, false, 0644},
+		{"explicit mode", 0600, 0640, false, 0640},
+		{"no follow defaults to owner only", 0644, 0, true, 0600},
+		{"no follow explicit mode", 0644, 0640, true, 0640},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.go")
+			if err := os.WriteFile(path, []byte("package main\n"), tt.srcMode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.srcMode); err != nil {
+				t.Fatal(err)
+			}
+
+			var tempMode os.FileMode
+			config := Config{TempFileMode: tt.tempMode, NoFollow: tt.noFollow}
+			err := config.rewriteFile(path, nil, func(src io.Reader, dst io.Writer) (bool, error) {
+				info, err := dst.(*os.File).Stat()
+				if err != nil {
+					return false, err
+				}
+				tempMode = info.Mode().Perm()
+				_, err = io.Copy(dst, src)
+				return false, err
+			})
+			if err != nil {
+				t.Fatalf("rewriteFile() failed: %v", err)
+			}
+			if tempMode != tt.want {
+				t.Errorf("Temp file mode = %o, want %o", tempMode, tt.want)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.srcMode {
+				t.Errorf("Final mode = %o, want %o", info.Mode().Perm(), tt.srcMode)
+			}
+		})
+	}
+}
+
+// TestTempDir ensures rewrites create their temporary file in TempDir and leave nothing behind
+func TestTempDir(t *testing.T) {
+	dir := t.TempDir()
+	tempDir := t.TempDir()
+	path := filepath.Join(dir, "test.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.TempDir = tempDir
+	var tempName string
+	err := config.rewriteFile(path, nil, func(src io.Reader, dst io.Writer) (bool, error) {
+		tempName = dst.(*os.File).Name()
+		result, err := NewWriter(config).processStream(src, dst)
+		return !result.Changed, err
+	})
+	if err != nil {
+		t.Fatalf("rewriteFile() failed: %v", err)
+	}
+	if filepath.Dir(tempName) != tempDir {
+		t.Errorf("temp file created in %s, want %s", filepath.Dir(tempName), tempDir)
+	}
+
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	if valid, err := NewReader(config).VerifyFile(path); err != nil || !valid {
+		t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+	}
+	for _, d := range []string{dir, tempDir} {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]int{dir: 1, tempDir: 0}[d]; len(entries) != want {
+			t.Errorf("%s has %d entries, want %d", d, len(entries), want)
+		}
+	}
+}
+
+// TestCopyContent ensures the fallback for failed renames overwrites the file in place
+func TestCopyContent(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("old content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyContent(src, dst); err != nil {
+		t.Fatalf("copyContent() failed: %v", err)
+	}
+	content, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new\n" {
+		t.Errorf("content = %q, want %q", content, "new\n")
+	}
+	after, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || after.Mode().Perm() != 0644 {
+		t.Errorf("copyContent() replaced the file or changed its mode to %o", after.Mode().Perm())
+	}
+}
+
+// TestRenameFallback ensures a rename across filesystems falls back to overwriting the file,
+// other rename errors do not, and a failed overwrite keeps the temporary file
+func TestRenameFallback(t *testing.T) {
+	renameErr := syscall.EXDEV
+	t.Cleanup(func() { renameFile = os.Rename })
+	renameFile = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: renameErr}
+	}
+
+	setup := func(t *testing.T) (path string, config Config) {
+		path = filepath.Join(t.TempDir(), "test.go")
+		if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config = DefaultConfig()
+		config.TempDir = t.TempDir()
+		return path, config
+	}
+	tempFiles := func(t *testing.T, dir string) int {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+
+	t.Run("cross-device", func(t *testing.T) {
+		path, config := setup(t)
+		before, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NewWriter(config).ProcessFile(path); err != nil {
+			t.Fatalf("ProcessFile() failed: %v", err)
+		}
+		if valid, err := NewReader(config).VerifyFile(path); err != nil || !valid {
+			t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+		}
+		after, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(before, after) {
+			t.Error("fallback replaced the file instead of overwriting it")
+		}
+		if n := tempFiles(t, config.TempDir); n != 0 {
+			t.Errorf("TempDir has %d entries, want 0", n)
+		}
+	})
+
+	t.Run("failed overwrite", func(t *testing.T) {
+		path, config := setup(t)
+		// Replace the file with a directory once it is read, so overwriting it fails
+		err := config.rewriteFile(path, nil, func(src io.Reader, dst io.Writer) (bool, error) {
+			result, err := NewWriter(config).processStream(src, dst)
+			if err != nil {
+				return false, err
+			}
+			if err := os.Remove(path); err != nil {
+				return false, err
+			}
+			return !result.Changed, os.Mkdir(path, 0755)
+		})
+		entries, readErr := os.ReadDir(config.TempDir)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("TempDir has %d entries, want the kept temporary file", len(entries))
+		}
+		kept := filepath.Join(config.TempDir, entries[0].Name())
+		if err == nil || !strings.Contains(err.Error(), kept) {
+			t.Errorf("rewriteFile() error = %v, want one naming %s", err, kept)
+		}
+		content, readErr := os.ReadFile(kept)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if !strings.HasPrefix(string(content), "package main\n// FileIntegrity: ") {
+			t.Errorf("kept temporary file = %q, want the new content", content)
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		renameErr = syscall.EACCES
+		defer func() { renameErr = syscall.EXDEV }()
+		path, config := setup(t)
+		if err := NewWriter(config).ProcessFile(path); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("ProcessFile() error = %v, want ErrPermission", err)
+		}
+		if content, err := os.ReadFile(path); err != nil || string(content) != "package main\n" {
+			t.Errorf("content = %q, %v; want the file untouched", content, err)
+		}
+		if n := tempFiles(t, config.TempDir); n != 0 {
+			t.Errorf("TempDir has %d entries, want 0", n)
+		}
+	})
+}
+
+// TestMaxHashBytes ensures only the first MaxHashBytes bytes are covered and the limit is recorded
+func TestMaxHashBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.go")
+	body := "package main\n" + strings.Repeat("// filler\n", 1000)
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.MaxHashBytes = 100
+	config.BufferSize = 512
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCRC := crc32.ChecksumIEEE([]byte(body[:100]))
+	if want := fmt.Sprintf("// FileIntegrity: %08X first=100\n", wantCRC); !strings.HasSuffix(string(content), want) {
+		t.Fatalf("Expected comment %q, got:\n%s", want, content[len(content)-60:])
+	}
+
+	// Changes beyond the limit are not detected, changes within it are
+	edited := strings.Replace(string(content), "// filler\n// filler\n// FileIntegrity", "// filler\n// edited\n// FileIntegrity", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewReader(config).VerifyDetailed(path)
+	if err != nil || !result.Valid {
+		t.Errorf("Edit after limit: VerifyDetailed() = %+v, %v; want valid", result, err)
+	}
+	if result.ContentLen != 100 {
+		t.Errorf("ContentLen = %d, want 100", result.ContentLen)
+	}
+
+	// Verification uses the recorded limit whatever the configuration says
+	for _, limit := range []int{0, 50, 100000} {
+		other := DefaultConfig()
+		other.MaxHashBytes = limit
+		valid, err := NewReader(other).VerifyFile(path)
+		if err != nil || !valid {
+			t.Errorf("MaxHashBytes=%d: VerifyFile() = %v, %v; want true, nil", limit, valid, err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Replace(edited, "package main", "package mine", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := NewReader(config).VerifyFile(path); err != nil || valid {
+		t.Errorf("Edit within limit: VerifyFile() = %v, %v; want false, nil", valid, err)
+	}
+}
+
+// TestMaxHashBytesChanged ensures a different limit rewrites the comment
+func TestMaxHashBytesChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.MaxHashBytes = 1000
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+
+	// Content is shorter than either limit, so the CRC is the same but the recorded limit differs
+	config.MaxHashBytes = 2000
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), " first=2000\n") || strings.Count(string(content), "FileIntegrity") != 1 {
+		t.Errorf("Expected a single comment with the new limit, got:\n%s", content)
+	}
+
+	// Without a limit the suffix is dropped
+	if err := NewWriter(DefaultConfig()).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	if content, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "first=") {
+		t.Errorf("Expected no limit in comment, got:\n%s", content)
+	}
+}
+
+// TestVerify ensures content can be verified from a reader
+func TestVerify(t *testing.T) {
+	writer := NewWriter(DefaultConfig())
+	content := "package main\n" + writer.FormatComment(crc32.ChecksumIEEE([]byte("package main")))
+
+	reader := NewReader(DefaultConfig())
+	valid, err := reader.Verify(strings.NewReader(content))
+	if err != nil || !valid {
+		t.Errorf("Verify() = %v, %v; want true, nil", valid, err)
+	}
+
+	valid, err = reader.Verify(strings.NewReader("package mine\n" + content[len("package main\n"):]))
+	if err != nil || valid {
+		t.Errorf("Verify() of modified content = %v, %v; want false, nil", valid, err)
+	}
+}
+
+// TestJSONC ensures JSONC files round-trip with a trailing // comment and plain JSON is not mapped
+func TestJSONC(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "test_*.jsonc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	tmpfile.WriteString("{\n  // editor settings\n  \"editor.tabSize\": 2,\n}\n")
+	tmpfile.Close()
+
+	config := ConfigForExtension(".jsonc")
+	if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	content, _ := os.ReadFile(tmpfile.Name())
+	if !strings.HasSuffix(string(content), "}\n// FileIntegrity: "+string(content[len(content)-9:])) {
+		t.Errorf("Unexpected content:\n%s", content)
+	}
+
+	valid, err := NewReader(config).VerifyFile(tmpfile.Name())
+	if err != nil || !valid {
+		t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+	}
+
+	// Plain JSON has no comment syntax, so it must not share the JSONC mapping
+	if _, ok := SupportedExtensions()[".json"]; ok {
+		t.Error(".json should not be mapped to a comment style")
+	}
+}
+
+// TestConfigValidate ensures buffers too small for the comment window are rejected
+func TestConfigValidate(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Errorf("DefaultConfig().Validate() = %v", err)
+	}
+
+	config.BufferSize = config.windowSize()
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() accepted a buffer no larger than the window")
+	}
+
+	// The smallest valid buffer must still process and verify correctly
+	config.BufferSize = config.windowSize() + 1
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() = %v for minimum buffer", err)
+	}
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	tmpfile.WriteString(strings.Repeat("package main\n", 100))
+	tmpfile.Close()
+
+	if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	valid, err := NewReader(config).VerifyFile(tmpfile.Name())
+	if err != nil || !valid {
+		t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+	}
+}
+
+// TestIdempotencyAllStyles ensures a second ProcessFile is a no-op for every named style
+func TestIdempotencyAllStyles(t *testing.T) {
+	contents := map[string]string{
+		"lf":         "line one\nline two\n",
+		"crlf":       "line one\r\nline two\r\n",
+		"no newline": "line one\nline two",
+		"empty":      "",
+	}
+
+	for _, name := range SupportedStyles() {
+		for variant, content := range contents {
+			t.Run(name+"/"+variant, func(t *testing.T) {
+				config, err := ConfigForStyleName(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				path := filepath.Join(t.TempDir(), "test")
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				writer := NewWriter(config)
+				if err := writer.ProcessFile(path); err != nil {
+					t.Fatalf("First ProcessFile() failed: %v", err)
+				}
+
+				// Backdate the file so any rewrite would show in the mtime
+				past := time.Now().Add(-time.Hour).Truncate(time.Second)
+				if err := os.Chtimes(path, past, past); err != nil {
+					t.Fatal(err)
+				}
+				content1, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := writer.ProcessFile(path); err != nil {
+					t.Fatalf("Second ProcessFile() failed: %v", err)
+				}
+				content2, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(content1, content2) {
+					t.Errorf("Content changed on second process:\nfirst:  %q\nsecond: %q", content1, content2)
+				}
+				if !info.ModTime().Equal(past) {
+					t.Errorf("File rewritten on second process: mtime %v, want %v", info.ModTime(), past)
+				}
+
+				valid, err := NewReader(config).VerifyFile(path)
+				if err != nil || !valid {
+					t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+				}
+			})
+		}
+	}
+}
+
+// TestProcessFileInfo ensures a caller-supplied FileInfo is used for attribute preservation
+func TestProcessFileInfo(t *testing.T) {
+	for _, inPlace := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "test.go")
+		if err := os.WriteFile(path, []byte("package main\n// FileIntegrity: 00000000\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Permissions changed after the stat are replaced by those in info
+		if err := os.Chmod(path, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		config := DefaultConfig()
+		config.InPlace = inPlace
+		if err := NewWriter(config).ProcessFileInfo(path, info); err != nil {
+			t.Fatalf("InPlace=%v: ProcessFileInfo() failed: %v", inPlace, err)
+		}
+
+		valid, err := VerifyGoFile(path)
+		if err != nil || !valid {
+			t.Errorf("InPlace=%v: VerifyGoFile() = %v, %v; want true, nil", inPlace, valid, err)
+		}
+		after, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Mode().Perm() != 0644 {
+			t.Errorf("InPlace=%v: mode = %o, want 0644 from supplied info", inPlace, after.Mode().Perm())
+		}
+	}
+}
+
+// TestHTMLNoTrailingNewline ensures the HTML comment goes on its own line when content lacks a final newline
+func TestHTMLNoTrailingNewline(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"lf", "<html>\n<p>hi</p></html>", "<html>\n<p>hi</p></html>\n<!-- FileIntegrity: %08X -->\n"},
+		{"crlf", "<html>\r\n<p>hi</p></html>", "<html>\r\n<p>hi</p></html>\r\n<!-- FileIntegrity: %08X -->\r\n"},
+		{"ends in comment", "<p>hi</p><!-- note -->", "<p>hi</p><!-- note -->\n<!-- FileIntegrity: %08X -->\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "test_*.html")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tmpfile.Name())
+			tmpfile.WriteString(tt.content)
+			tmpfile.Close()
+
+			config := ConfigForExtension(".html")
+			writer := NewWriter(config)
+			if err := writer.ProcessFile(tmpfile.Name()); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+
+			got, _ := os.ReadFile(tmpfile.Name())
+			want := fmt.Sprintf(tt.want, crc32.ChecksumIEEE([]byte(tt.content)))
+			if string(got) != want {
+				t.Errorf("ProcessFile() wrote %q, want %q", got, want)
+			}
+
+			valid, err := NewReader(config).VerifyFile(tmpfile.Name())
+			if err != nil || !valid {
+				t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+			}
+		})
+	}
+}
+
+// TestForce ensures Force rewrites a file whose comment is already correct
+func TestForce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ProcessGoFile(path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.Force = true
+	result, err := NewWriter(config).Inspect(path)
+	if err != nil || !result.Changed {
+		t.Errorf("Inspect() = %+v, %v; want Changed", result, err)
+	}
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("Content changed:\nbefore %q\nafter  %q", before, after)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Equal(past) {
+		t.Error("Force did not rewrite the file")
+	}
+}
+
+// TestMaxFileSize ensures files over the limit are refused without being read or modified
+func TestMaxFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.go")
+	content := "package main\n" + strings.Repeat("// filler\n", 100)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.MaxFileSize = int64(len(content)) - 1
+	if err := NewWriter(config).ProcessFile(path); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("ProcessFile() error = %v, want ErrFileTooLarge", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != content {
+		t.Error("ProcessFile() modified a file over the limit")
+	}
+	if _, err := NewReader(config).VerifyFile(path); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("VerifyFile() error = %v, want ErrFileTooLarge", err)
+	}
+	if _, err := NewReader(config).Digest(path); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Digest() error = %v, want ErrFileTooLarge", err)
+	}
+
+	// A file exactly at the limit is processed, and the comment may take it over the limit
+	config.MaxFileSize = int64(len(content))
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() at the limit failed: %v", err)
+	}
+	config.MaxFileSize = 0
+	if valid, err := NewReader(config).VerifyFile(path); err != nil || !valid {
+		t.Errorf("VerifyFile() without a limit = %v, %v; want true, nil", valid, err)
+	}
+}
+
+// TestAcceptKeys ensures comments with an old key verify, and are migrated by ProcessFile
+func TestAcceptKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   CommentStyle
+		content string
+		newLine string // Start of the comment written with the new key
+	}{
+		{"go", GoStyle, "package main\n", "// NewKey: "},
+		{"templ", TemplStyle, "package views\n", `const NewKey = "`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			oldConfig := Config{CommentStyle: tt.style, BufferSize: 64 * 1024, Key: "OldKey"}
+			if err := NewWriter(oldConfig).ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() with old key failed: %v", err)
+			}
+
+			config := Config{CommentStyle: tt.style, BufferSize: 64 * 1024, Key: "NewKey"}
+			if _, err := NewReader(config).VerifyFile(path); !errors.Is(err, ErrNoComment) {
+				t.Errorf("VerifyFile() without AcceptKeys error = %v, want ErrNoComment", err)
+			}
+
+			config.AcceptKeys = []string{"OtherKey", "OldKey"}
+			if valid, err := NewReader(config).VerifyFile(path); err != nil || !valid {
+				t.Errorf("VerifyFile() with AcceptKeys = %v, %v; want true, nil", valid, err)
+			}
+
+			// Writing replaces the old comment with one labelled with the primary key
+			if err := NewWriter(config).ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() with new key failed: %v", err)
+			}
+			content, _ := os.ReadFile(path)
+			if !strings.HasPrefix(string(content), tt.content+tt.newLine) || strings.Contains(string(content), "OldKey") {
+				t.Errorf("Old comment was not migrated: %q", content)
+			}
+			config.AcceptKeys = nil
+			if valid, err := NewReader(config).VerifyFile(path); err != nil || !valid {
+				t.Errorf("VerifyFile() after migration = %v, %v; want true, nil", valid, err)
+			}
+		})
+	}
+}
+
+// TestProcess ensures in-memory processing matches ProcessFile and always writes the content
+func TestProcess(t *testing.T) {
+	content := "package main\n\nfunc main() {}\n"
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ProcessGoFile(path); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(path)
+
+	writer := NewWriter(DefaultConfig())
+	var out bytes.Buffer
+	result, err := writer.Process(strings.NewReader(content), &out)
+	if err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+	if !result.Changed || out.String() != string(want) {
+		t.Errorf("Process() = %+v, %q; want changed, %q", result, out.String(), want)
+	}
+
+	out.Reset()
+	result, err = writer.Process(bytes.NewReader(want), &out)
+	if err != nil {
+		t.Fatalf("Process() on stamped content failed: %v", err)
+	}
+	if result.Changed || out.String() != string(want) {
+		t.Errorf("Process() on stamped content = %+v, %q; want unchanged, %q", result, out.String(), want)
+	}
+}
+
+// TestLowercaseDigest ensures the digest case is configurable, idempotent, and verified either way
+func TestLowercaseDigest(t *testing.T) {
+	content := "package main\n"
+	crc := crc32.ChecksumIEEE([]byte("package main"))
+	tests := []struct {
+		name      string
+		lowercase bool
+		want      string
+	}{
+		{"uppercase", false, fmt.Sprintf("// FileIntegrity: %08X\n", crc)},
+		{"lowercase", true, fmt.Sprintf("// FileIntegrity: %08x\n", crc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := DefaultConfig()
+			config.LowercaseDigest = tt.lowercase
+			writer := NewWriter(config)
+			if err := writer.ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			first, _ := os.ReadFile(path)
+			if string(first) != content+tt.want {
+				t.Fatalf("Content = %q, want %q", first, content+tt.want)
+			}
+
+			// Re-running with the same setting leaves the file byte-identical
+			if result, err := writer.Inspect(path); err != nil || result.Changed {
+				t.Errorf("Inspect() = %+v, %v; want unchanged", result, err)
+			}
+
+			// Either case verifies, whatever the setting
+			for _, lowercase := range []bool{false, true} {
+				config.LowercaseDigest = lowercase
+				if valid, err := NewReader(config).VerifyFile(path); err != nil || !valid {
+					t.Errorf("VerifyFile(LowercaseDigest=%v) = %v, %v; want true, nil", lowercase, valid, err)
+				}
+			}
+
+			// The other setting rewrites the comment in its case
+			config.LowercaseDigest = !tt.lowercase
+			if result, err := NewWriter(config).Inspect(path); err != nil || !result.Changed {
+				t.Errorf("Inspect() with the other case = %+v, %v; want changed", result, err)
+			}
+		})
+	}
+}
+
+// TestTempFileName ensures files named like a rewrite's temporary file are refused untouched
+func TestTempFileName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".hashfile_foo.tmp")
+	content := "package main\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := NewWriter(DefaultConfig())
+	if err := writer.ProcessFile(path); !errors.Is(err, ErrTempFileName) {
+		t.Errorf("ProcessFile() error = %v, want ErrTempFileName", err)
+	}
+	if _, err := writer.RemoveComment(path); !errors.Is(err, ErrTempFileName) {
+		t.Errorf("RemoveComment() error = %v, want ErrTempFileName", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != content {
+		t.Errorf("File after refusal = %q, %v; want it unchanged", got, err)
+	}
+
+	// Similar names are processed normally
+	for _, name := range []string{"hashfile_foo.tmp", ".hashfile_foo.go"} {
+		other := filepath.Join(dir, name)
+		if err := os.WriteFile(other, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.ProcessFile(other); err != nil {
+			t.Errorf("ProcessFile(%q) failed: %v", name, err)
+		}
+	}
+}
+
+// TestTempPrefix ensures a custom prefix names temporary files and decides which are refused
+func TestTempPrefix(t *testing.T) {
+	dir := t.TempDir()
+	tempDir := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tempDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "package main\n"
+	config := DefaultConfig()
+	config.TempPrefix = "~build-"
+	config.TempDir = tempDir
+
+	// The rewrite writes to the temporary file, named with the prefix
+	var seen []string
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rewrite := func(src io.Reader, dst io.Writer) (bool, error) {
+		seen = append(seen, dst.(*os.File).Name())
+		_, err := io.Copy(dst, src)
+		return false, err
+	}
+	if err := config.rewriteFile(path, nil, rewrite); err != nil {
+		t.Fatalf("rewriteFile() failed: %v", err)
+	}
+	if len(seen) != 1 || !strings.HasPrefix(filepath.Base(seen[0]), "~build-") || !strings.HasSuffix(seen[0], ".tmp") {
+		t.Errorf("temporary file = %q, want ~build-*.tmp", seen)
+	}
+
+	// Names are refused by the configured prefix only
+	writer := NewWriter(config)
+	refused := filepath.Join(dir, "~build-123.tmp")
+	if err := os.WriteFile(refused, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.ProcessFile(refused); !errors.Is(err, ErrTempFileName) {
+		t.Errorf("ProcessFile() error = %v, want ErrTempFileName", err)
+	}
+	other := filepath.Join(dir, ".hashfile_123.tmp")
+	if err := os.WriteFile(other, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.ProcessFile(other); err != nil {
+		t.Errorf("ProcessFile(%q) failed: %v", other, err)
+	}
+
+	config.TempPrefix = "sub/tmp-"
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() accepted a TempPrefix with a path separator")
+	}
+}
+
+// TestFormatVersion ensures versioned and legacy comments both verify, and switching rewrites
+func TestFormatVersion(t *testing.T) {
+	content := "package main\n"
+	crc := crc32.ChecksumIEEE([]byte("package main"))
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := DefaultConfig()
+	versioned := DefaultConfig()
+	versioned.FormatVersion = 1
+	if err := versioned.Validate(); err != nil {
+		t.Fatalf("Validate() = %v for FormatVersion 1", err)
+	}
+
+	for _, config := range []Config{versioned, legacy} {
+		writer := NewWriter(config)
+		if err := writer.ProcessFile(path); err != nil {
+			t.Fatalf("ProcessFile() failed: %v", err)
+		}
+		got, _ := os.ReadFile(path)
+		want := content + writer.FormatComment(crc)
+		if string(got) != want {
+			t.Errorf("FormatVersion %d: content = %q, want %q", config.FormatVersion, got, want)
+		}
+		if result, err := writer.Inspect(path); err != nil || result.Changed {
+			t.Errorf("FormatVersion %d: Inspect() = %+v, %v; want unchanged", config.FormatVersion, result, err)
+		}
+
+		// Readers accept either format
+		for _, reader := range []Config{legacy, versioned} {
+			if valid, err := NewReader(reader).VerifyFile(path); err != nil || !valid {
+				t.Errorf("FormatVersion %d file: VerifyFile() = %v, %v; want true, nil", config.FormatVersion, valid, err)
+			}
+		}
+	}
+	if want := fmt.Sprintf("// FileIntegrity: v1:%08X\n", crc); NewWriter(versioned).FormatComment(crc) != want {
+		t.Errorf("FormatComment() = %q, want %q", NewWriter(versioned).FormatComment(crc), want)
+	}
+
+	versioned.FormatVersion = 2
+	if err := versioned.Validate(); err == nil {
+		t.Error("Validate() accepted FormatVersion 2")
+	}
+}
+
+// TestUnsupportedVersion ensures a comment with an unknown format version is reported as such,
+// not as a missing comment, and is not replaced by add
+func TestUnsupportedVersion(t *testing.T) {
+	content := "package main\n// FileIntegrity: v2:ABCD1234\n"
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, strict := range []bool{false, true} {
+		config := DefaultConfig()
+		config.StrictFormat = strict
+		_, err := NewReader(config).VerifyFile(path)
+		if !errors.Is(err, ErrUnsupportedVersion) || errors.Is(err, ErrNoComment) {
+			t.Errorf("StrictFormat=%v: VerifyFile() error = %v, want ErrUnsupportedVersion", strict, err)
+		}
+		if reason := ReasonFor(false, err); reason != ReasonBadFormat {
+			t.Errorf("ReasonFor(%v) = %s, want %s", err, reason, ReasonBadFormat)
+		}
+	}
+
+	if err := ProcessGoFile(path); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("ProcessFile() error = %v, want ErrUnsupportedVersion", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("ProcessFile() changed the file to %q", got)
+	}
+}
+
+// TestDigestReader ensures in-memory content digests like the same content in a file
+func TestDigestReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"unstamped", "package main\n"},
+		{"stamped", "package main\n// FileIntegrity: DEADBEEF\n"},
+		{"no trailing newline", "package main"},
+	}
+
+	reader := NewReader(DefaultConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.go")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			want, err := reader.Digest(path)
+			if err != nil {
+				t.Fatalf("Digest() failed: %v", err)
+			}
+			got, err := reader.DigestReader(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("DigestReader() failed: %v", err)
+			}
+			if got != want {
+				t.Errorf("DigestReader() = %08X, want %08X", got, want)
+			}
+		})
+	}
+}
+
+// TestNamespace ensures content stamped under a namespace only verifies under the same namespace
+func TestNamespace(t *testing.T) {
+	content := "package main\n\nfunc main() {}\n"
+	tests := []struct {
+		name   string
+		config func(*Config)
+	}{
+		{"plain", nil},
+		{"parallel", func(c *Config) { c.ParallelHash = true }},
+		{"normalize go", func(c *Config) { c.NormalizeGo = true }},
+		{"hash limit", func(c *Config) { c.MaxHashBytes = 4 }},
+		{"ignore lines", func(c *Config) { c.IgnoreLines = regexp.MustCompile(`^func`) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			withNamespace := func(namespace string) Config {
+				c := config
+				c.Namespace = namespace
+				return c
+			}
+
+			path := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			result, err := NewWriter(withNamespace("project-a")).Process(strings.NewReader(content), io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain, err := NewWriter(config).Process(strings.NewReader(content), io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.HashedBytes != plain.HashedBytes {
+				t.Errorf("HashedBytes = %d, want %d: the namespace is not content", result.HashedBytes, plain.HashedBytes)
+			}
+
+			if err := NewWriter(withNamespace("project-a")).ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			for _, namespace := range []string{"project-a", "project-b", ""} {
+				valid, err := NewReader(withNamespace(namespace)).VerifyFile(path)
+				if err != nil {
+					t.Fatalf("VerifyFile() failed: %v", err)
+				}
+				if want := namespace == "project-a"; valid != want {
+					t.Errorf("VerifyFile() under namespace %q = %v, want %v", namespace, valid, want)
+				}
+			}
+		})
+	}
+
+	// The namespace is hashed immediately before the content
+	namespaced := DefaultConfig()
+	namespaced.Namespace = "ns:"
+	reader := NewReader(namespaced)
+	crc, err := reader.DigestReader(strings.NewReader("package main\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crc32.ChecksumIEEE([]byte("ns:package main")); crc != want {
+		t.Errorf("Digest = %08X, want %08X", crc, want)
+	}
+}
+
+// TestHasComment ensures the presence check agrees with full verification on whether a comment exists
+func TestHasComment(t *testing.T) {
+	large := strings.Repeat("// filler line\n", 10000)
+	tests := []struct {
+		name    string
+		content string
+		config  func(*Config)
+		want    bool
+	}{
+		{"empty", "", nil, false},
+		{"no comment", "package main\n", nil, false},
+		{"correct", "package main\n// FileIntegrity: 7FE7DFB2\n", nil, true},
+		{"stale", "package main\n// FileIntegrity: DEADBEEF\n", nil, true},
+		{"comment only", "// FileIntegrity: 00000000", nil, true},
+		{"large", large + "// FileIntegrity: DEADBEEF first=1048576\r\n", nil, true},
+		{"not last line", "package main\n// FileIntegrity: DEADBEEF\nfunc main() {}\n", nil, false},
+		{"long line ending like a comment", strings.Repeat("x", 500) + " // FileIntegrity: DEADBEEF\n", nil, false},
+		{"malformed", "package main\n// FileIntegrity: XYZ\n", nil, false},
+		{"modeline", "package main\n// FileIntegrity: DEADBEEF\n// vim: set ts=4:\n", func(c *Config) { c.PreserveModeline = true }, true},
+		{"script", "#!/bin/sh\n# FileIntegrity: DEADBEEF\necho hi\n", func(c *Config) { c.CommentStyle = ShellStyle; c.ScriptMode = true }, true},
+		{"script without comment", "#!/bin/sh\necho hi\n", func(c *Config) { c.CommentStyle = ShellStyle; c.ScriptMode = true }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			path := filepath.Join(t.TempDir(), "test.go")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader := NewReader(config)
+			got, err := reader.HasComment(path)
+			if err != nil {
+				t.Fatalf("HasComment() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("HasComment() = %v, want %v", got, tt.want)
+			}
+			// Data after a comment means the file does not end with one
+			_, err = reader.VerifyDetailed(path)
+			if found := !errors.Is(err, ErrNoComment) && !errors.Is(err, ErrTrailingData); found != tt.want {
+				t.Errorf("VerifyDetailed() error = %v, disagrees with want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewReader(DefaultConfig()).HasComment(filepath.Join(t.TempDir(), "missing.go")); err == nil {
+		t.Error("HasComment() succeeded on a missing file")
+	}
+}
+
+// TestReadOnly ensures files on a read-only tree verify, and that ReadOnly turns any write
+// into ErrReadOnly without creating temporary files. The permissions do not stop root, so
+// the directory listing and contents are checked as well.
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	stamped := filepath.Join(dir, "stamped.go")
+	plain := filepath.Join(dir, "plain.go")
+	for _, name := range []string{stamped, plain} {
+		if err := os.WriteFile(name, []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewWriter(DefaultConfig()).ProcessFile(stamped); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{stamped, plain} {
+		if err := os.Chmod(name, 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+	stampedContent, err := os.ReadFile(stamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if valid, err := NewReader(DefaultConfig()).VerifyFile(stamped); err != nil || !valid {
+		t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+	}
+
+	config := DefaultConfig()
+	config.ReadOnly = true
+	writer := NewWriter(config)
+	if err := writer.ProcessFile(stamped); err != nil {
+		t.Errorf("ProcessFile() of a stamped file = %v, want nil", err)
+	}
+	if err := writer.ProcessFile(plain); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ProcessFile() = %v, want ErrReadOnly", err)
+	}
+	if _, err := writer.RemoveComment(stamped); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("RemoveComment() = %v, want ErrReadOnly", err)
+	}
+	config.InPlace = true
+	if err := NewWriter(config).ProcessFile(plain); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ProcessFile() with InPlace = %v, want ErrReadOnly", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("directory has %d entries, want 2", len(entries))
+	}
+	if content, err := os.ReadFile(plain); err != nil || string(content) != "package main\n" {
+		t.Errorf("plain.go modified: %q, %v", content, err)
+	}
+	if content, err := os.ReadFile(stamped); err != nil || !bytes.Equal(content, stampedContent) {
+		t.Errorf("stamped.go modified: %q, %v", content, err)
+	}
+}
+
+// TestIncludePermBits ensures a permission change invalidates files stamped with IncludePermBits
+func TestIncludePermBits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*Config)
+	}{
+		{"plain", nil},
+		{"normalize go", func(c *Config) { c.NormalizeGo = true }},
+		{"namespace", func(c *Config) { c.Namespace = "project" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(filename, []byte("package main\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			config.IncludePermBits = true
+			if err := NewWriter(config).ProcessFile(filename); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+
+			reader := NewReader(config)
+			verify := func(mode os.FileMode, want bool) {
+				t.Helper()
+				if err := os.Chmod(filename, mode); err != nil {
+					t.Fatal(err)
+				}
+				if valid, err := reader.VerifyFile(filename); err != nil || valid != want {
+					t.Errorf("VerifyFile() with mode %v = %v, %v; want %v", mode, valid, err, want)
+				}
+			}
+			verify(0644, true)
+			verify(0755, false)
+			verify(0644, true)
+
+			digest, err := reader.Digest(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := reader.VerifyDetailed(filename)
+			if err != nil || result.StoredCRC != digest {
+				t.Errorf("Digest() = %08X, want the stored %08X (err %v)", digest, result.StoredCRC, err)
+			}
+
+			// Without the option, the permission bits are missing from the hash
+			config.IncludePermBits = false
+			if valid, _ := NewReader(config).VerifyFile(filename); valid {
+				t.Error("VerifyFile() without IncludePermBits = true, want false")
+			}
+		})
+	}
+}
+
+// TestCommentPatternCache ensures identical styles and keys share one compiled pattern
+func TestCommentPatternCache(t *testing.T) {
+	a := createCommentPattern(CSSStyle, "CacheKey")
+	if b := createCommentPattern(CSSStyle, "CacheKey"); a != b {
+		t.Error("createCommentPattern() compiled the same pattern twice")
+	}
+	if c := createCommentPattern(CSSStyle, "CacheKey", "Other"); c == a {
+		t.Error("createCommentPattern() shared a pattern between different key sets")
+	}
+	if d := createCommentPattern(HTMLStyle, "CacheKey"); d == a {
+		t.Error("createCommentPattern() shared a pattern between different styles")
+	}
+	if a.String() != compileCommentPattern(CSSStyle, "CacheKey").String() {
+		t.Error("cached pattern differs from a freshly compiled one")
+	}
+}
+
+// TestTrailingWhitespace ensures blanks an editor added after the comment are tolerated on
+// verify and left alone by a no-op add
+func TestTrailingWhitespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   CommentStyle
+		content string
+		blanks  string
+	}{
+		{"space", GoStyle, "package main\n", " "},
+		{"tabs and spaces", GoStyle, "package main\n", "\t  "},
+		{"crlf", GoStyle, "package main\r\n", " "},
+		{"suffix", HTMLStyle, "<p>hi</p>\n", " "},
+		{"no final newline", PythonStyle, "pass\n", " "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := DefaultConfig()
+			config.CommentStyle = tt.style
+			if err := NewWriter(config).ProcessFile(filename); err != nil {
+				t.Fatal(err)
+			}
+			stamped, _ := os.ReadFile(filename)
+			if bytes.Contains(stamped, []byte(" \n")) {
+				t.Fatalf("ProcessFile() wrote trailing whitespace: %q", stamped)
+			}
+
+			// Insert the blanks before the final line ending, or at the very end
+			body := bytes.TrimRight(stamped, "\r\n")
+			edited := append(append(bytes.Clone(body), tt.blanks...), stamped[len(body):]...)
+			if tt.name == "no final newline" {
+				edited = append(bytes.Clone(body), tt.blanks...)
+			}
+			if err := os.WriteFile(filename, edited, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if valid, err := NewReader(config).VerifyFile(filename); err != nil || !valid {
+				t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+			}
+			result, err := NewWriter(config).Inspect(filename)
+			if err != nil || result.Changed {
+				t.Errorf("Inspect() = %+v, %v; want no change", result, err)
+			}
+		})
+	}
+}
+
+// TestSlideWindow ensures the shared loop passes on every byte but a final window of at least
+// windowSize bytes, whatever the read sizes
+func TestSlideWindow(t *testing.T) {
+	const windowSize = 16
+	readers := map[string]func(io.Reader) io.Reader{
+		"full":     func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+		"data err": iotest.DataErrReader,
+	}
+	for name, wrap := range readers {
+		for _, size := range []int{0, 1, windowSize, windowSize + 1, 63, 64, 65, 1000} {
+			t.Run(fmt.Sprintf("%s/%d", name, size), func(t *testing.T) {
+				content := make([]byte, size)
+				for i := range content {
+					content[i] = byte(i)
+				}
+				var emitted []byte
+				window, total, err := slideWindow(wrap(bytes.NewReader(content)), make([]byte, 64), windowSize, func(p []byte) error {
+					emitted = append(emitted, p...)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("slideWindow() failed: %v", err)
+				}
+				if !bytes.Equal(append(emitted, window...), content) || total != int64(size) {
+					t.Errorf("emitted %d + window %d bytes, total %d; want %d", len(emitted), len(window), total, size)
+				}
+				if len(window) < min(windowSize, size) {
+					t.Errorf("window holds %d bytes, want at least %d", len(window), min(windowSize, size))
+				}
+			})
+		}
+	}
+}
+
+// TestWriterReaderAgree ensures the Writer and Reader hash content identically, whatever the
+// read sizes on either side
+func TestWriterReaderAgree(t *testing.T) {
+	config := DefaultConfig()
+	config.BufferSize = config.windowSize() + 7
+	readers := []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		iotest.OneByteReader,
+		iotest.HalfReader,
+	}
+	for _, content := range []string{"", "x", "package main\n", strings.Repeat("line of content\n", 50)} {
+		for wi, writeWrap := range readers {
+			var stamped bytes.Buffer
+			if _, err := NewWriter(config).Process(writeWrap(strings.NewReader(content)), &stamped); err != nil {
+				t.Fatalf("Process() failed: %v", err)
+			}
+			want, err := NewReader(config).DigestReader(strings.NewReader(stamped.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ri, readWrap := range readers {
+				result, err := NewReader(config).verifyDetailed(readWrap(bytes.NewReader(stamped.Bytes())), nil, false)
+				if err != nil || !result.Valid || result.StoredCRC != want {
+					t.Errorf("content %d bytes, writer %d, reader %d: VerifyDetailed() = %+v, %v; want valid %08X",
+						len(content), wi, ri, result, err, want)
+				}
+			}
+		}
+	}
+}
+
+// FileIntegrity: 5C8172A6
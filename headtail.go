@@ -0,0 +1,49 @@
+package hashfile
+
+import "hash"
+
+// headTailHash passes the first n bytes written to next and holds back the last n of the
+// rest, which are passed on when the sum is taken, so that only both ends of the content are
+// hashed. Content up to 2n bytes is hashed whole. Nothing may be written after the sum.
+type headTailHash struct {
+	n       int64
+	head    int64  // Bytes passed on from the start
+	tail    []byte // The latest bytes after the head; only the last n count
+	flushed bool
+	next    hash.Hash32
+}
+
+func (h *headTailHash) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := h.n - h.head; remaining > 0 {
+		head := p[:min(int64(len(p)), remaining)]
+		h.head += int64(len(head))
+		h.next.Write(head)
+		p = p[len(head):]
+	}
+	h.tail = append(h.tail, p...)
+	// Drop what can no longer be among the last n bytes, at most once per n bytes written
+	if int64(len(h.tail)) > 2*h.n {
+		h.tail = append(h.tail[:0], h.tail[int64(len(h.tail))-h.n:]...)
+	}
+	return n, nil
+}
+
+// flush passes the held-back tail on to next, once.
+func (h *headTailHash) flush() {
+	if !h.flushed {
+		h.next.Write(h.tail[max(0, int64(len(h.tail))-h.n):])
+		h.flushed = true
+	}
+}
+
+func (h *headTailHash) Reset() {
+	h.head, h.tail, h.flushed = 0, h.tail[:0], false
+	h.next.Reset()
+}
+func (h *headTailHash) Size() int           { return h.next.Size() }
+func (h *headTailHash) BlockSize() int      { return 1 }
+func (h *headTailHash) Sum(b []byte) []byte { h.flush(); return h.next.Sum(b) }
+func (h *headTailHash) Sum32() uint32       { h.flush(); return h.next.Sum32() }
+
+// FileIntegrity: 8A6894C9
@@ -0,0 +1,104 @@
+package hashfile
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHeadTailBytes ensures only both ends of the content are covered and the number is recorded
+func TestHeadTailBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.go")
+	var lines strings.Builder
+	for i := range 1000 {
+		fmt.Fprintf(&lines, "// line %04d\n", i)
+	}
+	body := "package main\n" + lines.String() + "// end"
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.HeadTailBytes = 100
+	config.BufferSize = 512 // Smaller than the content, so the tail is gathered across reads
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCRC := crc32.ChecksumIEEE([]byte(body[:100] + body[len(body)-100:]))
+	if want := fmt.Sprintf("// FileIntegrity: %08X ends=100\n", wantCRC); !strings.HasSuffix(string(content), want) {
+		t.Fatalf("Content ends with %q, want %q", content[len(content)-40:], want)
+	}
+	result, err := NewReader(config).VerifyDetailed(path)
+	if err != nil || !result.Valid {
+		t.Fatalf("VerifyDetailed() = %+v, %v; want valid", result, err)
+	}
+	if result.ContentLen != 200 {
+		t.Errorf("ContentLen = %d, want 200", result.ContentLen)
+	}
+
+	// Verification uses the recorded number whatever the configuration says
+	for _, limits := range [][2]int{{0, 0}, {50, 0}, {0, 10}} {
+		other := DefaultConfig()
+		other.MaxHashBytes, other.HeadTailBytes = limits[0], limits[1]
+		if valid, err := NewReader(other).VerifyFile(path); err != nil || !valid {
+			t.Errorf("MaxHashBytes=%d, HeadTailBytes=%d: VerifyFile() = %v, %v; want true, nil",
+				other.MaxHashBytes, other.HeadTailBytes, valid, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		edit     func(string) string
+		detected bool
+	}{
+		{"middle", func(s string) string { return strings.Replace(s, "line 0500", "LINE 0500", 1) }, false},
+		{"head", func(s string) string { return strings.Replace(s, "package main", "package mine", 1) }, true},
+		{"tail", func(s string) string { return strings.Replace(s, "// end\n", "// END\n", 1) }, true},
+		{"truncated", func(s string) string { i := strings.Index(s, "// line 0990"); return s[:i] + s[len(body)+1:] }, true},
+		{"appended", func(s string) string { return strings.Replace(s, "// end\n", "// end\n// more\n", 1) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.edit(string(content))), 0644); err != nil {
+				t.Fatal(err)
+			}
+			valid, err := NewReader(config).VerifyFile(path)
+			if err != nil {
+				t.Fatalf("VerifyFile() failed: %v", err)
+			}
+			if valid == tt.detected {
+				t.Errorf("VerifyFile() = %v, want %v", valid, !tt.detected)
+			}
+		})
+	}
+}
+
+// TestHeadTailBytesShort ensures content up to twice HeadTailBytes is hashed whole
+func TestHeadTailBytesShort(t *testing.T) {
+	for _, body := range []string{"", "x", "package main", strings.Repeat("a", 200)} {
+		config := DefaultConfig()
+		config.HeadTailBytes = 100
+		crc, err := NewReader(config).DigestReader(strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := crc32.ChecksumIEEE([]byte(body)); crc != want {
+			t.Errorf("DigestReader(%d bytes) = %08X, want %08X", len(body), crc, want)
+		}
+	}
+
+	config := DefaultConfig()
+	config.HeadTailBytes, config.MaxHashBytes = 100, 100
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() accepted both MaxHashBytes and HeadTailBytes")
+	}
+}
+
+// FileIntegrity: 908A67C6
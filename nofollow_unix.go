@@ -0,0 +1,15 @@
+//go:build unix
+
+package hashfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// openNoFollow opens a file for reading, failing if its final path element is a symbolic link.
+func openNoFollow(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+}
+
+// FileIntegrity: C1548140
@@ -0,0 +1,78 @@
+//go:build unix
+
+package hashfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestNoFollowSymlink ensures a symbolic link is refused rather than followed
+func TestNoFollowSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.go")
+	if err := os.WriteFile(target, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.go")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.NoFollow = true
+	config.InPlace = true
+	if err := NewWriter(config).ProcessFile(link); err == nil {
+		t.Fatal("ProcessFile() followed a symbolic link")
+	}
+	if content, _ := os.ReadFile(target); string(content) != "package main\n" {
+		t.Errorf("target modified: %q", content)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("symbolic link replaced")
+	}
+
+	// A regular file is processed as usual
+	if err := NewWriter(config).ProcessFile(target); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	if valid, err := NewReader(config).VerifyFile(target); err != nil || !valid {
+		t.Errorf("VerifyFile() = %v, %v; want true", valid, err)
+	}
+}
+
+// TestNoFollowSwapped ensures a file replaced during the rewrite is not overwritten
+func TestNoFollowSwapped(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	swapped := filepath.Join(dir, "swapped.go")
+	if err := os.WriteFile(swapped, []byte("package other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{NoFollow: true}
+	err := config.rewriteFile(path, nil, func(src io.Reader, dst io.Writer) (bool, error) {
+		if err := os.Rename(swapped, path); err != nil {
+			return false, err
+		}
+		_, err := io.Copy(dst, src)
+		return false, err
+	})
+	if !errors.Is(err, ErrFileSwapped) {
+		t.Fatalf("rewriteFile() error = %v, want ErrFileSwapped", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "package other\n" {
+		t.Errorf("swapped file overwritten: %q", content)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, DefaultTempPrefix+"*"+tempSuffix)); len(matches) > 0 {
+		t.Errorf("temp files left behind: %v", matches)
+	}
+}
+
+// FileIntegrity: ABDE997F
@@ -0,0 +1,72 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrSameFile indicates that ProcessFileTo was asked to write a file's stamped copy over
+// the file itself.
+var ErrSameFile = errors.New("destination is the source file")
+
+// ProcessFileTo writes the content of filename, with its integrity comment added or updated,
+// to dest, leaving filename untouched, e.g. to produce stamped copies in a build directory.
+// Missing parent directories of dest are created, and an existing dest is replaced
+// atomically through a temporary file in its directory. dest gets the permissions of
+// filename and is written even when the comment is already correct. It reports whether the
+// copy differs from the original.
+func (w *Writer) ProcessFileTo(filename, dest string) (bool, error) {
+	if w.config.isTempName(filename) {
+		return false, fmt.Errorf("%w: %s", ErrTempFileName, filename)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat source file: %w", err)
+	}
+	if destInfo, err := os.Stat(dest); err == nil && os.SameFile(info, destInfo) {
+		return false, fmt.Errorf("%w: %s", ErrSameFile, dest)
+	}
+	if err := w.config.checkSize(info.Size()); err != nil {
+		return false, err
+	}
+	if w.config.ReadOnly {
+		return false, fmt.Errorf("%w: %s", ErrReadOnly, dest)
+	}
+	w = w.forFile(info)
+
+	src, err := os.Open(filename)
+	if err != nil {
+		return false, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	dst, err := createTemp(filepath.Dir(dest), w.config.tempPrefix(), info.Mode().Perm())
+	if err != nil {
+		return false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := dst.Name()
+	defer os.Remove(tmpName) // Fails harmlessly once renamed
+
+	result, err := w.processStream(src, dst)
+	if err != nil {
+		dst.Close()
+		return false, fmt.Errorf("failed to process stream: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	if err := os.Chmod(tmpName, info.Mode()); err != nil {
+		return false, fmt.Errorf("failed to preserve permissions: %w", err)
+	}
+	if err := os.Rename(tmpName, dest); err != nil {
+		return false, fmt.Errorf("failed to write destination file: %w", err)
+	}
+	return result.Changed, nil
+}
+
+// FileIntegrity: 6762D655
@@ -0,0 +1,93 @@
+package hashfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestProcessFileTo ensures stamped copies verify while the originals stay untouched
+func TestProcessFileTo(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name        string
+		content     string
+		wantChanged bool
+	}{
+		{"unstamped", "package main\n", true},
+		{"stamped", "package main\n// FileIntegrity: 7FE7DFB2\n", false},
+		{"stale", "package main\n// FileIntegrity: DEADBEEF\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(dir, tt.name+".go")
+			if err := os.WriteFile(src, []byte(tt.content), 0640); err != nil {
+				t.Fatal(err)
+			}
+			dest := filepath.Join(dir, "dist", "nested", tt.name+".go")
+
+			changed, err := NewWriter(DefaultConfig()).ProcessFileTo(src, dest)
+			if err != nil {
+				t.Fatalf("ProcessFileTo() failed: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("ProcessFileTo() = %v, want %v", changed, tt.wantChanged)
+			}
+
+			if got, err := os.ReadFile(src); err != nil || string(got) != tt.content {
+				t.Errorf("source changed to %q, %v", got, err)
+			}
+			if valid, err := NewReader(DefaultConfig()).VerifyFile(dest); err != nil || !valid {
+				t.Errorf("VerifyFile(dest) = %v, %v; want true", valid, err)
+			}
+			info, err := os.Stat(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0640 {
+				t.Errorf("dest mode = %v, want 0640", info.Mode().Perm())
+			}
+
+			// Writing again replaces the copy
+			if _, err := NewWriter(DefaultConfig()).ProcessFileTo(src, dest); err != nil {
+				t.Fatalf("second ProcessFileTo() failed: %v", err)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "dist", "nested"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(tests) {
+		t.Errorf("dist holds %d entries, want %d (temporary files left behind?)", len(entries), len(tests))
+	}
+}
+
+// TestProcessFileToRefusals ensures the source is never overwritten and ReadOnly writes nothing
+func TestProcessFileToRefusals(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "test.go")
+	if err := os.WriteFile(src, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewWriter(DefaultConfig()).ProcessFileTo(src, filepath.Join(dir, ".", "test.go"))
+	if !errors.Is(err, ErrSameFile) {
+		t.Errorf("ProcessFileTo(src, src) error = %v, want ErrSameFile", err)
+	}
+
+	config := DefaultConfig()
+	config.ReadOnly = true
+	dest := filepath.Join(dir, "out", "test.go")
+	if _, err := NewWriter(config).ProcessFileTo(src, dest); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ProcessFileTo() with ReadOnly error = %v, want ErrReadOnly", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out")); !os.IsNotExist(err) {
+		t.Errorf("ReadOnly created the destination directory: %v", err)
+	}
+}
+
+// FileIntegrity: 35F354B9
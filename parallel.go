@@ -0,0 +1,174 @@
+package hashfile
+
+import (
+	"hash/crc32"
+	"runtime"
+)
+
+// parallelSegmentSize is the amount of content hashed by each goroutine in ParallelHash mode.
+// Content smaller than one segment is hashed sequentially.
+const parallelSegmentSize = 1 << 20 // 1MB
+
+// parallelHash computes a CRC32 by hashing fixed-size segments on separate goroutines and
+// combining the results in order. At most GOMAXPROCS segments are hashed at once, which
+// bounds the memory held in flight.
+type parallelHash struct {
+	pending  []byte        // Segment being filled
+	segments []*segment    // Dispatched segments, in content order
+	sem      chan struct{} // Limits concurrently hashed segments
+	pool     chan []byte   // Recycled segment buffers
+}
+
+// segment is the CRC of one slice of content, available once done is closed.
+type segment struct {
+	crc  uint32
+	size int64
+	done chan struct{}
+}
+
+func newParallelHash() *parallelHash {
+	workers := runtime.GOMAXPROCS(0)
+	return &parallelHash{
+		sem:  make(chan struct{}, workers),
+		pool: make(chan []byte, workers),
+	}
+}
+
+func (h *parallelHash) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if h.pending == nil {
+			h.pending = h.buffer()
+		}
+		take := min(len(p), parallelSegmentSize-len(h.pending))
+		h.pending = append(h.pending, p[:take]...)
+		p = p[take:]
+
+		if len(h.pending) == parallelSegmentSize {
+			h.dispatch(h.pending)
+			h.pending = nil
+		}
+	}
+	return n, nil
+}
+
+// buffer returns an empty segment buffer, reusing one from a finished segment if possible.
+func (h *parallelHash) buffer() []byte {
+	select {
+	case buf := <-h.pool:
+		return buf[:0]
+	default:
+		return make([]byte, 0, parallelSegmentSize)
+	}
+}
+
+// dispatch hashes buf on a new goroutine, waiting for a free worker slot first.
+func (h *parallelHash) dispatch(buf []byte) {
+	seg := &segment{size: int64(len(buf)), done: make(chan struct{})}
+	h.segments = append(h.segments, seg)
+
+	h.sem <- struct{}{}
+	go func() {
+		seg.crc = crc32.ChecksumIEEE(buf)
+		close(seg.done)
+		<-h.sem
+
+		select {
+		case h.pool <- buf:
+		default:
+		}
+	}()
+}
+
+func (h *parallelHash) Reset() {
+	for _, seg := range h.segments {
+		<-seg.done
+	}
+	h.segments = nil
+	h.pending = nil
+}
+
+func (h *parallelHash) Size() int      { return crc32.Size }
+func (h *parallelHash) BlockSize() int { return 1 }
+
+func (h *parallelHash) Sum(b []byte) []byte {
+	s := h.Sum32()
+	return append(b, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+// Sum32 waits for all segments and combines their CRCs. The final partial segment is
+// hashed on the calling goroutine, so small inputs never start a goroutine.
+func (h *parallelHash) Sum32() uint32 {
+	var crc uint32
+	for _, seg := range h.segments {
+		<-seg.done
+		crc = crc32Combine(crc, seg.crc, seg.size)
+	}
+	return crc32Combine(crc, crc32.ChecksumIEEE(h.pending), int64(len(h.pending)))
+}
+
+// crc32Combine returns the IEEE CRC32 of the concatenation of two inputs, given the CRC of
+// each and the length of the second. It applies len2 zero bytes to crc1 using repeated
+// squaring of the GF(2) operator matrix, as in zlib's crc32_combine.
+func crc32Combine(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+
+	var even, odd [32]uint32
+
+	// Operator for one zero bit
+	odd[0] = crc32.IEEE
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+
+	gf2MatrixSquare(&even, &odd) // Two zero bits
+	gf2MatrixSquare(&odd, &even) // Four zero bits
+
+	// Apply len2 zero bytes, starting with one byte (eight zero bits)
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+
+	return crc1 ^ crc2
+}
+
+// gf2MatrixTimes multiplies a GF(2) matrix by a vector.
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i++ {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+		vec >>= 1
+	}
+	return sum
+}
+
+// gf2MatrixSquare sets square to mat multiplied by itself.
+func gf2MatrixSquare(square, mat *[32]uint32) {
+	for n := 0; n < 32; n++ {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
+
+// FileIntegrity: 6A0C0497
@@ -0,0 +1,104 @@
+package hashfile
+
+import (
+	"bytes"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// TestCRC32Combine ensures combined CRCs match the CRC of the concatenation
+func TestCRC32Combine(t *testing.T) {
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, split := range []int{0, 1, 7, 4096, 9999, 10000} {
+		a, b := data[:split], data[split:]
+		got := crc32Combine(crc32.ChecksumIEEE(a), crc32.ChecksumIEEE(b), int64(len(b)))
+		if want := crc32.ChecksumIEEE(data); got != want {
+			t.Errorf("split at %d: crc32Combine() = %08X, want %08X", split, got, want)
+		}
+	}
+}
+
+// TestParallelHash ensures parallel hashing matches sequential hashing for any write pattern
+func TestParallelHash(t *testing.T) {
+	data := make([]byte, 3*parallelSegmentSize+12345)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	for _, size := range []int{0, 100, parallelSegmentSize, len(data)} {
+		for _, chunk := range []int{1000, 64 * 1024, parallelSegmentSize + 1} {
+			h := newParallelHash()
+			for p := data[:size]; len(p) > 0; {
+				n := min(chunk, len(p))
+				h.Write(p[:n])
+				p = p[n:]
+			}
+			if got, want := h.Sum32(), crc32.ChecksumIEEE(data[:size]); got != want {
+				t.Errorf("size %d, chunk %d: Sum32() = %08X, want %08X", size, chunk, got, want)
+			}
+		}
+	}
+}
+
+// TestParallelHashFile ensures files stamped in parallel mode verify sequentially
+func TestParallelHashFile(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "test_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	content := bytes.Repeat([]byte("// This is a comment line\n"), 3*parallelSegmentSize/26)
+	if _, err := tmpfile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	config := DefaultConfig()
+	config.ParallelHash = true
+	if err := NewWriter(config).ProcessFile(tmpfile.Name()); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+
+	valid, err := NewReader(DefaultConfig()).VerifyFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("VerifyFile() failed: %v", err)
+	}
+	if !valid {
+		t.Error("Parallel hash does not match sequential hash")
+	}
+}
+
+// BenchmarkSequentialHash benchmarks hashing 64MB sequentially
+func BenchmarkSequentialHash(b *testing.B) {
+	benchmarkHash(b, DefaultConfig())
+}
+
+// BenchmarkParallelHash benchmarks hashing 64MB in parallel segments
+func BenchmarkParallelHash(b *testing.B) {
+	config := DefaultConfig()
+	config.ParallelHash = true
+	benchmarkHash(b, config)
+}
+
+func benchmarkHash(b *testing.B, config Config) {
+	data := make([]byte, 64<<20)
+	rand.New(rand.NewSource(3)).Read(data)
+	chunk := config.BufferSize
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h := config.newHasher()
+		for p := data; len(p) > 0; {
+			n := min(chunk, len(p))
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		h.Sum32()
+	}
+}
+
+// FileIntegrity: 21C3B52A
@@ -0,0 +1,88 @@
+package hashfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Restyle rewrites the integrity comment of a file stamped with the from configuration in
+// the Writer's style, reporting whether the file changed. The stored CRC and hash limit are
+// kept as they are, so the content is neither re-read for hashing nor re-validated: a file
+// that failed verification before still fails afterwards. A file that already carries a
+// comment in the Writer's style is left untouched, so Restyle is idempotent. Files with
+// neither comment return ErrNoComment.
+func (w *Writer) Restyle(filename string, from Config) (bool, error) {
+	if w.config.isTempName(filename) {
+		return false, fmt.Errorf("%w: %s", ErrTempFileName, filename)
+	}
+	var changed bool
+	err := w.config.rewriteFile(filename, nil, func(src io.Reader, dst io.Writer) (bool, error) {
+		var err error
+		changed, err = w.restyleStream(src, dst, from)
+		return !changed, err
+	})
+	return changed, err
+}
+
+// restyleStream copies src to dst with its integrity comment converted from the from style
+// to the Writer's style. Returns false if nothing had to change.
+func (w *Writer) restyleStream(src io.Reader, dst io.Writer, from Config) (bool, error) {
+	if from.scriptMode() {
+		return false, fmt.Errorf("restyle does not support comments written in ScriptMode")
+	}
+
+	writer := bufio.NewWriter(dst)
+	pattern := createCommentPattern(from.style(), from.keys()...)
+	reader := &Reader{config: from, pattern: pattern}
+	_, window, _, err := reader.scanStream(src, writer)
+	if err != nil {
+		return false, err
+	}
+
+	var modeline []byte
+	if from.PreserveModeline {
+		window, modeline = splitModeline(window)
+	}
+
+	match, _ := findComment(pattern, window)
+	if match == nil {
+		if current, _ := findComment(w.accepted, window); current != nil {
+			return false, nil
+		}
+		return false, ErrNoComment
+	}
+
+	crc, err := storedDigest(window, match)
+	if err != nil {
+		return false, err
+	}
+
+	// Keep the recorded hash limit, which the new comment must carry to verify
+	config := w.config.withRecordedLimit(window, match)
+	old := window[match[0]:match[1]]
+	comment := config.comment(uint32(crc), string(old[len(trimLineEnding(old)):]))
+	if bytes.Equal(comment, old) {
+		return false, nil
+	}
+
+	if _, err := writer.Write(window[:match[0]]); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	if _, err := writer.Write(comment); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	if _, err := writer.Write(window[match[1]:]); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	if _, err := writer.Write(modeline); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return false, fmt.Errorf("write error: %w", err)
+	}
+	return true, nil
+}
+
+// FileIntegrity: 3408C169
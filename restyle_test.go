@@ -0,0 +1,114 @@
+package hashfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRestyle ensures the comment changes style while keeping its stored CRC
+func TestRestyle(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		config  func(*Config)
+	}{
+		{"lf", "package main\n\nfunc main() {}\n", nil},
+		{"crlf", "package main\r\n\r\nfunc main() {}\r\n", nil},
+		{"no trailing newline", "package main", nil},
+		{"hash limit", "package main\n\nfunc main() {}\n", func(c *Config) { c.MaxHashBytes = 8 }},
+		{"blank line", "package main\n", func(c *Config) { c.BlankLineBefore = true }},
+		{"modeline", "package main\n// vim: set ts=4:\n", func(c *Config) { c.PreserveModeline = true }},
+		{"version", "package main\n", func(c *Config) { c.FormatVersion = 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			from := DefaultConfig()
+			to, _ := ConfigForStyleName("cblock")
+			if tt.config != nil {
+				tt.config(&from)
+				tt.config(&to)
+			}
+			if err := NewWriter(from).ProcessFile(filename); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			before, err := NewReader(from).VerifyDetailed(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writer := NewWriter(to)
+			changed, err := writer.Restyle(filename, from)
+			if err != nil || !changed {
+				t.Fatalf("Restyle() = %v, %v; want true, nil", changed, err)
+			}
+
+			content, _ := os.ReadFile(filename)
+			if !strings.Contains(string(content), "/* FileIntegrity: ") || strings.Contains(string(content), "// FileIntegrity: ") {
+				t.Errorf("Comment not restyled:\n%s", content)
+			}
+			after, err := NewReader(to).VerifyDetailed(filename)
+			if err != nil || !after.Valid {
+				t.Fatalf("VerifyDetailed() after Restyle() = %+v, %v", after, err)
+			}
+			if after.StoredCRC != before.StoredCRC {
+				t.Errorf("StoredCRC = %08X, want %08X", after.StoredCRC, before.StoredCRC)
+			}
+
+			// A second run finds the comment already in the new style
+			changed, err = writer.Restyle(filename, from)
+			if err != nil || changed {
+				t.Errorf("second Restyle() = %v, %v; want false, nil", changed, err)
+			}
+			again, _ := os.ReadFile(filename)
+			if string(again) != string(content) {
+				t.Errorf("second Restyle() changed the file:\n%s", again)
+			}
+		})
+	}
+}
+
+// TestRestyleKeepsHash ensures a stale comment is restyled, not re-stamped
+func TestRestyleKeepsHash(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(filename, []byte("package main\n// FileIntegrity: DEADBEEF\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	to, _ := ConfigForStyleName("cblock")
+	if _, err := NewWriter(to).Restyle(filename, DefaultConfig()); err != nil {
+		t.Fatalf("Restyle() failed: %v", err)
+	}
+	content, _ := os.ReadFile(filename)
+	if want := "package main\n/* FileIntegrity: DEADBEEF */\n"; string(content) != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+}
+
+// TestRestyleNoComment ensures files without a comment in either style are reported
+func TestRestyleNoComment(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(filename, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	to, _ := ConfigForStyleName("cblock")
+	changed, err := NewWriter(to).Restyle(filename, DefaultConfig())
+	if !errors.Is(err, ErrNoComment) || changed {
+		t.Errorf("Restyle() = %v, %v; want false, ErrNoComment", changed, err)
+	}
+	content, _ := os.ReadFile(filename)
+	if string(content) != "package main\n" {
+		t.Errorf("file modified: %q", content)
+	}
+}
+
+// FileIntegrity: E63159F5
@@ -0,0 +1,75 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+)
+
+// retryBackoff is the delay before the first retry; it doubles with each further attempt.
+const retryBackoff = 10 * time.Millisecond
+
+// retryable reports whether err is a transient I/O error worth retrying, as network
+// filesystems such as NFS or CIFS occasionally return. Missing files, permission errors,
+// and verification results are final.
+func retryable(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, syscall.EINTR)
+}
+
+// retry runs op, running it again up to retries more times while it fails with a retryable
+// error, with exponential backoff between attempts.
+func retry[T any](retries int, op func() (T, error)) (T, error) {
+	delay := retryBackoff
+	for attempt := 0; ; attempt++ {
+		result, err := op()
+		if err == nil || attempt >= retries || !retryable(err) {
+			return result, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// readStable opens filename and runs read on it, with a Reader for the file. With
+// RetryOnChange set, the file's size and modification time are compared before and after,
+// and read runs again on a fresh descriptor while they differ, up to RetryOnChange more times.
+func readStable[T any](r *Reader, filename string, read func(*Reader, io.Reader) (T, error)) (T, error) {
+	var zero T
+	for attempt := 0; ; attempt++ {
+		file, err := r.open(filename)
+		if err != nil {
+			return zero, err
+		}
+		reader, err := r.forFile(file)
+		if err != nil {
+			file.Close()
+			return zero, err
+		}
+		if r.config.RetryOnChange == 0 {
+			defer file.Close()
+			return read(reader, file)
+		}
+
+		before, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return zero, fmt.Errorf("failed to stat file: %w", err)
+		}
+		result, err := read(reader, file)
+		after, statErr := file.Stat()
+		file.Close()
+		if statErr != nil {
+			return zero, fmt.Errorf("failed to stat file: %w", statErr)
+		}
+		if before.Size() == after.Size() && before.ModTime().Equal(after.ModTime()) {
+			return result, err
+		}
+		if attempt >= r.config.RetryOnChange {
+			return zero, fmt.Errorf("%w: %s", ErrFileChangedDuringRead, filename)
+		}
+	}
+}
+
+// FileIntegrity: 9D8FBEA1
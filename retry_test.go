@@ -0,0 +1,150 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyOp returns an operation that fails with err the first failures times it runs
+func flakyOp(failures int, err error) (op func() (int, error), calls *int) {
+	calls = new(int)
+	return func() (int, error) {
+		*calls++
+		if *calls <= failures {
+			return 0, fmt.Errorf("failed to open source file: %w", &fs.PathError{Op: "open", Path: "x.go", Err: err})
+		}
+		return 42, nil
+	}, calls
+}
+
+// TestRetry ensures only transient errors are retried, and only as often as configured
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", 0, syscall.EAGAIN, 3, 1, false},
+		{"transient", 2, syscall.EAGAIN, 3, 3, false},
+		{"timeout", 1, syscall.ETIMEDOUT, 1, 2, false},
+		{"interrupted", 1, syscall.EINTR, 1, 2, false},
+		{"exhausted", 5, syscall.EAGAIN, 2, 3, true},
+		{"disabled", 1, syscall.EAGAIN, 0, 1, true},
+		{"missing file", 1, syscall.ENOENT, 3, 1, true},
+		{"permission", 1, syscall.EACCES, 3, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, calls := flakyOp(tt.failures, tt.err)
+			got, err := retry(tt.retries, op)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("retry() error = %v, want it to wrap %v", err, tt.err)
+			}
+			if err == nil && got != 42 {
+				t.Errorf("retry() = %d, want 42", got)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+
+	// Verification results are final
+	calls := 0
+	if _, err := retry(3, func() (bool, error) { calls++; return false, ErrNoComment }); !errors.Is(err, ErrNoComment) {
+		t.Errorf("retry() error = %v, want ErrNoComment", err)
+	}
+	if calls != 1 {
+		t.Errorf("ErrNoComment retried: %d calls", calls)
+	}
+}
+
+// TestRetriesFailFast ensures a missing file is reported without any backoff
+func TestRetriesFailFast(t *testing.T) {
+	config := DefaultConfig()
+	config.Retries = 5
+	missing := filepath.Join(t.TempDir(), "missing.go")
+
+	start := time.Now()
+	if err := NewWriter(config).ProcessFile(missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ProcessFile() error = %v, want ErrNotExist", err)
+	}
+	if _, err := NewReader(config).VerifyFile(missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("VerifyFile() error = %v, want ErrNotExist", err)
+	}
+	if elapsed := time.Since(start); elapsed >= retryBackoff {
+		t.Errorf("missing file retried: took %v", elapsed)
+	}
+}
+
+// TestRetryOnChange ensures a file modified while it is read is read again, and reported
+// with ErrFileChangedDuringRead once the retries run out
+func TestRetryOnChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		changes       int
+		retryOnChange int
+		wantCalls     int
+		wantChanged   bool
+	}{
+		{"stable", 0, 2, 1, false},
+		{"settles", 2, 2, 3, false},
+		{"exhausted", 3, 2, 3, true},
+		{"disabled", 1, 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(filename, []byte("package main\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config := DefaultConfig()
+			config.RetryOnChange = tt.retryOnChange
+			reader := NewReader(config)
+
+			calls := 0
+			_, err := readStable(reader, filename, func(r *Reader, src io.Reader) (bool, error) {
+				calls++
+				if calls <= tt.changes {
+					// Simulate a concurrent writer appending mid-read
+					f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					_, err = f.WriteString("// more\n")
+					if closeErr := f.Close(); err == nil {
+						err = closeErr
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				return r.verifyStream(src)
+			})
+			// The file is never stamped, so a completed read reports ErrNoComment
+			if errors.Is(err, ErrFileChangedDuringRead) != tt.wantChanged {
+				t.Errorf("readStable() error = %v, want ErrFileChangedDuringRead %v", err, tt.wantChanged)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// FileIntegrity: 26847CD8
@@ -0,0 +1,176 @@
+package hashfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// scriptHeader is the start of a script processed in ScriptMode.
+type scriptHeader struct {
+	shebang []byte // First line, including its line ending if any
+	comment []byte // Integrity comment on the second line, or nil
+	crc     uint32 // CRC stored in comment
+}
+
+// scriptMode reports whether scripts are stamped below their shebang line.
+func (c Config) scriptMode() bool {
+	return c.ScriptMode && strings.HasPrefix(c.style().Prefix, "#")
+}
+
+// readScriptHeader reads the shebang line and the integrity comment after it, if any.
+// ok is false, and nothing is consumed, if the content does not start with "#!".
+func readScriptHeader(r *bufio.Reader, pattern *regexp.Regexp) (header scriptHeader, ok bool, err error) {
+	if start, _ := r.Peek(2); !bytes.Equal(start, []byte("#!")) {
+		return scriptHeader{}, false, nil
+	}
+
+	header.shebang, err = r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return scriptHeader{}, false, fmt.Errorf("read error: %w", err)
+	}
+
+	// The comment must be the whole second line
+	next, err := r.Peek(r.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return scriptHeader{}, false, fmt.Errorf("read error: %w", err)
+	}
+	line := next
+	if i := bytes.IndexByte(next, '\n'); i >= 0 {
+		line = next[:i+1]
+	}
+	match := pattern.FindSubmatchIndex(line)
+	if match == nil || match[0] != 0 || match[1] != len(line) {
+		return header, true, nil
+	}
+
+	crc, err := storedDigest(line, match)
+	if err != nil {
+		return scriptHeader{}, false, err
+	}
+	header.comment = bytes.Clone(line)
+	header.crc = crc
+	r.Discard(len(line))
+	return header, true, nil
+}
+
+// hashScript returns the CRC of a script without its integrity comment, and the length of
+// the hashed content. The content after the header is read from r, positioned after the
+// header, and copied to out if non-nil; the header itself is not copied.
+func (c Config) hashScript(header scriptHeader, r io.Reader, out io.Writer) (uint32, int64, error) {
+	hasher := c.newHasher()
+	hasher.Write(header.shebang)
+	length := int64(len(header.shebang))
+	if !bytes.HasSuffix(header.shebang, []byte("\n")) {
+		// The comment will be written after the shebang, which then gains a line ending
+		hasher.Write([]byte(detectLineEnding(header.shebang)))
+		length++
+	}
+
+	dst := io.Writer(hasher)
+	if out != nil {
+		dst = io.MultiWriter(hasher, out)
+	}
+	n, err := io.Copy(dst, r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("read error: %w", err)
+	}
+	return hasher.Sum32(), length + n, nil
+}
+
+// processScript writes the integrity comment on the line after the shebang. handled is
+// false, and src is rewound, if the content does not start with a shebang. The content
+// is read twice, since the CRC must be known before the rest of the script is written.
+func (w *Writer) processScript(src io.ReadSeeker, dst io.Writer) (result ProcessResult, handled bool, err error) {
+	reader := bufio.NewReaderSize(src, w.config.BufferSize)
+	header, ok, err := readScriptHeader(reader, w.accepted)
+	if err != nil {
+		return ProcessResult{}, false, err
+	}
+	if !ok {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return ProcessResult{}, false, fmt.Errorf("seek error: %w", err)
+		}
+		return ProcessResult{}, false, nil
+	}
+
+	crc, length, err := w.config.hashScript(header, reader, nil)
+	if err != nil {
+		return ProcessResult{}, true, err
+	}
+	hashed := w.config.hashedLen(length)
+
+	// The comment must match exactly, so one with an accepted key or another digest case is rewritten
+	if bytes.Equal(trimLineEnding(header.comment), w.createComment(crc, "")) && !w.config.Force {
+		return ProcessResult{HashedBytes: hashed}, true, nil
+	}
+
+	// Second pass: shebang, comment, then the rest of the script unchanged
+	if _, err := src.Seek(int64(len(header.shebang)+len(header.comment)), io.SeekStart); err != nil {
+		return ProcessResult{}, true, fmt.Errorf("seek error: %w", err)
+	}
+	lineEnding := detectLineEnding(header.shebang)
+	writer := bufio.NewWriter(dst)
+	writer.Write(header.shebang)
+	if !bytes.HasSuffix(header.shebang, []byte("\n")) {
+		writer.WriteString(lineEnding)
+	}
+	writer.Write(w.createComment(crc, lineEnding))
+	if _, err := io.Copy(writer, src); err != nil {
+		return ProcessResult{}, true, fmt.Errorf("write error: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return ProcessResult{}, true, fmt.Errorf("write error: %w", err)
+	}
+	return ProcessResult{Changed: true, HashedBytes: hashed}, true, nil
+}
+
+// removeScriptComment copies a script whose header has been read from src to dst, without
+// the integrity comment below the shebang.
+func removeScriptComment(header scriptHeader, src io.Reader, dst io.Writer) error {
+	writer := bufio.NewWriter(dst)
+	writer.Write(header.shebang)
+	if _, err := io.Copy(writer, src); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	return nil
+}
+
+// verifyScript verifies a script whose header has been read from r.
+func (r *Reader) verifyScript(header scriptHeader, src io.Reader, out io.Writer, stripComment bool) (VerifyResult, error) {
+	if out != nil {
+		head := header.shebang
+		if !stripComment {
+			head = append(bytes.Clone(head), header.comment...)
+		}
+		if _, err := out.Write(head); err != nil {
+			return VerifyResult{}, fmt.Errorf("write error: %w", err)
+		}
+	}
+
+	crc, length, err := r.config.hashScript(header, src, out)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	result := VerifyResult{FileSize: length + int64(len(header.comment))}
+	if !bytes.HasSuffix(header.shebang, []byte("\n")) {
+		result.FileSize--
+	}
+	if header.comment == nil {
+		return result, ErrNoComment
+	}
+
+	result.StoredCRC = header.crc
+	result.ComputedCRC = crc
+	result.ContentLen = length
+	result.Valid = crc == header.crc
+	return result, nil
+}
+
+// FileIntegrity: AA88D945
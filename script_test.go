@@ -0,0 +1,249 @@
+package hashfile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func scriptConfig() Config {
+	config, _ := ConfigForStyleName("python")
+	config.ScriptMode = true
+	return config
+}
+
+// TestScriptModeRoundTrip ensures the comment is written below the shebang and verifies
+func TestScriptModeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"lf", "#!/usr/bin/env python3\nimport sys\n\nprint(sys.argv)\n"},
+		{"crlf", "#!/usr/bin/env python3\r\nimport sys\r\n"},
+		{"shebang only", "#!/usr/bin/env python3\n"},
+		{"no trailing newline", "#!/usr/bin/env python3"},
+		{"large", "#!/usr/bin/env python3\n" + strings.Repeat("print('hello')\n", 10000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.py")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := scriptConfig()
+			config.BufferSize = 4096
+			writer := NewWriter(config)
+			if err := writer.ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.SplitAfterN(string(content), "\n", 3)
+			if !strings.HasPrefix(lines[0], "#!/usr/bin/env python3") {
+				t.Errorf("Shebang moved: %q", lines[0])
+			}
+			if len(lines) < 2 || !strings.HasPrefix(lines[1], "# FileIntegrity: ") {
+				t.Fatalf("Comment not on line 2:\n%s", content)
+			}
+			rest := strings.Replace(string(content), lines[1], "", 1)
+			want := tt.content
+			if !strings.HasSuffix(want, "\n") {
+				want += "\n"
+			}
+			if rest != want {
+				t.Errorf("Content changed:\ngot  %.80q\nwant %.80q", rest, want)
+			}
+
+			valid, err := NewReader(config).VerifyFile(path)
+			if err != nil || !valid {
+				t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+			}
+
+			// Processing again must be a no-op
+			stat1, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.ProcessFile(path); err != nil {
+				t.Fatalf("Second ProcessFile() failed: %v", err)
+			}
+			stat2, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, again) || !stat1.ModTime().Equal(stat2.ModTime()) {
+				t.Error("Second ProcessFile() modified the file")
+			}
+		})
+	}
+}
+
+// TestScriptModeDetectsChanges ensures edits anywhere but the comment line invalidate it
+func TestScriptModeDetectsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.py")
+	if err := os.WriteFile(path, []byte("#!/usr/bin/env python3\nprint('hello')\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := scriptConfig()
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatal(err)
+	}
+	stamped, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edits := map[string]string{
+		"shebang":  strings.Replace(string(stamped), "python3", "python2", 1),
+		"body":     strings.Replace(string(stamped), "hello", "world", 1),
+		"appended": string(stamped) + "print('more')\n",
+	}
+	for name, edited := range edits {
+		if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+			t.Fatal(err)
+		}
+		valid, err := NewReader(config).VerifyFile(path)
+		if err != nil || valid {
+			t.Errorf("%s edit: VerifyFile() = %v, %v; want false, nil", name, valid, err)
+		}
+	}
+
+	// The comment is only looked for on line 2
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho hi\n# FileIntegrity: 00000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReader(config).VerifyFile(path); !errors.Is(err, ErrNoComment) {
+		t.Errorf("Trailing comment: VerifyFile() error = %v, want ErrNoComment", err)
+	}
+}
+
+// TestScriptModeFallback ensures files without a shebang, or non-# styles, use a trailing comment
+func TestScriptModeFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		content string
+	}{
+		{"no shebang", scriptConfig(), "print('hello')\n"},
+		{"go style", Config{CommentStyle: GoStyle, BufferSize: 64 * 1024, ScriptMode: true}, "#!/usr/bin/env gorun\npackage main\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewWriter(tt.config).ProcessFile(path); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(got), tt.content) {
+				t.Errorf("Expected trailing comment, got:\n%s", got)
+			}
+			valid, err := NewReader(tt.config).VerifyFile(path)
+			if err != nil || !valid {
+				t.Errorf("VerifyFile() = %v, %v; want true, nil", valid, err)
+			}
+		})
+	}
+}
+
+// TestScriptModeDigest ensures Digest matches the CRC written by ProcessFile
+func TestScriptModeDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.py")
+	if err := os.WriteFile(path, []byte("#!/usr/bin/env python3\nprint('hello')\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := scriptConfig()
+	before, err := NewReader(config).Digest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	result, err := NewReader(config).VerifyDetailed(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.StoredCRC != before {
+		t.Errorf("Digest() = %08X before stamping, stored CRC %08X", before, result.StoredCRC)
+	}
+}
+
+// TestScriptModeRemove ensures the comment below the shebang is removed from files and content
+func TestScriptModeRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"lf", "#!/bin/sh\necho hi\n"},
+		{"crlf", "#!/bin/sh\r\necho hi\r\n"},
+		{"shebang only", "#!/bin/sh\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.sh")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := scriptConfig()
+			writer := NewWriter(config)
+			if err := writer.ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			stamped, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stripped, found := StripComment(stamped, config)
+			if !found || string(stripped) != tt.content {
+				t.Errorf("StripComment() = %q, %v; want %q, true", stripped, found, tt.content)
+			}
+
+			removed, err := writer.RemoveComment(path)
+			if err != nil || !removed {
+				t.Fatalf("RemoveComment() = %v, %v; want true, nil", removed, err)
+			}
+			if content, err := os.ReadFile(path); err != nil || string(content) != tt.content {
+				t.Errorf("Content after RemoveComment() = %q, %v; want %q", content, err, tt.content)
+			}
+			if removed, err := writer.RemoveComment(path); err != nil || removed {
+				t.Errorf("Second RemoveComment() = %v, %v; want false, nil", removed, err)
+			}
+		})
+	}
+
+	// A trailing comment is still removed from a script in ScriptMode
+	config := scriptConfig()
+	config.ScriptMode = false
+	content := []byte("#!/bin/sh\necho hi\n")
+	stamped := append(bytes.Clone(content), NewWriter(config).createComment(0x12345678, "\n")...)
+	if stripped, found := StripComment(stamped, scriptConfig()); !found || !bytes.Equal(stripped, content) {
+		t.Errorf("StripComment() of a trailing comment = %q, %v; want %q, true", stripped, found, content)
+	}
+}
+
+// FileIntegrity: 91E4A262
@@ -0,0 +1,176 @@
+package hashfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SidecarExt is the extension appended to a file's name to name its sidecar.
+const SidecarExt = ".integrity"
+
+// sidecarPath returns the path of the sidecar holding the digest of filename: the cleaned
+// filename with SidecarExt appended, relative to SidecarDir. An absolute filename is placed
+// below SidecarDir too, with its volume name, such as "C:", as the first directory without
+// the colon. A relative filename that leaves its directory through ".." is rejected, as its
+// sidecar would be outside SidecarDir.
+func (c Config) sidecarPath(filename string) (string, error) {
+	name := filepath.Clean(filename)
+	volume := filepath.VolumeName(name)
+	name = strings.TrimLeft(name[len(volume):], `/`+string(filepath.Separator))
+	if volume != "" {
+		name = filepath.Join(strings.Trim(strings.ReplaceAll(volume, ":", ""), `/`+string(filepath.Separator)), name)
+	}
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("sidecar of %s would be outside SidecarDir", filename)
+	}
+	return filepath.Join(c.SidecarDir, name+SidecarExt), nil
+}
+
+// sidecarConfig returns c with no comment delimiters, so comments read "FileIntegrity: ..."
+// whatever the file's language.
+func (c Config) sidecarConfig() Config {
+	c.CommentStyle = CommentStyle{}
+	return c
+}
+
+// processSidecar records the digest of filename in its sidecar, leaving the file untouched.
+// A sidecar that already holds the correct comment is not rewritten.
+func (w *Writer) processSidecar(filename string, info os.FileInfo) (ProcessResult, error) {
+	crc, err := NewReader(w.config).Digest(filename)
+	if err != nil {
+		return ProcessResult{}, err
+	}
+	result := ProcessResult{HashedBytes: w.config.hashedLen(info.Size())}
+
+	path, err := w.config.sidecarPath(filename)
+	if err != nil {
+		return ProcessResult{}, err
+	}
+	comment := w.config.sidecarConfig().comment(crc, "\n")
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return ProcessResult{}, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+	if err == nil && bytes.Equal(existing, comment) && !w.config.Force {
+		return result, nil
+	}
+	result.Changed = true
+	if w.config.ReadOnly {
+		return result, fmt.Errorf("%w: %s", ErrReadOnly, path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to create sidecar directory: %w", err)
+	}
+	dst, err := createTemp(filepath.Dir(path), w.config.tempPrefix(), 0644)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := dst.Name()
+	defer os.Remove(tmpName) // Fails harmlessly once renamed
+
+	if _, err := dst.Write(comment); err != nil {
+		dst.Close()
+		return ProcessResult{}, fmt.Errorf("write error: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return ProcessResult{}, fmt.Errorf("write error: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return result, nil
+}
+
+// readSidecar reads the comment in the sidecar of filename, returning the stored CRC and the
+// configuration to hash with. A missing sidecar is reported as ErrNoComment.
+func (r *Reader) readSidecar(filename string) (uint32, Config, error) {
+	path, err := r.config.sidecarPath(filename)
+	if err != nil {
+		return 0, Config{}, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, Config{}, fmt.Errorf("%w: no sidecar %s", ErrNoComment, path)
+	}
+	if err != nil {
+		return 0, Config{}, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+
+	config := r.config.sidecarConfig()
+	match, _ := findComment(createCommentPattern(config.CommentStyle, config.keys()...), content)
+	if match == nil || match[0] != 0 {
+		return 0, Config{}, fmt.Errorf("%w: sidecar %s", ErrInvalidFormat, path)
+	}
+	stored, err := storedDigest(content, match)
+	if err != nil {
+		return 0, Config{}, fmt.Errorf("%w: sidecar %s", err, path)
+	}
+	// Hash with the limit the sidecar records, like a comment in the file
+	return stored, r.config.withRecordedLimit(content, match), nil
+}
+
+// hasSidecar reports whether filename has a sidecar holding a well-formed comment.
+func (r *Reader) hasSidecar(filename string) (bool, error) {
+	_, _, err := r.readSidecar(filename)
+	if errors.Is(err, ErrNoComment) || errors.Is(err, ErrInvalidFormat) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// removeSidecar deletes the sidecar of filename, reporting whether there was one.
+func (w *Writer) removeSidecar(filename string) (bool, error) {
+	path, err := w.config.sidecarPath(filename)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if w.config.ReadOnly {
+		return true, fmt.Errorf("%w: %s", ErrReadOnly, path)
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to remove sidecar: %w", err)
+	}
+	return true, nil
+}
+
+// verifySidecar verifies filename against the digest recorded in its sidecar. A missing
+// sidecar is reported as ErrNoComment.
+func (r *Reader) verifySidecar(filename string) (VerifyResult, error) {
+	stored, config, err := r.readSidecar(filename)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	reader := &Reader{config: config, pattern: r.pattern}
+	return readStable(reader, filename, func(r *Reader, src io.Reader) (VerifyResult, error) {
+		info, err := src.(*os.File).Stat()
+		if err != nil {
+			return VerifyResult{}, fmt.Errorf("failed to stat file: %w", err)
+		}
+		result := VerifyResult{
+			FileSize:   info.Size(),
+			ContentLen: r.config.hashedLen(info.Size()),
+			StoredCRC:  stored,
+		}
+		if result.ComputedCRC, err = r.DigestReader(src); err != nil {
+			return result, err
+		}
+		result.Valid = result.ComputedCRC == result.StoredCRC
+		return result, nil
+	})
+}
+
+// FileIntegrity: C59E2F31
@@ -0,0 +1,216 @@
+package hashfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestSidecar ensures read-only and binary files are tracked through sidecars, untouched
+func TestSidecar(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"source", "main.go", "package main\n"},
+		{"binary", "logo.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"},
+		{"nested", filepath.Join("sub", "dir", "a.py"), "print('hi')\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "src", tt.file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.content), 0444); err != nil {
+				t.Fatal(err)
+			}
+			config := ConfigForFilename(path, DefaultConfig())
+			config.SidecarDir = filepath.Join(dir, "sidecars")
+
+			if err := NewWriter(config).ProcessFile(path); err != nil {
+				t.Fatalf("ProcessFile() failed: %v", err)
+			}
+			if got, err := os.ReadFile(path); err != nil || string(got) != tt.content {
+				t.Errorf("file changed to %q (%v)", got, err)
+			}
+			sidecar := filepath.Join(config.SidecarDir, path+SidecarExt)
+			info1, err := os.Stat(sidecar)
+			if err != nil {
+				t.Fatalf("sidecar not written: %v", err)
+			}
+
+			valid, err := NewReader(config).VerifyFile(path)
+			if err != nil || !valid {
+				t.Errorf("VerifyFile() = %v, %v; want true", valid, err)
+			}
+
+			// The digest matches the one an in-file comment would carry
+			digest, err := NewReader(config).Digest(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result, err := NewReader(config).VerifyDetailed(path); err != nil || result.StoredCRC != digest {
+				t.Errorf("StoredCRC = %08X, %v; want %08X", result.StoredCRC, err, digest)
+			}
+
+			// Processing again leaves the sidecar alone
+			if err := NewWriter(config).ProcessFile(path); err != nil {
+				t.Fatalf("second ProcessFile() failed: %v", err)
+			}
+			info2, err := os.Stat(sidecar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info1.ModTime().Equal(info2.ModTime()) {
+				t.Error("sidecar rewritten on second run")
+			}
+
+			// A change to the file is detected
+			if err := os.Chmod(path, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.content+"x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			valid, err = NewReader(config).VerifyFile(path)
+			if err != nil || valid {
+				t.Errorf("VerifyFile() after change = %v, %v; want false, nil", valid, err)
+			}
+
+			// Presence is checked, and removal done, on the sidecar
+			if has, err := NewReader(config).HasComment(path); err != nil || !has {
+				t.Errorf("HasComment() = %v, %v; want true, nil", has, err)
+			}
+			if removed, err := NewWriter(config).RemoveComment(path); err != nil || !removed {
+				t.Errorf("RemoveComment() = %v, %v; want true, nil", removed, err)
+			}
+			if _, err := os.Stat(sidecar); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("sidecar still present after RemoveComment(): %v", err)
+			}
+			if got, err := os.ReadFile(path); err != nil || string(got) != tt.content+"x" {
+				t.Errorf("RemoveComment() changed the file to %q (%v)", got, err)
+			}
+			if has, err := NewReader(config).HasComment(path); err != nil || has {
+				t.Errorf("HasComment() after removal = %v, %v; want false, nil", has, err)
+			}
+		})
+	}
+}
+
+// TestSidecarErrors ensures missing and malformed sidecars are reported like missing and
+// malformed comments
+func TestSidecarErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.SidecarDir = dir
+
+	_, err := NewReader(config).VerifyFile(path)
+	if !errors.Is(err, ErrNoComment) {
+		t.Errorf("VerifyFile() without sidecar error = %v, want ErrNoComment", err)
+	}
+
+	sidecar, err := config.sidecarPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(sidecar), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sidecar, []byte("garbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewReader(config).VerifyFile(path)
+	if !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("VerifyFile() with malformed sidecar error = %v, want ErrInvalidFormat", err)
+	}
+	if has, err := NewReader(config).HasComment(path); err != nil || has {
+		t.Errorf("HasComment() with malformed sidecar = %v, %v; want false, nil", has, err)
+	}
+
+	config.ReadOnly = true
+	if err := NewWriter(config).ProcessFile(path); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ProcessFile() with ReadOnly error = %v, want ErrReadOnly", err)
+	}
+	if _, err := NewWriter(config).RemoveComment(path); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("RemoveComment() with ReadOnly error = %v, want ErrReadOnly", err)
+	}
+}
+
+// TestSidecarMaxHashBytes ensures verification uses the hash limit recorded in the sidecar
+func TestSidecarMaxHashBytes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.sql")
+	if err := os.WriteFile(path, []byte("SELECT 1;\nSELECT 2;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := ConfigForExtension(".sql")
+	config.SidecarDir = dir
+	config.MaxHashBytes = 4
+
+	if err := NewWriter(config).ProcessFile(path); err != nil {
+		t.Fatalf("ProcessFile() failed: %v", err)
+	}
+	sidecar, err := os.ReadFile(filepath.Join(dir, path+SidecarExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " first=4\n"; len(sidecar) < len(want) || string(sidecar[len(sidecar)-len(want):]) != want {
+		t.Errorf("sidecar = %q, want it to record first=4", sidecar)
+	}
+
+	config.MaxHashBytes = 0
+	valid, err := NewReader(config).VerifyFile(path)
+	if err != nil || !valid {
+		t.Errorf("VerifyFile() without a limit = %v, %v; want true", valid, err)
+	}
+}
+
+// TestSidecarPath ensures sidecars stay below SidecarDir, whatever the form of the filename
+func TestSidecarPath(t *testing.T) {
+	config := DefaultConfig()
+	config.SidecarDir = "sidecars"
+
+	tests := []struct {
+		name string
+		file string
+		want string // Empty if the filename is rejected
+	}{
+		{"relative", "main.go", filepath.Join("sidecars", "main.go"+SidecarExt)},
+		{"nested", filepath.Join("a", "b.go"), filepath.Join("sidecars", "a", "b.go"+SidecarExt)},
+		{"cleaned", filepath.Join("a", "..", "b.go"), filepath.Join("sidecars", "b.go"+SidecarExt)},
+		{"parent", filepath.Join("..", "b.go"), ""},
+		{"escaping", filepath.Join("a", "..", "..", "b.go"), ""},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, struct{ name, file, want string }{
+			"volume", `C:\src\main.go`, filepath.Join("sidecars", "C", "src", "main.go"+SidecarExt)})
+	} else {
+		tests = append(tests, struct{ name, file, want string }{
+			"absolute", "/src/../main.go", filepath.Join("sidecars", "main.go"+SidecarExt)})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.sidecarPath(tt.file)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("sidecarPath(%q) = %q, want an error", tt.file, got)
+				}
+			} else if err != nil || got != tt.want {
+				t.Errorf("sidecarPath(%q) = %q, %v; want %q", tt.file, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// FileIntegrity: BF9A2BBE
@@ -0,0 +1,50 @@
+package hashfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// otherCommentStyles lists the predefined styles whose comments a language also accepts, keyed
+// by the style its extension maps to. Styles with the same syntax share an entry, e.g. GoStyle
+// covers every C-family extension.
+var otherCommentStyles = map[CommentStyle][]CommentStyle{
+	GoStyle:  {CSSStyle}, // Block comments in C, Go, Java, JavaScript, ...
+	SQLStyle: {CSSStyle},
+}
+
+// ValidateStampedSyntax checks that the integrity comment ending filename is a comment in the
+// language its extension maps to, so a file stamped with a forced style, such as a "//" comment
+// in a Python file, is caught before it reaches a compiler or interpreter. It returns an error
+// wrapping ErrCommentSyntax if the comment is in a predefined style the language does not
+// accept, ErrNoComment if there is no integrity comment, and nil for extensions without a
+// built-in comment style.
+//
+// The check is best-effort: it knows each language only by the comment syntaxes of the
+// predefined styles and does not parse the file, so it cannot tell, for example, that the
+// comment closes an unterminated string or that a language has comment forms not listed here.
+func ValidateStampedSyntax(filename string) error {
+	style, ok := extensionStyles[filepath.Ext(filename)]
+	if !ok {
+		return nil
+	}
+	config := DefaultConfig()
+	config.CommentStyle = style
+	d, err := NewReader(config).Diagnose(filename)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case d.Comment == "":
+		return fmt.Errorf("%w: %s", ErrNoComment, filename)
+	case !d.Foreign || slices.Contains(otherCommentStyles[style], d.CommentStyle):
+		return nil
+	}
+	return fmt.Errorf("%w: %s comment in %s", ErrCommentSyntax,
+		strings.TrimSpace(d.CommentStyle.Prefix+"..."+d.CommentStyle.Suffix), filename)
+}
+
+// FileIntegrity: 543FAAC4
@@ -0,0 +1,59 @@
+package hashfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestValidateStampedSyntax ensures comments a language cannot parse are reported, and
+// alternative comment syntaxes of the language are accepted
+func TestValidateStampedSyntax(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		style   CommentStyle // Style to stamp with; zero to leave the file unstamped
+		want    error
+	}{
+		{"go", "main.go", "package main\n", GoStyle, nil},
+		{"python", "tool.py", "print(1)\n", PythonStyle, nil},
+		{"html", "page.html", "<p></p>\n", HTMLStyle, nil},
+		{"c block comment", "util.c", "int x;\n", CSSStyle, nil},
+		{"sql block comment", "q.sql", "SELECT 1;\n", CSSStyle, nil},
+		{"slashes in python", "tool.py", "print(1)\n", GoStyle, ErrCommentSyntax},
+		{"hash in go", "main.go", "package main\n", PythonStyle, ErrCommentSyntax},
+		{"slashes in css", "site.css", "p {}\n", GoStyle, ErrCommentSyntax},
+		{"html in sql", "q.sql", "SELECT 1;\n", HTMLStyle, ErrCommentSyntax},
+		{"unstamped", "main.go", "package main\n", CommentStyle{}, ErrNoComment},
+		{"unknown extension", "notes.txt", "anything\n", GoStyle, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.style != (CommentStyle{}) {
+				config := DefaultConfig()
+				config.CommentStyle = tt.style
+				if err := NewWriter(config).ProcessFile(path); err != nil {
+					t.Fatalf("ProcessFile() failed: %v", err)
+				}
+			}
+
+			err := ValidateStampedSyntax(path)
+			if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+				t.Errorf("ValidateStampedSyntax() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if err := ValidateStampedSyntax(filepath.Join(t.TempDir(), "missing.go")); err == nil {
+		t.Error("ValidateStampedSyntax() of a missing file succeeded")
+	}
+}
+
+// FileIntegrity: BE5BF948
@@ -0,0 +1,195 @@
+package hashfile
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Options controls how TreeDigest walks a directory tree.
+type Options struct {
+	// ConfigFor returns the configuration used to digest a file.
+	// Defaults to ConfigForExtension of the file's extension.
+	ConfigFor func(path string) Config
+
+	// SkipHidden skips files and directories whose names begin with ".".
+	SkipHidden bool
+}
+
+// TreeDigest computes a single digest representing the state of every regular file under root.
+//
+// Each file contributes its content digest (see Reader.Digest), so adding or updating
+// integrity comments does not change the result. Files are folded in order of their
+// slash-separated path relative to root; each entry covers both the path and the digest,
+// so editing, adding, removing, or renaming any file yields a different value.
+// Symbolic links and other non-regular files are ignored.
+func TreeDigest(root string, opts Options) (string, error) {
+	snapshot, err := TreeSnapshot(root, opts)
+	if err != nil {
+		return "", err
+	}
+
+	entries := make([]string, 0, len(snapshot))
+	for rel, digest := range snapshot {
+		entries = append(entries, fmt.Sprintf("%s\x00%s\n", rel, digest))
+	}
+	sort.Strings(entries)
+
+	hasher := crc32.NewIEEE()
+	for _, entry := range entries {
+		hasher.Write([]byte(entry))
+	}
+	return fmt.Sprintf("%08X", hasher.Sum32()), nil
+}
+
+// TreeSnapshot returns the content digest (see Reader.Digest) of every regular file under
+// root, as 8 uppercase hexadecimal digits keyed by the slash-separated path relative to
+// root. It walks the tree like TreeDigest; compare two snapshots with CompareSnapshots.
+func TreeSnapshot(root string, opts Options) (map[string]string, error) {
+	configFor := opts.ConfigFor
+	if configFor == nil {
+		configFor = func(path string) Config {
+			return ConfigForExtension(filepath.Ext(path))
+		}
+	}
+
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if opts.SkipHidden && path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk tree: %w", err)
+	}
+
+	snapshot := make(map[string]string, len(paths))
+	for _, path := range paths {
+		digest, err := NewReader(configFor(path)).Digest(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		snapshot[filepath.ToSlash(rel)] = fmt.Sprintf("%08X", digest)
+	}
+	return snapshot, nil
+}
+
+// RebaseSnapshot returns a snapshot of root, as returned by TreeSnapshot, with its paths made
+// relative to base instead, so a snapshot saved in base can be moved together with the files
+// it lists. Paths outside base start with "..". An empty base makes the paths absolute.
+func RebaseSnapshot(snapshot map[string]string, root, base string) (map[string]string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	absBase := ""
+	if base != "" {
+		if absBase, err = filepath.Abs(base); err != nil {
+			return nil, err
+		}
+	}
+
+	rebased := make(map[string]string, len(snapshot))
+	for rel, digest := range snapshot {
+		path := filepath.Join(absRoot, filepath.FromSlash(rel))
+		if absBase != "" {
+			if path, err = filepath.Rel(absBase, path); err != nil {
+				return nil, err
+			}
+		}
+		rebased[filepath.ToSlash(path)] = digest
+	}
+	return rebased, nil
+}
+
+// CheckSnapshot compares the files a snapshot lists with their current content, without
+// walking a tree: relative paths are resolved against dir, such as the directory the snapshot
+// was saved in, and absolute paths are used as they are. Files that no longer exist are
+// reported as removed. Files the snapshot does not list are not looked for, so Added is
+// always empty.
+func CheckSnapshot(snapshot map[string]string, dir string, opts Options) (SnapshotDiff, error) {
+	configFor := opts.ConfigFor
+	if configFor == nil {
+		configFor = func(path string) Config {
+			return ConfigForExtension(filepath.Ext(path))
+		}
+	}
+
+	var diff SnapshotDiff
+	for rel, want := range snapshot {
+		path := filepath.FromSlash(rel)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		digest, err := NewReader(configFor(path)).Digest(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			diff.Removed = append(diff.Removed, rel)
+			continue
+		}
+		if err != nil {
+			return SnapshotDiff{}, fmt.Errorf("%s: %w", path, err)
+		}
+		if !strings.EqualFold(fmt.Sprintf("%08X", digest), want) {
+			diff.Changed = append(diff.Changed, rel)
+		}
+	}
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff, nil
+}
+
+// SnapshotDiff lists the paths that differ between two snapshots, each sorted.
+type SnapshotDiff struct {
+	Added   []string // Paths only in the newer snapshot
+	Removed []string // Paths only in the older snapshot
+	Changed []string // Paths in both, with different digests
+}
+
+// Empty reports whether the snapshots are identical.
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// CompareSnapshots reports the files added, removed, or changed from before to after, as
+// returned by TreeSnapshot. Digests are compared without regard to case.
+func CompareSnapshots(before, after map[string]string) SnapshotDiff {
+	var diff SnapshotDiff
+	for path, digest := range after {
+		old, ok := before[path]
+		if !ok {
+			diff.Added = append(diff.Added, path)
+		} else if !strings.EqualFold(old, digest) {
+			diff.Changed = append(diff.Changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			diff.Removed = append(diff.Removed, path)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// FileIntegrity: F110E7D5
@@ -0,0 +1,222 @@
+package hashfile
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestTreeDigest ensures the tree digest tracks edits, additions, and removals but not stamping
+func TestTreeDigest(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "util.py"), []byte("pass\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := func() string {
+		d, err := TreeDigest(root, Options{})
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		return d
+	}
+
+	original := digest()
+	if digest() != original {
+		t.Fatal("TreeDigest() is not deterministic")
+	}
+
+	// Stamping files does not change the content digests
+	if err := ProcessFile(filepath.Join(root, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ProcessFile(filepath.Join(root, "sub", "util.py")); err != nil {
+		t.Fatal(err)
+	}
+	if got := digest(); got != original {
+		t.Errorf("TreeDigest() changed after stamping: %s -> %s", original, got)
+	}
+
+	// Adding a file changes the digest
+	extra := filepath.Join(root, "sub", "extra.go")
+	if err := os.WriteFile(extra, []byte("package sub\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if digest() == original {
+		t.Error("TreeDigest() unchanged after adding a file")
+	}
+
+	// Removing it restores the original
+	if err := os.Remove(extra); err != nil {
+		t.Fatal(err)
+	}
+	if got := digest(); got != original {
+		t.Errorf("TreeDigest() = %s after removal, want %s", got, original)
+	}
+
+	// Editing content changes the digest
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if digest() == original {
+		t.Error("TreeDigest() unchanged after editing a file")
+	}
+}
+
+// TestTreeDigestSkipHidden ensures hidden entries can be excluded
+func TestTreeDigestSkipHidden(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := TreeDigest(root, Options{SkipHidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("ref\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := TreeDigest(root, Options{SkipHidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Error("TreeDigest() with SkipHidden changed after adding a hidden directory")
+	}
+
+	all, err := TreeDigest(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all == after {
+		t.Error("TreeDigest() without SkipHidden ignored hidden files")
+	}
+}
+
+// TestTreeSnapshot ensures snapshots detect added, removed, and changed files but not stamping
+func TestTreeSnapshot(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot := func() map[string]string {
+		t.Helper()
+		s, err := TreeSnapshot(root, Options{})
+		if err != nil {
+			t.Fatalf("TreeSnapshot() failed: %v", err)
+		}
+		return s
+	}
+	write("main.go", "package main\n")
+	write("sub/util.py", "pass\n")
+	write("sub/old.sql", "SELECT 1;\n")
+
+	before := snapshot()
+	if len(before) != 3 || before["sub/util.py"] == "" {
+		t.Fatalf("TreeSnapshot() = %v, want 3 files keyed by relative path", before)
+	}
+	if err := ProcessFile(filepath.Join(root, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	if diff := CompareSnapshots(before, snapshot()); !diff.Empty() {
+		t.Errorf("stamping changed the snapshot: %+v", diff)
+	}
+
+	write("sub/util.py", "print(1)\n")
+	write("new.go", "package main\n")
+	if err := os.Remove(filepath.Join(root, "sub", "old.sql")); err != nil {
+		t.Fatal(err)
+	}
+	diff := CompareSnapshots(before, snapshot())
+	want := SnapshotDiff{Added: []string{"new.go"}, Removed: []string{"sub/old.sql"}, Changed: []string{"sub/util.py"}}
+	if !slices.Equal(diff.Added, want.Added) || !slices.Equal(diff.Removed, want.Removed) || !slices.Equal(diff.Changed, want.Changed) {
+		t.Errorf("CompareSnapshots() = %+v, want %+v", diff, want)
+	}
+}
+
+// TestCompareSnapshotsCase ensures digests differing only in case are equal
+func TestCompareSnapshotsCase(t *testing.T) {
+	diff := CompareSnapshots(map[string]string{"a.go": "ABCDEF12"}, map[string]string{"a.go": "abcdef12"})
+	if !diff.Empty() {
+		t.Errorf("CompareSnapshots() = %+v, want no changes", diff)
+	}
+}
+
+// TestSnapshotBase ensures a snapshot rebased onto its own directory can be moved with the
+// files it lists and still be checked from its location
+func TestSnapshotBase(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "dist")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"main.go": "package main\n", "sub/util.py": "pass\n"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot, err := TreeSnapshot(root, Options{})
+	if err != nil {
+		t.Fatalf("TreeSnapshot() failed: %v", err)
+	}
+
+	rebased, err := RebaseSnapshot(snapshot, root, base)
+	if err != nil {
+		t.Fatalf("RebaseSnapshot() failed: %v", err)
+	}
+	if got := slices.Sorted(maps.Keys(rebased)); !slices.Equal(got, []string{"dist/main.go", "dist/sub/util.py"}) {
+		t.Errorf("RebaseSnapshot() paths = %v", got)
+	}
+	absolute, err := RebaseSnapshot(snapshot, root, "")
+	if err != nil {
+		t.Fatalf("RebaseSnapshot() failed: %v", err)
+	}
+	if digest := absolute[filepath.ToSlash(filepath.Join(root, "main.go"))]; digest != snapshot["main.go"] {
+		t.Errorf("RebaseSnapshot() absolute paths = %v", absolute)
+	}
+
+	moved := filepath.Join(t.TempDir(), "copy")
+	if err := os.Rename(base, moved); err != nil {
+		t.Fatal(err)
+	}
+	if diff, err := CheckSnapshot(rebased, moved, Options{}); err != nil || !diff.Empty() {
+		t.Errorf("CheckSnapshot() after moving = %+v, %v, want no changes", diff, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(moved, "dist", "main.go"), []byte("package other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(moved, "dist", "sub", "util.py")); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := CheckSnapshot(rebased, moved, Options{})
+	if err != nil {
+		t.Fatalf("CheckSnapshot() failed: %v", err)
+	}
+	if !slices.Equal(diff.Changed, []string{"dist/main.go"}) || !slices.Equal(diff.Removed, []string{"dist/sub/util.py"}) || len(diff.Added) != 0 {
+		t.Errorf("CheckSnapshot() = %+v", diff)
+	}
+}
+
+// FileIntegrity: 7757FB8E